@@ -3,6 +3,7 @@ package apireg
 import (
 	"errors"
 	"net"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -22,6 +23,88 @@ type Api interface {
 	Equal(Api) bool
 	//Environment that the server hosting this api is running in Prod, Non-Prod or ALL
 	Environment() Environment
+	//State of the Api, either Serving or Draining
+	State() ApiState
+	//Identity of the node the Api was learned from as proven by its certificate, empty if it wasn't learned over a verified channel
+	Identity() string
+	//Group the Api was first heard on like "224.0.0.78:5324", empty if it wasn't heard on a group
+	Group() string
+	//Tags the Api was registered with like "metrics": "true", empty if it has none
+	Tags() map[string]string
+	//BindMetadata sets the fields of the struct v points to from Tags, see the package level BindMetadata
+	BindMetadata(v any) error
+	//Deprecated is true when the Api was registered as deprecated so that consumers should move off of it
+	Deprecated() bool
+	//Sunset is when a deprecated Api is going away, zero if it isn't deprecated or no date was given
+	Sunset() time.Time
+	//CanaryPercent is the percentage of traffic a canary Api wants pickers to send to it, 0 if it isn't a canary
+	CanaryPercent() float64
+	//Color is the deployment the Api belongs to like "blue" or "green", empty if it isn't part of one
+	Color() string
+	//Endpoints are every port the application serving the Api can be reached on, always including its default one on
+	//HostPort, see DefaultEndpoint
+	Endpoints() []Endpoint
+}
+
+// ApiOption is used to set the optional fields of an Api when calling NewApi
+type ApiOption func(*apiImpl)
+
+// WithState sets the ApiState of the new Api. If not provided the Api is Serving
+func WithState(s ApiState) ApiOption {
+	return func(a *apiImpl) {
+		a.state = s
+	}
+}
+
+// WithIdentity sets the verified identity of the node the new Api was learned from
+func WithIdentity(identity string) ApiOption {
+	return func(a *apiImpl) {
+		a.identity = identity
+	}
+}
+
+// WithGroup sets the group the new Api was heard on
+func WithGroup(group string) ApiOption {
+	return func(a *apiImpl) {
+		a.group = group
+	}
+}
+
+// WithApiTags sets the tags of the new Api
+func WithApiTags(tags map[string]string) ApiOption {
+	return func(a *apiImpl) {
+		a.tags = copyTags(tags)
+	}
+}
+
+// WithApiDeprecation marks the new Api as deprecated, going away at sunset unless it is zero
+func WithApiDeprecation(sunset time.Time) ApiOption {
+	return func(a *apiImpl) {
+		a.deprecated = true
+		a.sunset = sunset
+	}
+}
+
+// WithApiCanary marks the new Api as a canary that wants percent of the traffic
+func WithApiCanary(percent float64) ApiOption {
+	return func(a *apiImpl) {
+		a.canaryPercent = percent
+	}
+}
+
+// WithApiColor sets the deployment color of the new Api
+func WithApiColor(color string) ApiOption {
+	return func(a *apiImpl) {
+		a.color = color
+	}
+}
+
+// withDeprecationOf copies whether other is deprecated and its sunset
+func withDeprecationOf(other Api) ApiOption {
+	return func(a *apiImpl) {
+		a.deprecated = other.Deprecated()
+		a.sunset = other.Sunset()
+	}
 }
 
 type apiImpl struct {
@@ -31,9 +114,20 @@ type apiImpl struct {
 	remoteIP   net.IP
 	remotePort int
 	env        Environment
+	state      ApiState
+	identity   string
+	group      string
+	tags       map[string]string
+	deprecated bool
+	sunset     time.Time
+	//Percent of traffic the Api wants as a canary, 0 if it isn't one
+	canaryPercent float64
+	color         string
+	//Endpoints the Api was registered with, Endpoints adds the default one if none of them are on remotePort
+	endpoints []Endpoint
 }
 
-func NewApi(name string, ver Version, uuid uuid.UUID, env Environment, hostIP net.IP, port int) (Api, error) {
+func NewApi(name string, ver Version, uuid uuid.UUID, env Environment, hostIP net.IP, port int, opts ...ApiOption) (Api, error) {
 	if name == "" {
 		return nil, errors.New("name is required for NewApi")
 	} else if ver == nil {
@@ -44,7 +138,20 @@ func NewApi(name string, ver Version, uuid uuid.UUID, env Environment, hostIP ne
 		return nil, errors.New("port must be > 0 for NewApi")
 	}
 
-	return &apiImpl{name: name, version: ver, uuid: uuid, env: env, remoteIP: hostIP, remotePort: port}, nil
+	a := &apiImpl{name: name, version: ver, uuid: uuid, env: env, remoteIP: hostIP, remotePort: port, state: Serving}
+	for _, curOpt := range opts {
+		curOpt(a)
+	}
+	return a, nil
+}
+
+// CloneApi creates a new Api with all the same values as a and then applies opts on top of them
+func CloneApi(a Api, opts ...ApiOption) (Api, error) {
+	if a == nil {
+		return nil, errors.New("a (api) is required for CloneApi")
+	}
+	cloneOpts := append([]ApiOption{WithState(a.State()), WithIdentity(a.Identity()), WithGroup(a.Group()), WithApiTags(a.Tags()), withDeprecationOf(a), WithApiCanary(a.CanaryPercent()), WithApiColor(a.Color()), WithApiEndpoints(a.Endpoints())}, opts...)
+	return NewApi(a.Name(), a.Version(), a.UUID(), a.Environment(), a.HostIP(), a.HostPort(), cloneOpts...)
 }
 
 func (this *apiImpl) Name() string {
@@ -90,3 +197,47 @@ func (this *apiImpl) uuidEqual(other Api) bool {
 func (this *apiImpl) Environment() Environment {
 	return this.env
 }
+
+func (this *apiImpl) State() ApiState {
+	return this.state
+}
+
+func (this *apiImpl) Identity() string {
+	return this.identity
+}
+
+func (this *apiImpl) Group() string {
+	return this.group
+}
+
+func (this *apiImpl) Tags() map[string]string {
+	return copyTags(this.tags)
+}
+
+func (this *apiImpl) BindMetadata(v any) error {
+	return BindMetadata(this.tags, v)
+}
+
+func (this *apiImpl) Deprecated() bool {
+	return this.deprecated
+}
+
+func (this *apiImpl) Sunset() time.Time {
+	return this.sunset
+}
+
+func (this *apiImpl) CanaryPercent() float64 {
+	return this.canaryPercent
+}
+
+func (this *apiImpl) Color() string {
+	return this.color
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for curKey, curValue := range tags {
+		copied[curKey] = curValue
+	}
+	return copied
+}
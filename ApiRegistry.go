@@ -1,9 +1,55 @@
 package apireg
 
+import "context"
+
 type ApiRegistry interface {
-	RegisterApi(name string, version Version, port int) error
+	RegisterApi(name string, version Version, port int, opts ...RegisterOption) error
+	//DrainApi marks an Api previously registered by RegisterApi as Draining and lets everyone know right away
+	DrainApi(name string, version Version, port int) error
+	//DeregisterApi withdraws an Api previously registered by RegisterApi so others stop tracking it
+	DeregisterApi(name string, version Version, port int) error
+	//ForceAnnounce sends every Api registered by RegisterApi as name right away instead of waiting for its next resend
+	ForceAnnounce(name string) error
+	//ForceAnnounceAll sends every Api registered by RegisterApi right away, like after recovering from a network outage
+	ForceAnnounceAll() error
 	GetAvailableApis() []Api
+	//GetApisByApiName returns every Api named name. The slice can be shared with other callers so it must not be changed
 	GetApisByApiName(name string) []Api
+	//AppendApisByApiName appends every Api named name to dst and returns it, for callers that reuse a buffer
+	AppendApisByApiName(dst []Api, name string) []Api
+	//GetApisByNamePattern returns every Api with a name matching pattern like "billing-*", in the syntax of path.Match
+	GetApisByNamePattern(pattern string) ([]Api, error)
+	//WaitForApi blocks until an Api named name is Serving on another registry and returns every one that is, asking its owners for it right
+	//away instead of waiting for their next resend
+	WaitForApi(ctx context.Context, name string) ([]Api, error)
+	//WaitForInitialSync blocks until what other registries had when this one started has been heard, so that serving
+	//traffic can wait on the view of dependencies being filled in
+	WaitForInitialSync(ctx context.Context) error
+	//SetActiveColor switches every registry over to only returning the Apis named name that were registered WithColor(color),
+	//along with any that have no color. An empty color returns every color again
+	SetActiveColor(name, color string) error
+	//ActiveColor is the color set for name by the latest SetActiveColor on any registry, empty if there is none
+	ActiveColor(name string) string
+	//GetApisByGroup returns all Apis that were heard on group, see Api.Group
+	GetApisByGroup(group string) []Api
+	//ListPeers returns every other registry node that has been heard from recently, whether it announces anything we track or not
+	ListPeers() []Peer
 	AddEventListener(RegistrationListener)
 	RemoveEventListener(RegistrationListener)
+	//Subscribe delivers every RegistrationEvent on a channel, with SubscribeOptions deciding what happens when it isn't drained
+	Subscribe(opts ...SubscribeOption) (Subscription, error)
+	//Errors reports problems the registry ran into in the background, like a loop that had to be restarted.
+	//Errors are dropped if the channel isn't being read
+	Errors() <-chan error
+	//Metrics returns the current value of all of the registry's counters and gauges
+	Metrics() []Metric
+	//Close stops the registry, withdrawing every Api that it has registered
+	Close() error
+}
+
+// RunnableApiRegistry is a registry that doesn't do anything in the background until Run is called
+type RunnableApiRegistry interface {
+	ApiRegistry
+	//Run blocks until ctx is cancelled or Close is called and returns the error that stopped it
+	Run(ctx context.Context) error
 }
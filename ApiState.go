@@ -0,0 +1,10 @@
+package apireg
+
+type ApiState string
+
+const (
+	//Serving is the normal state of an Api that is accepting new work
+	Serving ApiState = "serving"
+	//Draining means the Api is still up finishing the work it has but should not be sent anything new
+	Draining ApiState = "draining"
+)
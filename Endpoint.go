@@ -0,0 +1,62 @@
+package apireg
+
+// DefaultEndpointName is the name of the endpoint on the port an Api was registered on when it wasn't given one
+const DefaultEndpointName = "default"
+
+// Endpoint is one of the ports that the application serving an Api can be reached on, like its metrics or admin port
+type Endpoint struct {
+	//Name of the endpoint like "api", "metrics" or "admin"
+	Name string
+	//Protocol spoken on the endpoint like "http" or "grpc", empty if it wasn't given
+	Protocol string
+	Port     int
+	//Path the endpoint is served under like "/metrics", empty if it wasn't given
+	Path string
+}
+
+// WithEndpoints announces eps along with the Api, adding to any set by an earlier WithEndpoints. An endpoint on the port
+// the Api is registered on describes its default endpoint, otherwise one named DefaultEndpointName is listed for it
+func WithEndpoints(eps ...Endpoint) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Endpoints = append(o.Endpoints, eps...)
+	}
+}
+
+// WithApiEndpoints sets the endpoints of the new Api
+func WithApiEndpoints(eps []Endpoint) ApiOption {
+	return func(a *apiImpl) {
+		a.endpoints = append([]Endpoint(nil), eps...)
+	}
+}
+
+// DefaultEndpoint returns the endpoint on the port a was registered on, which is where calls to a go
+func DefaultEndpoint(a Api) Endpoint {
+	for _, curEndpoint := range a.Endpoints() {
+		if curEndpoint.Port == a.HostPort() {
+			return curEndpoint
+		}
+	}
+	return Endpoint{Name: DefaultEndpointName, Port: a.HostPort()}
+}
+
+// EndpointNamed returns the endpoint of a called name, false if it has none
+func EndpointNamed(a Api, name string) (Endpoint, bool) {
+	for _, curEndpoint := range a.Endpoints() {
+		if curEndpoint.Name == name {
+			return curEndpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+func (this *apiImpl) Endpoints() []Endpoint {
+	eps := make([]Endpoint, 0, len(this.endpoints)+1)
+	hasDefault := false
+	for _, curEndpoint := range this.endpoints {
+		hasDefault = hasDefault || curEndpoint.Port == this.remotePort
+	}
+	if !hasDefault {
+		eps = append(eps, Endpoint{Name: DefaultEndpointName, Port: this.remotePort})
+	}
+	return append(eps, this.endpoints...)
+}
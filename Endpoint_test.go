@@ -0,0 +1,62 @@
+package apireg
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newEndpointApi(t *testing.T, eps ...Endpoint) Api {
+	a, err := NewApi("Served", NewVersion(1, 0, 0), uuid.New(), All, net.ParseIP("10.0.0.1"), 8080, WithApiEndpoints(eps))
+	if err != nil {
+		t.FailNow()
+	}
+	return a
+}
+
+func TestThatApiWithoutEndpointsHasDefaultOnHostPort(t *testing.T) {
+	eps := newEndpointApi(t).Endpoints()
+
+	if len(eps) != 1 || eps[0] != (Endpoint{Name: DefaultEndpointName, Port: 8080}) {
+		t.Fail()
+	}
+}
+
+func TestThatEndpointOnHostPortIsTheDefault(t *testing.T) {
+	api := Endpoint{Name: "api", Protocol: "grpc", Port: 8080}
+	a := newEndpointApi(t, api, Endpoint{Name: "metrics", Protocol: "http", Port: 9100, Path: "/metrics"})
+
+	if len(a.Endpoints()) != 2 || DefaultEndpoint(a) != api {
+		t.Fail()
+	}
+}
+
+func TestThatEndpointsAreListedAfterImpliedDefault(t *testing.T) {
+	a := newEndpointApi(t, Endpoint{Name: "metrics", Port: 9100})
+	eps := a.Endpoints()
+
+	if len(eps) != 2 || eps[0].Name != DefaultEndpointName || eps[1].Name != "metrics" || DefaultEndpoint(a).Port != 8080 {
+		t.Fail()
+	}
+}
+
+func TestThatEndpointNamedFindsEndpoint(t *testing.T) {
+	a := newEndpointApi(t, Endpoint{Name: "metrics", Port: 9100, Path: "/metrics"})
+
+	if ep, found := EndpointNamed(a, "metrics"); !found || ep.Path != "/metrics" {
+		t.Fail()
+	}
+	if _, found := EndpointNamed(a, "admin"); found {
+		t.Fail()
+	}
+}
+
+func TestThatCloneApiKeepsEndpoints(t *testing.T) {
+	a := newEndpointApi(t, Endpoint{Name: "metrics", Port: 9100})
+	cloned, err := CloneApi(a)
+
+	if err != nil || len(cloned.Endpoints()) != 2 || cloned.Endpoints()[1].Name != "metrics" {
+		t.Fail()
+	}
+}
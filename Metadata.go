@@ -0,0 +1,128 @@
+package apireg
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindMetadata sets the fields of the struct v points to from tags, the stringly typed metadata of an Api. Each field is
+// bound to the tag named in its `apireg:"name"` struct tag, or its field name without one, and `apireg:"-"` skips it.
+// `apireg:"name,required"` makes it an error for the tag to be missing. Strings, bools, ints, uints, floats,
+// time.Duration, comma separated []string and anything implementing encoding.TextUnmarshaler can be bound, and fields
+// whose tag is missing are left as they are so they can be given defaults up front
+func BindMetadata(tags map[string]string, v any) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return errors.New("v must be a non nil pointer to a struct for BindMetadata")
+	}
+	target = target.Elem()
+	targetType := target.Type()
+	errs := make([]error, 0)
+
+	for i := 0; i < targetType.NumField(); i++ {
+		field := targetType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, required := parseMetadataTag(field)
+		if name == "-" {
+			continue
+		}
+		value, tagged := tags[name]
+		if !tagged {
+			if required {
+				errs = append(errs, errors.New(fmt.Sprint("metadata ", name, " is required")))
+			}
+			continue
+		}
+		if err := setMetadataField(target.Field(i), value); err != nil {
+			errs = append(errs, errors.New(fmt.Sprint("metadata ", name, " ", err)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseMetadataTag(field reflect.StructField) (string, bool) {
+	tag, hasTag := field.Tag.Lookup("apireg")
+	if !hasTag {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	required := false
+	for _, curOpt := range parts[1:] {
+		if curOpt == "required" {
+			required = true
+		}
+	}
+	return name, required
+}
+
+func setMetadataField(field reflect.Value, value string) error {
+	if field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			field.SetInt(int64(d))
+		}
+		return err
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.New(fmt.Sprint("can't be bound to a field of type ", field.Type()))
+		}
+		values := make([]string, 0)
+		for _, curValue := range strings.Split(value, ",") {
+			if curValue = strings.TrimSpace(curValue); curValue != "" {
+				values = append(values, curValue)
+			}
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		return errors.New(fmt.Sprint("can't be bound to a field of type ", field.Type()))
+	}
+	return nil
+}
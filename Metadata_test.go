@@ -0,0 +1,64 @@
+package apireg
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testMetadata struct {
+	Region   string        `apireg:"region,required"`
+	Weight   int           `apireg:"weight"`
+	Canary   bool          `apireg:"canary"`
+	Timeout  time.Duration `apireg:"timeout"`
+	Zones    []string      `apireg:"zones"`
+	Capacity float64
+	Ignored  string `apireg:"-"`
+	Version  Environment
+	internal string
+}
+
+func TestThatBindMetadataCoercesTypes(t *testing.T) {
+	m := &testMetadata{Weight: 10}
+	err := BindMetadata(map[string]string{"region": "eu-west", "canary": "true", "timeout": "2s", "zones": "a, b,c", "Capacity": "0.5", "Ignored": "x"}, m)
+
+	if err != nil || m.Region != "eu-west" || !m.Canary || m.Timeout != time.Second*2 || len(m.Zones) != 3 || m.Zones[1] != "b" || m.Capacity != 0.5 {
+		t.Fail()
+	}
+	//Missing tags keep what was already set
+	if m.Weight != 10 || m.Ignored != "" {
+		t.Fail()
+	}
+}
+
+func TestThatBindMetadataReturnsErrorForMissingRequiredTag(t *testing.T) {
+	if BindMetadata(map[string]string{}, &testMetadata{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatBindMetadataReturnsErrorForValueOfWrongType(t *testing.T) {
+	if BindMetadata(map[string]string{"region": "eu-west", "weight": "heavy"}, &testMetadata{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatBindMetadataReturnsErrorIfNotPointerToStruct(t *testing.T) {
+	if BindMetadata(map[string]string{}, testMetadata{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatApiBindsItsTags(t *testing.T) {
+	a, err := NewApi("Bound", NewVersion(0, 0, 1), uuid.New(), All, net.ParseIP("10.0.0.2"), 80, WithApiTags(map[string]string{"region": "us-east", "weight": "5"}))
+	if err != nil {
+		t.FailNow()
+	}
+	m := &testMetadata{}
+
+	if a.BindMetadata(m) != nil || m.Region != "us-east" || m.Weight != 5 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,19 @@
+package apireg
+
+type MetricKind string
+
+const (
+	//Counter metrics only ever go up
+	Counter MetricKind = "counter"
+	//Gauge metrics are a value at the time they were read
+	Gauge MetricKind = "gauge"
+)
+
+// Metric is a single point in time reading of one of the registry's counters or gauges
+type Metric struct {
+	Name   string
+	Help   string
+	Kind   MetricKind
+	Labels map[string]string
+	Value  float64
+}
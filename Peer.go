@@ -0,0 +1,41 @@
+package apireg
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Reachability string
+
+const (
+	//ReachabilityUnknown is for nodes that aren't being pinged, either because we or they don't have pings on
+	ReachabilityUnknown Reachability = "unknown"
+	//Reachable nodes are answering our pings
+	Reachable Reachability = "reachable"
+	//Unreachable nodes have stopped answering our pings, meaning the host is most likely down or cut off
+	Unreachable Reachability = "unreachable"
+)
+
+// Peer is another registry node that this registry has heard from
+type Peer struct {
+	//ID the node sends its announcements with
+	ID uuid.UUID
+	//Address the node was last heard from
+	Address net.IP
+	//AgentVersion of the registry the node is running, empty for nodes too old to send it
+	AgentVersion string
+	//ConfigDigest is a hash of the settings the node has to share with the rest of the group like the protocol version,
+	//group and intervals. A node with a different one than ours is configured differently, empty for nodes too old to send it
+	ConfigDigest string
+	//Environment the node is running in
+	Environment Environment
+	//LastHeard is when the last message from the node arrived, including answers to our pings
+	LastHeard time.Time
+	//Reachability of the node as found by pinging it. A node that is reachable while not announcing anything is up
+	//but has let its apis expire
+	Reachability Reachability
+	//RTT is the round trip time of the last ping the node answered
+	RTT time.Duration
+}
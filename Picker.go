@@ -0,0 +1,145 @@
+package apireg
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoServingApis is returned by Pick when there is nothing that can be picked
+var ErrNoServingApis = errors.New("there are no Serving apis to pick from")
+
+// Picker chooses which of the instances of an Api a call goes to
+type Picker interface {
+	//Pick returns one of apis, ErrNoServingApis if none of them are Serving
+	Pick(apis []Api) (Api, error)
+}
+
+type pickerOptions struct {
+	sunsetListener RegistrationListener
+}
+
+type PickerOption func(*pickerOptions)
+
+// WithSunsetListener sends l a SunsetSelected event every time an Api past its sunset is picked, which only happens once
+// there is nothing else left to pick. It is the signal that consumers are still relying on a version that should be gone
+func WithSunsetListener(l RegistrationListener) PickerOption {
+	return func(o *pickerOptions) {
+		o.sunsetListener = l
+	}
+}
+
+// Candidates returns the Serving apis that a built in Picker chooses between at now. That is the ones that aren't
+// deprecated, or if there are none the deprecated ones before their sunset, or failing that the ones past it
+func Candidates(apis []Api, now time.Time) []Api {
+	tiers := make([][]Api, 3)
+	for _, curApi := range apis {
+		if curApi.State() != Serving {
+			continue
+		}
+		tier := 0
+		if isPastSunset(curApi, now) {
+			tier = 2
+		} else if curApi.Deprecated() {
+			tier = 1
+		}
+		tiers[tier] = append(tiers[tier], curApi)
+	}
+	for _, curTier := range tiers {
+		if len(curTier) > 0 {
+			return curTier
+		}
+	}
+	return nil
+}
+
+func isPastSunset(a Api, now time.Time) bool {
+	return a.Deprecated() && !a.Sunset().IsZero() && !now.Before(a.Sunset())
+}
+
+// splitCanaries separates the canaries out of candidates, along with the percentage of traffic they want between them.
+// That is the largest any of them asks for as canaries of the same rollout would all ask for the same
+func splitCanaries(candidates []Api) ([]Api, []Api, float64) {
+	stable := make([]Api, 0, len(candidates))
+	canaries := make([]Api, 0)
+	percent := 0.0
+
+	for _, curApi := range candidates {
+		if curApi.CanaryPercent() > 0 {
+			canaries = append(canaries, curApi)
+			percent = math.Max(percent, math.Min(curApi.CanaryPercent(), 100))
+		} else {
+			stable = append(stable, curApi)
+		}
+	}
+	return stable, canaries, percent
+}
+
+type picker struct {
+	opts   pickerOptions
+	choose func(candidates []Api) Api
+	//Decides whether a call goes to the canaries when they want percent of the traffic
+	toCanary func(percent float64) bool
+}
+
+// NewRoundRobinPicker picks each of the candidates in turn. Canaries are picked for exactly the percentage of calls they
+// ask for, spread out evenly
+func NewRoundRobinPicker(opts ...PickerOption) Picker {
+	var next, calls atomic.Uint64
+	toCanary := func(percent float64) bool {
+		n := float64(calls.Add(1) - 1)
+		return math.Floor((n+1)*percent/100) > math.Floor(n*percent/100)
+	}
+	return newPicker(func(candidates []Api) Api {
+		//Registries don't return apis in any particular order so they are put in one for the turns to be fair
+		sort.Slice(candidates, func(i, j int) bool {
+			if c := candidates[i].HostIP().String(); c != candidates[j].HostIP().String() {
+				return c < candidates[j].HostIP().String()
+			}
+			return candidates[i].HostPort() < candidates[j].HostPort()
+		})
+		return candidates[(next.Add(1)-1)%uint64(len(candidates))]
+	}, toCanary, opts)
+}
+
+// NewRandomPicker picks any one of the candidates at random, a canary being picked with the chance it asks for
+func NewRandomPicker(opts ...PickerOption) Picker {
+	return newPicker(func(candidates []Api) Api {
+		return candidates[rand.IntN(len(candidates))]
+	}, func(percent float64) bool {
+		return rand.Float64()*100 < percent
+	}, opts)
+}
+
+func newPicker(choose func(candidates []Api) Api, toCanary func(percent float64) bool, opts []PickerOption) *picker {
+	p := &picker{choose: choose, toCanary: toCanary}
+	for _, curOpt := range opts {
+		curOpt(&p.opts)
+	}
+	return p
+}
+
+func (this *picker) Pick(apis []Api) (Api, error) {
+	now := time.Now()
+	candidates := Candidates(apis, now)
+
+	if len(candidates) == 0 {
+		return nil, ErrNoServingApis
+	}
+	//Canaries only get their share while there is something else to send the rest to
+	if stable, canaries, percent := splitCanaries(candidates); len(canaries) > 0 && len(stable) > 0 {
+		if this.toCanary(percent) {
+			candidates = canaries
+		} else {
+			candidates = stable
+		}
+	}
+	picked := this.choose(candidates)
+	if this.opts.sunsetListener != nil && isPastSunset(picked, now) {
+		this.opts.sunsetListener.HandleRegistration(NewSunsetSelectedEvent(picked))
+	}
+	return picked, nil
+}
@@ -0,0 +1,137 @@
+package apireg
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type recordingListener struct {
+	events []RegistrationEvent
+}
+
+func (this *recordingListener) HandleRegistration(e RegistrationEvent) {
+	this.events = append(this.events, e)
+}
+
+func newPickerApi(t *testing.T, port int, opts ...ApiOption) Api {
+	a, err := NewApi("Picked", NewVersion(1, 0, 0), uuid.New(), All, net.ParseIP("10.0.0.1"), port, opts...)
+	if err != nil {
+		t.FailNow()
+	}
+	return a
+}
+
+func TestThatPickerWithoutServingApisErrors(t *testing.T) {
+	_, err := NewRoundRobinPicker().Pick([]Api{newPickerApi(t, 8080, WithState(Draining))})
+
+	if !errors.Is(err, ErrNoServingApis) {
+		t.Fail()
+	}
+}
+
+func TestThatRoundRobinPickerTakesTurns(t *testing.T) {
+	apis := []Api{newPickerApi(t, 8081), newPickerApi(t, 8080), newPickerApi(t, 8082)}
+	p := NewRoundRobinPicker()
+	picked := make(map[int]int)
+
+	for i := 0; i < 6; i++ {
+		a, err := p.Pick(apis)
+		if err != nil {
+			t.FailNow()
+		}
+		picked[a.HostPort()]++
+	}
+	if picked[8080] != 2 || picked[8081] != 2 || picked[8082] != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatPickerAvoidsDeprecatedApis(t *testing.T) {
+	apis := []Api{newPickerApi(t, 8080, WithApiDeprecation(time.Time{})), newPickerApi(t, 8081)}
+	p := NewRandomPicker()
+
+	for i := 0; i < 10; i++ {
+		if a, err := p.Pick(apis); err != nil || a.HostPort() != 8081 {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatPickerPrefersDeprecatedBeforeSunset(t *testing.T) {
+	past := newPickerApi(t, 8080, WithApiDeprecation(time.Now().Add(-time.Hour)))
+	upcoming := newPickerApi(t, 8081, WithApiDeprecation(time.Now().Add(time.Hour)))
+
+	candidates := Candidates([]Api{past, upcoming}, time.Now())
+	if len(candidates) != 1 || candidates[0] != upcoming {
+		t.Fail()
+	}
+}
+
+func TestThatPickingSunsetApiSendsEvent(t *testing.T) {
+	l := &recordingListener{}
+	past := newPickerApi(t, 8080, WithApiDeprecation(time.Now().Add(-time.Hour)))
+
+	a, err := NewRoundRobinPicker(WithSunsetListener(l)).Pick([]Api{past})
+	if err != nil || a != past || len(l.events) != 1 || l.events[0].Type() != SunsetSelected || l.events[0].Api() != past {
+		t.Fail()
+	}
+	NewRoundRobinPicker(WithSunsetListener(l)).Pick([]Api{newPickerApi(t, 8081, WithApiDeprecation(time.Time{}))})
+	if len(l.events) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatCloneApiKeepsDeprecation(t *testing.T) {
+	sunset := time.Now()
+	clone, err := CloneApi(newPickerApi(t, 8080, WithApiDeprecation(sunset)), WithState(Draining))
+
+	if err != nil || !clone.Deprecated() || !clone.Sunset().Equal(sunset) {
+		t.Fail()
+	}
+}
+
+func TestThatRoundRobinPickerSendsCanaryItsPercentage(t *testing.T) {
+	apis := []Api{newPickerApi(t, 8080), newPickerApi(t, 8081), newPickerApi(t, 8082, WithApiCanary(10))}
+	p := NewRoundRobinPicker()
+	canaryPicks := 0
+
+	for i := 0; i < 100; i++ {
+		a, err := p.Pick(apis)
+		if err != nil {
+			t.FailNow()
+		}
+		if a.CanaryPercent() > 0 {
+			canaryPicks++
+		}
+	}
+	if canaryPicks != 10 {
+		t.Fail()
+	}
+}
+
+func TestThatRandomPickerSendsCanaryAboutItsPercentage(t *testing.T) {
+	apis := []Api{newPickerApi(t, 8080), newPickerApi(t, 8081, WithApiCanary(25))}
+	p := NewRandomPicker()
+	canaryPicks := 0
+
+	for i := 0; i < 10000; i++ {
+		if a, _ := p.Pick(apis); a.CanaryPercent() > 0 {
+			canaryPicks++
+		}
+	}
+	if canaryPicks < 2000 || canaryPicks > 3000 {
+		t.Fail()
+	}
+}
+
+func TestThatOnlyCanariesAreStillPicked(t *testing.T) {
+	a, err := NewRoundRobinPicker().Pick([]Api{newPickerApi(t, 8080, WithApiCanary(5))})
+
+	if err != nil || a.HostPort() != 8080 {
+		t.Fail()
+	}
+}
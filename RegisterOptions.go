@@ -0,0 +1,137 @@
+package apireg
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errUnhealthy = errors.New("health check reported unhealthy")
+
+type UnhealthyPolicy string
+
+const (
+	//AnnounceDraining keeps announcing an unhealthy Api but as Draining so others know not to send it anything new
+	AnnounceDraining UnhealthyPolicy = "draining"
+	//SkipAnnouncement stops announcing an unhealthy Api so that it expires from other registries
+	SkipAnnouncement UnhealthyPolicy = "skip"
+)
+
+// Priority is the tier an Api is announced in, deciding how often it is resent and how many times its changes are sent
+type Priority string
+
+const (
+	//CriticalPriority is for infrastructure everything else depends on, resent twice as often and each change sent three times
+	CriticalPriority Priority = "critical"
+	//NormalPriority is what every Api is announced at unless told otherwise
+	NormalPriority Priority = "normal"
+	//BackgroundPriority is for low importance tools, resent half as often as long as that can't let it expire
+	BackgroundPriority Priority = "background"
+)
+
+// RegisterOptions are the optional settings of an Api registered with RegisterApi
+type RegisterOptions struct {
+	//HealthCheck is run before every announcement of the Api, any error means the Api is unhealthy
+	HealthCheck func(ctx context.Context) error
+	//UnhealthyPolicy decides what is announced while HealthCheck is failing
+	UnhealthyPolicy UnhealthyPolicy
+	//Token is sent along with every announcement of the Api for registries that require admission tokens
+	Token string
+	//Priority decides how often the Api is resent and how many times its changes are sent
+	Priority Priority
+	//Tags are announced along with the Api so others can filter on them, like "metrics": "true"
+	Tags map[string]string
+	//Deprecated announces the Api as deprecated so that pickers only choose it when nothing else is Serving
+	Deprecated bool
+	//Sunset is when a deprecated Api is going away, zero for no date
+	Sunset time.Time
+	//CanaryPercent announces the Api as a canary that pickers send that percentage of traffic to, 0 if it isn't one
+	CanaryPercent float64
+	//Color is the deployment the Api belongs to, only the active color of a name is returned by registries that have one
+	Color string
+	//Endpoints are the named ports the Api can be reached on, see WithEndpoints
+	Endpoints []Endpoint
+}
+
+type RegisterOption func(*RegisterOptions)
+
+// NewRegisterOptions applies opts on top of the defaults
+func NewRegisterOptions(opts ...RegisterOption) *RegisterOptions {
+	o := &RegisterOptions{UnhealthyPolicy: AnnounceDraining, Priority: NormalPriority}
+	for _, curOpt := range opts {
+		curOpt(o)
+	}
+	return o
+}
+
+// WithHealthCheck gates every announcement of the Api on check passing
+func WithHealthCheck(check func(ctx context.Context) error) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.HealthCheck = check
+	}
+}
+
+// WithHealthy is WithHealthCheck for checks that only report healthy or not
+func WithHealthy(healthy func() bool) RegisterOption {
+	return WithHealthCheck(func(ctx context.Context) error {
+		if !healthy() {
+			return errUnhealthy
+		}
+		return nil
+	})
+}
+
+// WithUnhealthyPolicy sets what gets announced while the health check is failing, defaults to AnnounceDraining
+func WithUnhealthyPolicy(p UnhealthyPolicy) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.UnhealthyPolicy = p
+	}
+}
+
+// WithPriority sets the tier the Api is announced in, defaults to NormalPriority
+func WithPriority(p Priority) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Priority = p
+	}
+}
+
+// WithTags announces tags along with the Api, adding to any set by an earlier WithTags
+func WithTags(tags map[string]string) RegisterOption {
+	return func(o *RegisterOptions) {
+		if o.Tags == nil {
+			o.Tags = make(map[string]string, len(tags))
+		}
+		for curKey, curValue := range tags {
+			o.Tags[curKey] = curValue
+		}
+	}
+}
+
+// WithDeprecation announces the Api as deprecated, going away at sunset unless it is zero
+func WithDeprecation(sunset time.Time) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Deprecated = true
+		o.Sunset = sunset
+	}
+}
+
+// WithCanary announces the Api as a canary that the built in pickers send percent of the traffic to, between 0 and 100
+func WithCanary(percent float64) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.CanaryPercent = percent
+	}
+}
+
+// WithColor announces the Api as part of the deployment color, see ApiRegistry.SetActiveColor
+func WithColor(color string) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Color = color
+	}
+}
+
+// WithToken sets the registration token sent with the Api, overriding any default token of the registry
+func WithToken(token string) RegisterOption {
+	return func(o *RegisterOptions) {
+		o.Token = token
+	}
+}
@@ -0,0 +1,44 @@
+package apireg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThatNewRegisterOptionsDefaultsToAnnounceDraining(t *testing.T) {
+	if NewRegisterOptions().UnhealthyPolicy != AnnounceDraining {
+		t.Fail()
+	}
+}
+
+func TestThatWithHealthyReturnsErrorWhenUnhealthy(t *testing.T) {
+	o := NewRegisterOptions(WithHealthy(func() bool { return false }))
+
+	if o.HealthCheck(context.Background()) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatWithHealthyReturnsNoErrorWhenHealthy(t *testing.T) {
+	o := NewRegisterOptions(WithHealthy(func() bool { return true }))
+
+	if o.HealthCheck(context.Background()) != nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewRegisterOptionsDefaultsToNormalPriority(t *testing.T) {
+	if NewRegisterOptions().Priority != NormalPriority || NewRegisterOptions(WithPriority(CriticalPriority)).Priority != CriticalPriority {
+		t.Fail()
+	}
+}
+
+func TestThatWithDeprecationSetsSunset(t *testing.T) {
+	sunset := time.Now().Add(time.Hour)
+	o := NewRegisterOptions(WithDeprecation(sunset))
+
+	if !o.Deprecated || !o.Sunset.Equal(sunset) || NewRegisterOptions().Deprecated {
+		t.Fail()
+	}
+}
@@ -5,6 +5,13 @@ type EventType string
 const (
 	Added   EventType = "add"
 	Removed EventType = "remove"
+	Updated EventType = "update"
+	//Gap marks where events were dropped for a slow subscriber, it has no Api
+	Gap EventType = "gap"
+	//SunsetSelected is sent by a Picker that chose an Api whose sunset has already passed
+	SunsetSelected EventType = "sunset-selected"
+	//ExpiringSoon is sent when an Api hasn't been refreshed and will expire soon unless it is
+	ExpiringSoon EventType = "expiring-soon"
 )
 
 type RegistrationEvent interface {
@@ -44,3 +51,40 @@ func NewRemovedEvent(a Api) RegistrationEvent {
 	}
 	return nil
 }
+
+func NewUpdatedEvent(a Api) RegistrationEvent {
+	if a != nil {
+		e := &eventImpl{}
+		e.eType = Updated
+		e.api = a
+		return e
+	}
+	return nil
+}
+
+// NewSunsetSelectedEvent is sent when a, which is past its sunset, was picked
+func NewSunsetSelectedEvent(a Api) RegistrationEvent {
+	if a != nil {
+		e := &eventImpl{}
+		e.eType = SunsetSelected
+		e.api = a
+		return e
+	}
+	return nil
+}
+
+// NewExpiringSoonEvent is sent when a hasn't been refreshed in time and is close to expiring
+func NewExpiringSoonEvent(a Api) RegistrationEvent {
+	if a != nil {
+		e := &eventImpl{}
+		e.eType = ExpiringSoon
+		e.api = a
+		return e
+	}
+	return nil
+}
+
+// NewGapEvent marks that events were dropped, see DropAndFlag
+func NewGapEvent() RegistrationEvent {
+	return &eventImpl{eType: Gap}
+}
@@ -0,0 +1,39 @@
+package apireg
+
+import "context"
+
+// Selector chooses the Api a single call goes to out of every live instance, given a hint about the call like the tenant
+// or shard it is for. It is what the http and grpc integrations route with so that routing can be anything without
+// replacing them
+type Selector interface {
+	//Select returns the one of apis to send the call with hint to, hint being empty if the call doesn't have one. apis can be
+	//shared with other callers so it must not be changed
+	Select(apis []Api, hint string) (Api, error)
+}
+
+// SelectorFunc lets a plain function be used as a Selector
+type SelectorFunc func(apis []Api, hint string) (Api, error)
+
+func (this SelectorFunc) Select(apis []Api, hint string) (Api, error) {
+	return this(apis, hint)
+}
+
+// PickerSelector is a Selector that leaves the choice to p, ignoring the hint
+func PickerSelector(p Picker) Selector {
+	return SelectorFunc(func(apis []Api, hint string) (Api, error) {
+		return p.Pick(apis)
+	})
+}
+
+type selectionHintKey struct{}
+
+// WithSelectionHint returns a copy of ctx that has the Selector of any call made with it given hint
+func WithSelectionHint(ctx context.Context, hint string) context.Context {
+	return context.WithValue(ctx, selectionHintKey{}, hint)
+}
+
+// SelectionHint returns the hint set on ctx by WithSelectionHint, empty if there isn't one
+func SelectionHint(ctx context.Context) string {
+	hint, _ := ctx.Value(selectionHintKey{}).(string)
+	return hint
+}
@@ -0,0 +1,23 @@
+package apireg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestThatSelectionHintIsCarriedByContext(t *testing.T) {
+	ctx := WithSelectionHint(context.Background(), "tenant-7")
+
+	if SelectionHint(ctx) != "tenant-7" || SelectionHint(context.Background()) != "" {
+		t.Fail()
+	}
+}
+
+func TestThatPickerSelectorPicks(t *testing.T) {
+	serving := newPickerApi(t, 8080)
+	a, err := PickerSelector(NewRoundRobinPicker()).Select([]Api{newPickerApi(t, 8081, WithState(Draining)), serving}, "ignored")
+
+	if err != nil || a != serving {
+		t.Fail()
+	}
+}
@@ -0,0 +1,57 @@
+package apireg
+
+// SlowConsumerPolicy decides what happens to events for a Subscription whose buffer is full
+type SlowConsumerPolicy string
+
+const (
+	//Block queues events until the subscriber makes room for them, without holding up any other subscriber. Registries only
+	//queue so many, dropping new events and sending a Gap once there is room if the subscriber falls that far behind
+	Block SlowConsumerPolicy = "block"
+	//DropOldest throws away the oldest buffered event to make room for the new one
+	DropOldest SlowConsumerPolicy = "drop-oldest"
+	//DropAndFlag throws away new events until there is room again, then sends a Gap event before the next one
+	DropAndFlag SlowConsumerPolicy = "drop-and-flag"
+)
+
+const defaultSubscriptionBufferSize int = 64
+
+// Subscription receives every RegistrationEvent of a registry on a channel
+type Subscription interface {
+	//Events are the registrations as they happen, closed once Close is called
+	Events() <-chan RegistrationEvent
+	//Close stops the subscription
+	Close()
+}
+
+// SubscribeOptions are the optional settings of a Subscription
+type SubscribeOptions struct {
+	//BufferSize is how many events are held for the subscriber before its SlowConsumerPolicy kicks in
+	BufferSize int
+	//Policy decides what happens to events once the buffer is full
+	Policy SlowConsumerPolicy
+}
+
+type SubscribeOption func(*SubscribeOptions)
+
+// NewSubscribeOptions applies opts on top of the defaults, a buffer of 64 events and DropAndFlag
+func NewSubscribeOptions(opts ...SubscribeOption) *SubscribeOptions {
+	o := &SubscribeOptions{BufferSize: defaultSubscriptionBufferSize, Policy: DropAndFlag}
+	for _, curOpt := range opts {
+		curOpt(o)
+	}
+	return o
+}
+
+// WithBufferSize sets how many events are held for the subscriber
+func WithBufferSize(size int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.BufferSize = size
+	}
+}
+
+// WithSlowConsumerPolicy sets what happens to events once the buffer is full, defaults to DropAndFlag
+func WithSlowConsumerPolicy(p SlowConsumerPolicy) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Policy = p
+	}
+}
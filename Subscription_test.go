@@ -0,0 +1,19 @@
+package apireg
+
+import "testing"
+
+func TestThatNewSubscribeOptionsDefaultsToDropAndFlag(t *testing.T) {
+	o := NewSubscribeOptions()
+
+	if o.Policy != DropAndFlag || o.BufferSize != defaultSubscriptionBufferSize {
+		t.Fail()
+	}
+}
+
+func TestThatSubscribeOptionsAreApplied(t *testing.T) {
+	o := NewSubscribeOptions(WithBufferSize(8), WithSlowConsumerPolicy(Block))
+
+	if o.Policy != Block || o.BufferSize != 8 {
+		t.Fail()
+	}
+}
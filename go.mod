@@ -2,4 +2,15 @@ module github.com/ZacharyDuve/apireg
 
 go 1.22.6
 
-require github.com/google/uuid v1.3.0
+require (
+	github.com/google/uuid v1.6.0
+	golang.org/x/net v0.30.0
+	golang.org/x/sys v0.26.0
+	google.golang.org/grpc v1.67.1
+)
+
+require (
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241007155032-5fefd90f89a9 // indirect
+	google.golang.org/protobuf v1.35.1 // indirect
+)
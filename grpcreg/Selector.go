@@ -0,0 +1,147 @@
+package grpcreg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ZacharyDuve/apireg"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	//Scheme of targets that are resolved from the registry, like "apireg:///helloworld.Greeter"
+	Scheme = "apireg"
+	//Name the balancer that routes each call with a Selector is registered with gRPC under
+	selectorBalancerName = "apireg_selector"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(selectorBalancerName, selectorPickerBuilder{}, base.Config{}))
+}
+
+// DialOptions are the options for a grpc client of a target like "apireg:///helloworld.Greeter" to connect to every
+// instance of the service r has and send each call to the one s selects, with the hint set on the call's context by
+// apireg.WithSelectionHint
+func DialOptions(r apireg.ApiRegistry, s apireg.Selector) ([]grpc.DialOption, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for DialOptions")
+	} else if s == nil {
+		return nil, errors.New("s (selector) is required for DialOptions")
+	}
+
+	return []grpc.DialOption{
+		grpc.WithResolvers(&registryResolverBuilder{registry: r, selector: s}),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, selectorBalancerName))}, nil
+}
+
+// selection is what a picker needs to select with, shared by every address of a target so it never changes for them
+type selection struct {
+	registry apireg.ApiRegistry
+	selector apireg.Selector
+	name     string
+}
+
+type selectionKey struct{}
+
+type registryResolverBuilder struct {
+	registry apireg.ApiRegistry
+	selector apireg.Selector
+}
+
+func (this *registryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	name := strings.TrimPrefix(target.Endpoint(), "/")
+	if name == "" {
+		return nil, errors.New("target needs the name of a service like apireg:///helloworld.Greeter")
+	}
+
+	r := &registryResolver{cc: cc, selection: &selection{registry: this.registry, selector: this.selector, name: name}}
+	this.registry.AddEventListener(r)
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	return r, nil
+}
+
+func (this *registryResolverBuilder) Scheme() string {
+	return Scheme
+}
+
+// registryResolver keeps the target's addresses up to date with every instance of its service in the registry
+type registryResolver struct {
+	cc        resolver.ClientConn
+	selection *selection
+}
+
+func (this *registryResolver) HandleRegistration(e apireg.RegistrationEvent) {
+	//Gaps have no Api so anything could have changed
+	if e.Api() == nil || e.Api().Name() == this.selection.name {
+		this.ResolveNow(resolver.ResolveNowOptions{})
+	}
+}
+
+func (this *registryResolver) ResolveNow(opts resolver.ResolveNowOptions) {
+	apis := this.selection.registry.GetApisByApiName(this.selection.name)
+	addrs := make([]resolver.Address, 0, len(apis))
+
+	for _, curApi := range apis {
+		addrs = append(addrs, resolver.Address{Addr: apiAddr(curApi), Attributes: attributes.New(selectionKey{}, this.selection)})
+	}
+	this.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+func (this *registryResolver) Close() {
+	this.selection.registry.RemoveEventListener(this)
+}
+
+func apiAddr(a apireg.Api) string {
+	return net.JoinHostPort(a.HostIP().String(), strconv.Itoa(a.HostPort()))
+}
+
+type selectorPickerBuilder struct{}
+
+func (this selectorPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	p := &selectorPicker{ready: make(map[string]balancer.SubConn, len(info.ReadySCs))}
+	for curConn, curInfo := range info.ReadySCs {
+		p.ready[curInfo.Address.Addr] = curConn
+		p.selection, _ = curInfo.Address.Attributes.Value(selectionKey{}).(*selection)
+	}
+	if p.selection == nil {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	return p
+}
+
+// selectorPicker hands the instances that are connected to the Selector for every call
+type selectorPicker struct {
+	selection *selection
+	ready     map[string]balancer.SubConn
+}
+
+func (this *selectorPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	apis := make([]apireg.Api, 0, len(this.ready))
+	for _, curApi := range this.selection.registry.GetApisByApiName(this.selection.name) {
+		if _, connected := this.ready[apiAddr(curApi)]; connected {
+			apis = append(apis, curApi)
+		}
+	}
+	if len(apis) == 0 {
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+
+	a, err := this.selection.selector.Select(apis, apireg.SelectionHint(info.Ctx))
+	if err != nil {
+		return balancer.PickResult{}, err
+	} else if a == nil {
+		return balancer.PickResult{}, errors.New(fmt.Sprint("no instance of ", this.selection.name, " was selected"))
+	}
+	conn, connected := this.ready[apiAddr(a)]
+	if !connected {
+		return balancer.PickResult{}, errors.New(fmt.Sprint("selected instance ", apiAddr(a), " of ", this.selection.name, " isn't connected"))
+	}
+	return balancer.PickResult{SubConn: conn}, nil
+}
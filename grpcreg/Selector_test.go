@@ -0,0 +1,115 @@
+package grpcreg
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type staticRegistry struct {
+	apireg.ApiRegistry
+	apis []apireg.Api
+}
+
+func (this *staticRegistry) GetApisByApiName(name string) []apireg.Api {
+	apis := make([]apireg.Api, 0)
+	for _, curApi := range this.apis {
+		if curApi.Name() == name {
+			apis = append(apis, curApi)
+		}
+	}
+	return apis
+}
+
+func (this *staticRegistry) AddEventListener(l apireg.RegistrationListener)    {}
+func (this *staticRegistry) RemoveEventListener(l apireg.RegistrationListener) {}
+
+func serveHealth(t *testing.T, status healthpb.HealthCheckResponse_ServingStatus) (*grpc.Server, apireg.Api) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", status)
+	healthpb.RegisterHealthServer(s, healthServer)
+	go s.Serve(l)
+
+	addr := l.Addr().(*net.TCPAddr)
+	a, err := apireg.NewApi("grpc.health.v1.Health", apireg.NewVersion(1, 0, 0), uuid.New(), apireg.All, addr.IP, addr.Port)
+	if err != nil {
+		t.FailNow()
+	}
+	return s, a
+}
+
+func TestThatDialOptionsRequireSelector(t *testing.T) {
+	if _, err := DialOptions(&staticRegistry{}, nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatCallsGoToSelectedInstanceWithHint(t *testing.T) {
+	s0, a0 := serveHealth(t, healthpb.HealthCheckResponse_NOT_SERVING)
+	defer s0.Stop()
+	s1, a1 := serveHealth(t, healthpb.HealthCheckResponse_SERVING)
+	defer s1.Stop()
+	var hints []string
+	var hintsMutex sync.Mutex
+	opts, err := DialOptions(&staticRegistry{apis: []apireg.Api{a0, a1}}, apireg.SelectorFunc(func(apis []apireg.Api, hint string) (apireg.Api, error) {
+		hintsMutex.Lock()
+		hints = append(hints, hint)
+		hintsMutex.Unlock()
+		//Pin everything to the second instance, once it is connected
+		for _, curApi := range apis {
+			if curApi == a1 {
+				return curApi, nil
+			}
+		}
+		return nil, apireg.ErrNoServingApis
+	}))
+	if err != nil {
+		t.FailNow()
+	}
+	conn, err := grpc.NewClient(Scheme+":///grpc.health.v1.Health", append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(apireg.WithSelectionHint(context.Background(), "tenant-7"), time.Second*5)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+
+	hintsMutex.Lock()
+	defer hintsMutex.Unlock()
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING || len(hints) == 0 || hints[len(hints)-1] != "tenant-7" {
+		t.Fail()
+	}
+}
+
+func TestThatPickFailsWhenNothingIsSelected(t *testing.T) {
+	a, err := apireg.NewApi("Billing", apireg.NewVersion(1, 0, 0), uuid.New(), apireg.All, net.ParseIP("10.0.0.2"), 9100)
+	if err != nil {
+		t.FailNow()
+	}
+	picker := &selectorPicker{
+		selection: &selection{registry: &staticRegistry{apis: []apireg.Api{a}}, name: "Billing", selector: apireg.SelectorFunc(func(apis []apireg.Api, hint string) (apireg.Api, error) {
+			return nil, nil
+		})},
+		ready: map[string]balancer.SubConn{apiAddr(a): nil}}
+
+	if _, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()}); err == nil {
+		t.Fail()
+	}
+}
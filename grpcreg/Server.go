@@ -0,0 +1,149 @@
+package grpcreg
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ZacharyDuve/apireg"
+	"google.golang.org/grpc"
+)
+
+// ServiceApi is the name and version that a gRPC service is registered under
+type ServiceApi struct {
+	Name    string
+	Version apireg.Version
+	//Options are passed along to RegisterApi for this service
+	Options []apireg.RegisterOption
+}
+
+// Server wraps a *grpc.Server so that each of its services is registered once the listener is bound,
+// marked Draining on GracefulStop and withdrawn once the server has stopped
+type Server interface {
+	Serve(l net.Listener) error
+	GracefulStop()
+	Stop()
+}
+
+type serverImpl struct {
+	server     *grpc.Server
+	registry   apireg.ApiRegistry
+	apis       []ServiceApi
+	port       int
+	registered bool
+	regMutex   sync.Mutex
+}
+
+func NewServer(s *grpc.Server, r apireg.ApiRegistry, apis ...ServiceApi) (Server, error) {
+	if s == nil {
+		return nil, errors.New("s (server) is required for NewServer")
+	} else if r == nil {
+		return nil, errors.New("r (registry) is required for NewServer")
+	} else if len(apis) == 0 {
+		return nil, errors.New("at least one ServiceApi is required for NewServer")
+	}
+
+	for _, curApi := range apis {
+		if curApi.Name == "" {
+			return nil, errors.New("every ServiceApi requires a Name")
+		} else if curApi.Version == nil {
+			return nil, errors.New("every ServiceApi requires a Version")
+		}
+	}
+
+	return &serverImpl{server: s, registry: r, apis: apis}, nil
+}
+
+// NewServerForServices registers every service that has been registered on s under its full gRPC service name
+// (ex "helloworld.Greeter") with version. Services in the grpc. namespace like reflection and health are skipped.
+// All services need to be registered on s before calling this
+func NewServerForServices(s *grpc.Server, r apireg.ApiRegistry, version apireg.Version, opts ...apireg.RegisterOption) (Server, error) {
+	if s == nil {
+		return nil, errors.New("s (server) is required for NewServerForServices")
+	}
+	return NewServer(s, r, ServiceApisFor(s, version, opts...)...)
+}
+
+// ServiceApisFor returns a ServiceApi for every non grpc. service registered on s
+func ServiceApisFor(s *grpc.Server, version apireg.Version, opts ...apireg.RegisterOption) []ServiceApi {
+	serviceInfo := s.GetServiceInfo()
+	apis := make([]ServiceApi, 0, len(serviceInfo))
+
+	for curName := range serviceInfo {
+		if !strings.HasPrefix(curName, "grpc.") {
+			apis = append(apis, ServiceApi{Name: curName, Version: version, Options: opts})
+		}
+	}
+	return apis
+}
+
+func (this *serverImpl) Serve(l net.Listener) error {
+	err := this.register(l)
+
+	if err != nil {
+		l.Close()
+		return err
+	}
+	err = this.server.Serve(l)
+	//The server is done serving no matter how it stopped so make sure no one is sent to it anymore
+	this.withdraw()
+
+	return err
+}
+
+func (this *serverImpl) register(l net.Listener) error {
+	tcpAddr, isTCP := l.Addr().(*net.TCPAddr)
+
+	if !isTCP {
+		return errors.New("listener must be bound to a tcp address to be registered")
+	}
+
+	this.regMutex.Lock()
+	defer this.regMutex.Unlock()
+
+	for i, curApi := range this.apis {
+		err := this.registry.RegisterApi(curApi.Name, curApi.Version, tcpAddr.Port, curApi.Options...)
+
+		if err != nil {
+			//Don't leave half of our services registered
+			for _, regedApi := range this.apis[:i] {
+				this.registry.DeregisterApi(regedApi.Name, regedApi.Version, tcpAddr.Port)
+			}
+			return err
+		}
+	}
+	this.port = tcpAddr.Port
+	this.registered = true
+
+	return nil
+}
+
+func (this *serverImpl) GracefulStop() {
+	this.regMutex.Lock()
+	if this.registered {
+		for _, curApi := range this.apis {
+			this.registry.DrainApi(curApi.Name, curApi.Version, this.port)
+		}
+	}
+	this.regMutex.Unlock()
+
+	this.server.GracefulStop()
+	this.withdraw()
+}
+
+func (this *serverImpl) Stop() {
+	this.withdraw()
+	this.server.Stop()
+}
+
+func (this *serverImpl) withdraw() {
+	this.regMutex.Lock()
+	if this.registered {
+		for _, curApi := range this.apis {
+			this.registry.DeregisterApi(curApi.Name, curApi.Version, this.port)
+		}
+		this.registered = false
+	}
+	this.regMutex.Unlock()
+}
@@ -0,0 +1,87 @@
+package grpcreg
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+type recordingRegistry struct {
+	apireg.ApiRegistry
+	calls      []string
+	callsMutex sync.Mutex
+}
+
+func (this *recordingRegistry) record(call string) error {
+	this.callsMutex.Lock()
+	this.calls = append(this.calls, call)
+	this.callsMutex.Unlock()
+	return nil
+}
+
+func (this *recordingRegistry) RegisterApi(name string, version apireg.Version, port int, opts ...apireg.RegisterOption) error {
+	return this.record("register " + name)
+}
+
+func (this *recordingRegistry) DrainApi(name string, version apireg.Version, port int) error {
+	return this.record("drain " + name)
+}
+
+func (this *recordingRegistry) DeregisterApi(name string, version apireg.Version, port int) error {
+	return this.record("deregister " + name)
+}
+
+func (this *recordingRegistry) Calls() []string {
+	this.callsMutex.Lock()
+	defer this.callsMutex.Unlock()
+	return append([]string{}, this.calls...)
+}
+
+func TestThatNewServerReturnsErrorWithNoServiceApis(t *testing.T) {
+	_, err := NewServer(grpc.NewServer(), &recordingRegistry{})
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatServiceApisForSkipsGrpcServices(t *testing.T) {
+	s := grpc.NewServer()
+	reflection.Register(s)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+
+	if len(ServiceApisFor(s, apireg.NewVersion(0, 0, 1))) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatGracefulStopDrainsThenDeregistersEachService(t *testing.T) {
+	reg := &recordingRegistry{}
+	s, _ := NewServer(grpc.NewServer(), reg, ServiceApi{Name: "a.Service", Version: apireg.NewVersion(0, 0, 1)})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serveDone := make(chan error)
+	go func() {
+		serveDone <- s.Serve(l)
+	}()
+	for i := 0; i < 100 && len(reg.Calls()) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	s.GracefulStop()
+	<-serveDone
+
+	calls := reg.Calls()
+	if len(calls) != 3 || calls[0] != "register a.Service" || calls[1] != "drain a.Service" || calls[2] != "deregister a.Service" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,314 @@
+package httpreg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// How long a CaddySync waits before trying again after Caddy didn't take the routes
+const caddyRetryInterval = time.Second * 5
+
+// How long a CaddySync waits on Caddy to answer before giving up and trying again
+const caddyRequestTimeout = time.Second * 10
+
+// edgeBackend is every Serving instance that a reverse proxy should route a host to
+type edgeBackend struct {
+	host string
+	//host:port of each instance
+	addrs []string
+	//scheme://host:port of each instance
+	urls []string
+	//host:port of each instance that is called over https
+	tlsAddrs []string
+}
+
+// edgeBackends groups every Serving Api in r tagged with tag by the host the tag is set to, in the same order every time
+// so that proxies don't see a change when there is none. Anyone on the network can set the tag so apis whose tag isn't a
+// valid hostname are left out rather than let it into a proxy's config
+func edgeBackends(r apireg.ApiRegistry, tag string) []edgeBackend {
+	byHost := make(map[string]*edgeBackend)
+
+	for _, curApi := range r.GetAvailableApis() {
+		host := curApi.Tags()[tag]
+		if curApi.State() != apireg.Serving || !validHostname(host) {
+			continue
+		}
+		if byHost[host] == nil {
+			byHost[host] = &edgeBackend{host: host}
+		}
+		scheme := "http"
+		addr := net.JoinHostPort(curApi.HostIP().String(), strconv.Itoa(curApi.HostPort()))
+		if apireg.DefaultEndpoint(curApi).Protocol == "https" {
+			scheme = "https"
+			byHost[host].tlsAddrs = append(byHost[host].tlsAddrs, addr)
+		}
+		byHost[host].addrs = append(byHost[host].addrs, addr)
+		byHost[host].urls = append(byHost[host].urls, scheme+"://"+addr)
+	}
+
+	backends := make([]edgeBackend, 0, len(byHost))
+	for _, curBackend := range byHost {
+		sort.Strings(curBackend.addrs)
+		sort.Strings(curBackend.urls)
+		sort.Strings(curBackend.tlsAddrs)
+		backends = append(backends, *curBackend)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].host < backends[j].host
+	})
+	return backends
+}
+
+// validHostname returns true if host is made of dot separated labels of letters, digits and dashes that don't start or
+// end with a dash, as RFC 1123 has it
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, curLabel := range strings.Split(host, ".") {
+		if curLabel == "" || len(curLabel) > 63 || curLabel[0] == '-' || curLabel[len(curLabel)-1] == '-' {
+			return false
+		}
+		for _, curRune := range curLabel {
+			if !((curRune >= 'a' && curRune <= 'z') || (curRune >= 'A' && curRune <= 'Z') || (curRune >= '0' && curRune <= '9') || curRune == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// edgeKey turns host into something that can be used as the name of a Traefik router and service. Hosts like "a.b.com"
+// and "a-b.com" read the same once the dots are replaced so a short hash of the host keeps them apart
+func edgeKey(host string) string {
+	sum := sha256.Sum256([]byte(host))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, host) + "-" + hex.EncodeToString(sum[:4])
+}
+
+type traefikConfigJSON struct {
+	HTTP traefikHTTPJSON `json:"http"`
+}
+
+type traefikHTTPJSON struct {
+	Routers  map[string]traefikRouterJSON  `json:"routers"`
+	Services map[string]traefikServiceJSON `json:"services"`
+}
+
+type traefikRouterJSON struct {
+	Rule    string `json:"rule"`
+	Service string `json:"service"`
+}
+
+type traefikServiceJSON struct {
+	LoadBalancer traefikLoadBalancerJSON `json:"loadBalancer"`
+}
+
+type traefikLoadBalancerJSON struct {
+	Servers []traefikServerJSON `json:"servers"`
+}
+
+type traefikServerJSON struct {
+	URL string `json:"url"`
+}
+
+// NewTraefikProviderHandler serves every Serving Api in r tagged with tag as Traefik dynamic configuration, for Traefik's
+// HTTP provider to poll. The tag is set to the hostname the Api is reached on from the edge, like "billing.example.com", and
+// each host gets a router with a Host rule and a service load balancing across every instance tagged with it. Instances
+// whose default endpoint has the "https" protocol are called over https
+func NewTraefikProviderHandler(r apireg.ApiRegistry, tag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		config := traefikConfigJSON{HTTP: traefikHTTPJSON{Routers: make(map[string]traefikRouterJSON), Services: make(map[string]traefikServiceJSON)}}
+
+		for _, curBackend := range edgeBackends(r, tag) {
+			key := edgeKey(curBackend.host)
+			servers := make([]traefikServerJSON, 0, len(curBackend.urls))
+			for _, curURL := range curBackend.urls {
+				servers = append(servers, traefikServerJSON{URL: curURL})
+			}
+			config.HTTP.Routers[key] = traefikRouterJSON{Rule: "Host(`" + curBackend.host + "`)", Service: key}
+			config.HTTP.Services[key] = traefikServiceJSON{LoadBalancer: traefikLoadBalancerJSON{Servers: servers}}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(config)
+	})
+}
+
+type caddyRouteJSON struct {
+	Match  []caddyMatchJSON  `json:"match"`
+	Handle []caddyHandleJSON `json:"handle"`
+}
+
+type caddyMatchJSON struct {
+	Host []string `json:"host"`
+}
+
+type caddyHandleJSON struct {
+	Handler   string              `json:"handler"`
+	Transport *caddyTransportJSON `json:"transport,omitempty"`
+	Upstreams []caddyUpstreamJSON `json:"upstreams"`
+}
+
+type caddyTransportJSON struct {
+	Protocol string        `json:"protocol"`
+	TLS      *caddyTLSJSON `json:"tls,omitempty"`
+}
+
+// caddyTLSJSON is left empty so Caddy uses its defaults for calling upstreams over TLS
+type caddyTLSJSON struct{}
+
+type caddyUpstreamJSON struct {
+	Dial string `json:"dial"`
+}
+
+// caddyRoutes is every backend of r tagged with tag as a Caddy routes array. Caddy sets whether upstreams are called
+// over TLS once per reverse_proxy handler so a host with any https instances is only routed to those
+func caddyRoutes(r apireg.ApiRegistry, tag string) []caddyRouteJSON {
+	routes := make([]caddyRouteJSON, 0)
+
+	for _, curBackend := range edgeBackends(r, tag) {
+		handle := caddyHandleJSON{Handler: "reverse_proxy"}
+		addrs := curBackend.addrs
+		if len(curBackend.tlsAddrs) > 0 {
+			addrs = curBackend.tlsAddrs
+			handle.Transport = &caddyTransportJSON{Protocol: "http", TLS: &caddyTLSJSON{}}
+		}
+		handle.Upstreams = make([]caddyUpstreamJSON, 0, len(addrs))
+		for _, curAddr := range addrs {
+			handle.Upstreams = append(handle.Upstreams, caddyUpstreamJSON{Dial: curAddr})
+		}
+		routes = append(routes, caddyRouteJSON{
+			Match:  []caddyMatchJSON{{Host: []string{curBackend.host}}},
+			Handle: []caddyHandleJSON{handle}})
+	}
+	return routes
+}
+
+// NewCaddyRoutesHandler serves the same hosts as NewTraefikProviderHandler as the routes array of a Caddy http server,
+// each matching its host and reverse proxying to every instance tagged with it
+func NewCaddyRoutesHandler(r apireg.ApiRegistry, tag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(caddyRoutes(r, tag))
+	})
+}
+
+// CaddySync keeps the routes of a Caddy http server up to date with the registry until it is closed
+type CaddySync interface {
+	//Close stops updating Caddy, leaving the routes it last set in place
+	Close() error
+}
+
+type caddySyncImpl struct {
+	registry  apireg.ApiRegistry
+	tag       string
+	routesURL string
+	client    *http.Client
+	sub       apireg.Subscription
+	//ctx is cancelled by Close so a request Caddy isn't answering doesn't hold it up
+	ctx    context.Context
+	cancel context.CancelFunc
+	//What Caddy was last sent successfully so it is only sent again when something changed
+	applied []byte
+	done    chan struct{}
+}
+
+// NewCaddySync sets the routes array at routesURL of Caddy's admin API, like
+// http://localhost:2019/config/apps/http/servers/edge/routes, to what NewCaddyRoutesHandler would serve. It is set again
+// every time the registry changes and retried every 5 seconds while Caddy isn't taking it, as Caddy can't poll for its
+// config. client is nil for http.DefaultClient, and each request gives up after 10 seconds or when the CaddySync is closed
+func NewCaddySync(r apireg.ApiRegistry, tag, routesURL string, client *http.Client) (CaddySync, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for NewCaddySync")
+	} else if tag == "" {
+		return nil, errors.New("tag is required for NewCaddySync")
+	} else if routesURL == "" {
+		return nil, errors.New("routesURL is required for NewCaddySync")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	sub, err := r.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &caddySyncImpl{registry: r, tag: tag, routesURL: routesURL, client: client, sub: sub, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	go s.run()
+	return s, nil
+}
+
+func (this *caddySyncImpl) run() {
+	defer close(this.done)
+	var retry <-chan time.Time
+
+	for {
+		if err := this.apply(); err != nil {
+			log.Println("Error setting Caddy routes at", this.routesURL, err)
+			retry = time.After(caddyRetryInterval)
+		} else {
+			retry = nil
+		}
+		select {
+		case _, open := <-this.sub.Events():
+			if !open {
+				return
+			}
+		case <-retry:
+		}
+	}
+}
+
+// apply sends Caddy the current routes if they aren't what it was last sent
+func (this *caddySyncImpl) apply() error {
+	body, err := json.Marshal(caddyRoutes(this.registry, this.tag))
+	if err != nil || bytes.Equal(body, this.applied) {
+		return err
+	}
+	//PATCH replaces what is at the path, which has to exist already
+	ctx, cancel := context.WithTimeout(this.ctx, caddyRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, this.routesURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(fmt.Sprint("caddy responded with ", resp.Status))
+	}
+	this.applied = body
+	return nil
+}
+
+func (this *caddySyncImpl) Close() error {
+	this.sub.Close()
+	this.cancel()
+	<-this.done
+	return nil
+}
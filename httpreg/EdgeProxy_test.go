@@ -0,0 +1,183 @@
+package httpreg
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+func newEdgeRegistry(t *testing.T) *staticRegistry {
+	return &staticRegistry{apis: []apireg.Api{
+		newTaggedApi(t, "Billing", "10.0.0.3", map[string]string{"edge-host": "billing.example.com"}),
+		newTaggedApi(t, "Billing", "10.0.0.2", map[string]string{"edge-host": "billing.example.com"}),
+		newTaggedApi(t, "Secure", "10.0.0.5", map[string]string{"edge-host": "secure.example.com"},
+			apireg.WithApiEndpoints([]apireg.Endpoint{{Name: apireg.DefaultEndpointName, Protocol: "https", Port: 9100}})),
+		newTaggedApi(t, "Internal", "10.0.0.4", nil),
+		newTaggedApi(t, "Hijack", "10.0.0.7", map[string]string{"edge-host": "x`) || PathPrefix(`/"}),
+		newTaggedApi(t, "Draining", "10.0.0.6", map[string]string{"edge-host": "draining.example.com"}, apireg.WithState(apireg.Draining)),
+	}}
+}
+
+func TestThatTraefikProviderHandlerRoutesEachHostToItsInstances(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	NewTraefikProviderHandler(newEdgeRegistry(t), "edge-host").ServeHTTP(rec, httptest.NewRequest("GET", "/traefik", nil))
+
+	config := traefikConfigJSON{}
+	if json.NewDecoder(rec.Body).Decode(&config) != nil || len(config.HTTP.Routers) != 2 || len(config.HTTP.Services) != 2 {
+		t.FailNow()
+	}
+	router := config.HTTP.Routers[edgeKey("billing.example.com")]
+	servers := config.HTTP.Services[router.Service].LoadBalancer.Servers
+	if router.Rule != "Host(`billing.example.com`)" || len(servers) != 2 || servers[0].URL != "http://10.0.0.2:9100" || servers[1].URL != "http://10.0.0.3:9100" {
+		t.Fail()
+	}
+	if secure := config.HTTP.Services[edgeKey("secure.example.com")].LoadBalancer.Servers; len(secure) != 1 || secure[0].URL != "https://10.0.0.5:9100" {
+		t.Fail()
+	}
+}
+
+func TestThatOnlyValidHostnamesAreRouted(t *testing.T) {
+	for _, curHost := range []string{"billing.example.com", "a-b.c", "localhost"} {
+		if !validHostname(curHost) {
+			t.Fail()
+		}
+	}
+	for _, curHost := range []string{"", "x`) || PathPrefix(`/", "-a.com", "a..com", "a.com.", "a b.com", strings.Repeat("a", 64) + ".com"} {
+		if validHostname(curHost) {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatEdgeKeysOfSimilarHostsDiffer(t *testing.T) {
+	if edgeKey("a.b.com") == edgeKey("a-b.com") {
+		t.Fail()
+	}
+}
+
+func TestThatCaddyRoutesHandlerRoutesEachHostToItsInstances(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	NewCaddyRoutesHandler(newEdgeRegistry(t), "edge-host").ServeHTTP(rec, httptest.NewRequest("GET", "/caddy", nil))
+
+	routes := make([]caddyRouteJSON, 0)
+	if json.NewDecoder(rec.Body).Decode(&routes) != nil || len(routes) != 2 {
+		t.FailNow()
+	}
+	if routes[0].Match[0].Host[0] != "billing.example.com" || routes[0].Handle[0].Handler != "reverse_proxy" ||
+		len(routes[0].Handle[0].Upstreams) != 2 || routes[0].Handle[0].Upstreams[0].Dial != "10.0.0.2:9100" || routes[0].Handle[0].Transport != nil {
+		t.Fail()
+	}
+	if secure := routes[1].Handle[0]; secure.Transport == nil || secure.Transport.Protocol != "http" || secure.Transport.TLS == nil {
+		t.Fail()
+	}
+}
+
+func TestThatCaddyRoutesHandlerListsNothingAsEmptyArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	NewCaddyRoutesHandler(&staticRegistry{}, "edge-host").ServeHTTP(rec, httptest.NewRequest("GET", "/caddy", nil))
+
+	if rec.Body.String() != "[]\n" {
+		t.Fail()
+	}
+}
+
+type staticSubscription struct {
+	events chan apireg.RegistrationEvent
+	once   sync.Once
+}
+
+func (this *staticSubscription) Events() <-chan apireg.RegistrationEvent {
+	return this.events
+}
+
+func (this *staticSubscription) Close() {
+	this.once.Do(func() { close(this.events) })
+}
+
+type subscribedRegistry struct {
+	*staticRegistry
+	sub *staticSubscription
+}
+
+func (this *subscribedRegistry) Subscribe(opts ...apireg.SubscribeOption) (apireg.Subscription, error) {
+	return this.sub, nil
+}
+
+func TestThatNewCaddySyncNeedsRoutesURL(t *testing.T) {
+	if _, err := NewCaddySync(&staticRegistry{}, "edge-host", "", nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatCaddySyncPatchesRoutesOnlyWhenTheyChange(t *testing.T) {
+	bodies := make(chan string, 4)
+	caddy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Method != http.MethodPatch || req.URL.Path != "/config/apps/http/servers/edge/routes" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		bodies <- string(body)
+	}))
+	defer caddy.Close()
+	r := &subscribedRegistry{staticRegistry: newEdgeRegistry(t), sub: &staticSubscription{events: make(chan apireg.RegistrationEvent)}}
+
+	s, err := NewCaddySync(r, "edge-host", caddy.URL+"/config/apps/http/servers/edge/routes", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	select {
+	case body := <-bodies:
+		routes := make([]caddyRouteJSON, 0)
+		if json.Unmarshal([]byte(body), &routes) != nil || len(routes) != 2 {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+	//Nothing changed so Caddy isn't sent the same routes again
+	r.sub.events <- apireg.NewAddEvent(r.apis[0])
+	s.Close()
+	if len(bodies) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatCaddySyncClosesWhileCaddyIsNotAnswering(t *testing.T) {
+	stuck := make(chan struct{})
+	caddy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-stuck:
+		}
+	}))
+	defer caddy.Close()
+	defer close(stuck)
+	r := &subscribedRegistry{staticRegistry: newEdgeRegistry(t), sub: &staticSubscription{events: make(chan apireg.RegistrationEvent)}}
+
+	s, err := NewCaddySync(r, "edge-host", caddy.URL+"/config/apps/http/servers/edge/routes", nil)
+	if err != nil {
+		t.FailNow()
+	}
+	//Give the request time to reach Caddy
+	time.Sleep(time.Millisecond * 100)
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 2):
+		t.Fail()
+	}
+}
@@ -0,0 +1,63 @@
+package httpreg
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// prometheusTargetGroupJSON is one entry of the Prometheus http_sd_config format
+type prometheusTargetGroupJSON struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// NewPrometheusSDHandler serves every Serving Api in r tagged with tag set to value, like "metrics" and "true", in the
+// Prometheus http_sd_config format so that Prometheus can discover its scrape targets from the registry. Each Api is its own
+// target group labelled with __meta_apireg_name, __meta_apireg_version, __meta_apireg_environment, __meta_apireg_group
+// and __meta_apireg_tag_<tag> for each of its tags
+func NewPrometheusSDHandler(r apireg.ApiRegistry, tag, value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		groups := make([]prometheusTargetGroupJSON, 0)
+
+		for _, curApi := range r.GetAvailableApis() {
+			tags := curApi.Tags()
+			if curApi.State() != apireg.Serving || tags[tag] != value {
+				continue
+			}
+			labels := map[string]string{
+				"__meta_apireg_name":        curApi.Name(),
+				"__meta_apireg_version":     curApi.Version().String(),
+				"__meta_apireg_environment": string(curApi.Environment()),
+				"__meta_apireg_group":       curApi.Group(),
+			}
+			for curKey, curValue := range tags {
+				labels["__meta_apireg_tag_"+prometheusLabelName(curKey)] = curValue
+			}
+			target := net.JoinHostPort(curApi.HostIP().String(), strconv.Itoa(curApi.HostPort()))
+			groups = append(groups, prometheusTargetGroupJSON{Targets: []string{target}, Labels: labels})
+		}
+		//Same order every time so Prometheus doesn't see a change when there is none
+		sort.Slice(groups, func(i, j int) bool {
+			return groups[i].Targets[0] < groups[j].Targets[0]
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+	})
+}
+
+// prometheusLabelName replaces everything that isn't allowed in a Prometheus label name with an underscore
+func prometheusLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
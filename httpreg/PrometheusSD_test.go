@@ -0,0 +1,68 @@
+package httpreg
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+type staticRegistry struct {
+	apireg.ApiRegistry
+	apis []apireg.Api
+}
+
+func (this *staticRegistry) GetAvailableApis() []apireg.Api {
+	return this.apis
+}
+
+func (this *staticRegistry) GetApisByApiName(name string) []apireg.Api {
+	apis := make([]apireg.Api, 0)
+	for _, curApi := range this.apis {
+		if curApi.Name() == name {
+			apis = append(apis, curApi)
+		}
+	}
+	return apis
+}
+
+func newTaggedApi(t *testing.T, name string, ip string, tags map[string]string, opts ...apireg.ApiOption) apireg.Api {
+	a, err := apireg.NewApi(name, apireg.NewVersion(1, 0, 0), uuid.New(), apireg.Prod, net.ParseIP(ip), 9100, append(opts, apireg.WithApiTags(tags))...)
+	if err != nil {
+		t.FailNow()
+	}
+	return a
+}
+
+func TestThatPrometheusSDHandlerOnlyListsServingApisWithTag(t *testing.T) {
+	r := &staticRegistry{apis: []apireg.Api{
+		newTaggedApi(t, "Billing", "10.0.0.2", map[string]string{"metrics": "true", "team.name": "payments"}),
+		newTaggedApi(t, "Untagged", "10.0.0.3", nil),
+		newTaggedApi(t, "Draining", "10.0.0.4", map[string]string{"metrics": "true"}, apireg.WithState(apireg.Draining)),
+	}}
+	rec := httptest.NewRecorder()
+
+	NewPrometheusSDHandler(r, "metrics", "true").ServeHTTP(rec, httptest.NewRequest("GET", "/sd", nil))
+
+	groups := make([]prometheusTargetGroupJSON, 0)
+	if json.NewDecoder(rec.Body).Decode(&groups) != nil || len(groups) != 1 {
+		t.FailNow()
+	}
+	if groups[0].Targets[0] != "10.0.0.2:9100" || groups[0].Labels["__meta_apireg_name"] != "Billing" ||
+		groups[0].Labels["__meta_apireg_tag_team_name"] != "payments" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fail()
+	}
+}
+
+func TestThatPrometheusSDHandlerListsNothingAsEmptyArray(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	NewPrometheusSDHandler(&staticRegistry{}, "metrics", "true").ServeHTTP(rec, httptest.NewRequest("GET", "/sd", nil))
+
+	if rec.Body.String() != "[]\n" {
+		t.Fail()
+	}
+}
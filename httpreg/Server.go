@@ -0,0 +1,150 @@
+package httpreg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// Server wraps an *http.Server so that its Api is registered once the listener is bound,
+// marked Draining on Shutdown and withdrawn once the server is closed
+type Server interface {
+	ListenAndServe() error
+	ListenAndServeTLS(certFile, keyFile string) error
+	Serve(l net.Listener) error
+	ServeTLS(l net.Listener, certFile, keyFile string) error
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+type serverImpl struct {
+	server     *http.Server
+	registry   apireg.ApiRegistry
+	name       string
+	version    apireg.Version
+	port       int
+	opts       []apireg.RegisterOption
+	registered bool
+	regMutex   sync.Mutex
+}
+
+// NewServer wraps s so that it is registered in r as name and version. opts are passed along to RegisterApi,
+// for example to gate announcements on a health check
+func NewServer(s *http.Server, r apireg.ApiRegistry, name string, version apireg.Version, opts ...apireg.RegisterOption) (Server, error) {
+	if s == nil {
+		return nil, errors.New("s (server) is required for NewServer")
+	} else if r == nil {
+		return nil, errors.New("r (registry) is required for NewServer")
+	} else if name == "" {
+		return nil, errors.New("name is required for NewServer")
+	} else if version == nil {
+		return nil, errors.New("version is required for NewServer")
+	}
+
+	return &serverImpl{server: s, registry: r, name: name, version: version, opts: opts}, nil
+}
+
+func (this *serverImpl) ListenAndServe() error {
+	l, err := this.listen(":http")
+
+	if err != nil {
+		return err
+	}
+	return this.Serve(l)
+}
+
+func (this *serverImpl) ListenAndServeTLS(certFile, keyFile string) error {
+	l, err := this.listen(":https")
+
+	if err != nil {
+		return err
+	}
+	return this.ServeTLS(l, certFile, keyFile)
+}
+
+func (this *serverImpl) listen(defaultAddr string) (net.Listener, error) {
+	addr := this.server.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (this *serverImpl) Serve(l net.Listener) error {
+	return this.serveWith(l, func() error {
+		return this.server.Serve(l)
+	})
+}
+
+func (this *serverImpl) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	return this.serveWith(l, func() error {
+		return this.server.ServeTLS(l, certFile, keyFile)
+	})
+}
+
+func (this *serverImpl) serveWith(l net.Listener, serve func() error) error {
+	err := this.register(l)
+
+	if err != nil {
+		l.Close()
+		return err
+	}
+	err = serve()
+	//Serve returns as soon as Shutdown starts, which withdraws once the requests still in flight are done. Stopping any
+	//other way means the server is done so make sure no one is sent to it anymore
+	if !errors.Is(err, http.ErrServerClosed) {
+		this.withdraw()
+	}
+
+	return err
+}
+
+func (this *serverImpl) register(l net.Listener) error {
+	tcpAddr, isTCP := l.Addr().(*net.TCPAddr)
+
+	if !isTCP {
+		return errors.New("listener must be bound to a tcp address to be registered")
+	}
+
+	this.regMutex.Lock()
+	defer this.regMutex.Unlock()
+	err := this.registry.RegisterApi(this.name, this.version, tcpAddr.Port, this.opts...)
+
+	if err == nil {
+		this.port = tcpAddr.Port
+		this.registered = true
+	}
+	return err
+}
+
+func (this *serverImpl) Shutdown(ctx context.Context) error {
+	this.regMutex.Lock()
+	if this.registered {
+		this.registry.DrainApi(this.name, this.version, this.port)
+	}
+	this.regMutex.Unlock()
+
+	err := this.server.Shutdown(ctx)
+	this.withdraw()
+
+	return err
+}
+
+func (this *serverImpl) Close() error {
+	this.withdraw()
+
+	return this.server.Close()
+}
+
+func (this *serverImpl) withdraw() {
+	this.regMutex.Lock()
+	if this.registered {
+		this.registry.DeregisterApi(this.name, this.version, this.port)
+		this.registered = false
+	}
+	this.regMutex.Unlock()
+}
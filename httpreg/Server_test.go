@@ -0,0 +1,139 @@
+package httpreg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+type recordingRegistry struct {
+	apireg.ApiRegistry
+	calls      []string
+	ports      []int
+	callsMutex sync.Mutex
+}
+
+func (this *recordingRegistry) record(call string, port int) error {
+	this.callsMutex.Lock()
+	this.calls = append(this.calls, call)
+	this.ports = append(this.ports, port)
+	this.callsMutex.Unlock()
+	return nil
+}
+
+func (this *recordingRegistry) RegisterApi(name string, version apireg.Version, port int, opts ...apireg.RegisterOption) error {
+	return this.record("register", port)
+}
+
+func (this *recordingRegistry) DrainApi(name string, version apireg.Version, port int) error {
+	return this.record("drain", port)
+}
+
+func (this *recordingRegistry) DeregisterApi(name string, version apireg.Version, port int) error {
+	return this.record("deregister", port)
+}
+
+func (this *recordingRegistry) Calls() []string {
+	this.callsMutex.Lock()
+	defer this.callsMutex.Unlock()
+	return append([]string{}, this.calls...)
+}
+
+func TestThatNewServerReturnsErrorIfServerIsNil(t *testing.T) {
+	_, err := NewServer(nil, &recordingRegistry{}, "Something", apireg.NewVersion(0, 0, 1))
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewServerReturnsErrorIfRegistryIsNil(t *testing.T) {
+	_, err := NewServer(&http.Server{}, nil, "Something", apireg.NewVersion(0, 0, 1))
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatServeRegistersWithBoundPort(t *testing.T) {
+	reg := &recordingRegistry{}
+	s, _ := NewServer(&http.Server{Handler: http.NotFoundHandler()}, reg, "Something", apireg.NewVersion(0, 0, 1))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(l)
+	waitForCalls(reg, 1)
+	s.Close()
+
+	if reg.Calls()[0] != "register" || reg.ports[0] != l.Addr().(*net.TCPAddr).Port {
+		t.Fail()
+	}
+}
+
+func TestThatShutdownDrainsThenDeregisters(t *testing.T) {
+	reg := &recordingRegistry{}
+	s, _ := NewServer(&http.Server{Handler: http.NotFoundHandler()}, reg, "Something", apireg.NewVersion(0, 0, 1))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serveDone := make(chan error)
+	go func() {
+		serveDone <- s.Serve(l)
+	}()
+	waitForCalls(reg, 1)
+	s.Shutdown(context.Background())
+	<-serveDone
+
+	calls := reg.Calls()
+	if len(calls) != 3 || calls[1] != "drain" || calls[2] != "deregister" {
+		t.Fail()
+	}
+}
+
+func TestThatShutdownStaysDrainingWhileRequestsAreInFlight(t *testing.T) {
+	reg := &recordingRegistry{}
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	s, _ := NewServer(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(inFlight)
+		<-release
+	})}, reg, "Something", apireg.NewVersion(0, 0, 1))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(l)
+	waitForCalls(reg, 1)
+	go http.Get("http://" + l.Addr().String())
+	<-inFlight
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- s.Shutdown(context.Background())
+	}()
+	waitForCalls(reg, 2)
+	time.Sleep(time.Millisecond * 50)
+
+	if calls := reg.Calls(); len(calls) != 2 || calls[1] != "drain" {
+		t.Fail()
+	}
+	close(release)
+	<-shutdownDone
+	if calls := reg.Calls(); len(calls) != 3 || calls[2] != "deregister" {
+		t.Fail()
+	}
+}
+
+func waitForCalls(reg *recordingRegistry, n int) {
+	for i := 0; i < 100 && len(reg.Calls()) < n; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+}
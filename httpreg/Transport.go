@@ -0,0 +1,49 @@
+package httpreg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+type transportImpl struct {
+	registry apireg.ApiRegistry
+	selector apireg.Selector
+	base     http.RoundTripper
+}
+
+// NewTransport returns a RoundTripper that sends each request to an instance of the Api named by the host of its url,
+// like http://billing/invoices, chosen by s out of every instance r has with the hint set on the request's context by
+// apireg.WithSelectionHint. base sends the request once it has been pointed at the instance, nil for http.DefaultTransport
+func NewTransport(r apireg.ApiRegistry, s apireg.Selector, base http.RoundTripper) (http.RoundTripper, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for NewTransport")
+	} else if s == nil {
+		return nil, errors.New("s (selector) is required for NewTransport")
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transportImpl{registry: r, selector: s, base: base}, nil
+}
+
+func (this *transportImpl) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := req.URL.Hostname()
+	a, err := this.selector.Select(this.registry.GetApisByApiName(name), apireg.SelectionHint(req.Context()))
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("selecting an instance of ", name, ": ", err))
+	} else if a == nil {
+		return nil, errors.New(fmt.Sprint("no instance of ", name, " was selected"))
+	}
+	//RoundTrippers aren't allowed to change the request they are given
+	routed := req.Clone(req.Context())
+	routed.URL.Host = net.JoinHostPort(a.HostIP().String(), strconv.Itoa(a.HostPort()))
+	routed.Host = req.URL.Host
+	return this.base.RoundTrip(routed)
+}
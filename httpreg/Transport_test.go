@@ -0,0 +1,63 @@
+package httpreg
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func newServerApi(t *testing.T, name string, s *httptest.Server) apireg.Api {
+	addr := s.Listener.Addr().(*net.TCPAddr)
+	a, err := apireg.NewApi(name, apireg.NewVersion(1, 0, 0), uuid.New(), apireg.Prod, addr.IP, addr.Port)
+	if err != nil {
+		t.FailNow()
+	}
+	return a
+}
+
+func TestThatNewTransportRequiresSelector(t *testing.T) {
+	if _, err := NewTransport(&staticRegistry{}, nil, nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatTransportSendsRequestToSelectedInstance(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Host+req.URL.Path)
+	}))
+	defer s.Close()
+	r := &staticRegistry{apis: []apireg.Api{newServerApi(t, "billing", s)}}
+	hints := make([]string, 0)
+	transport, err := NewTransport(r, apireg.SelectorFunc(func(apis []apireg.Api, hint string) (apireg.Api, error) {
+		hints = append(hints, hint)
+		return apis[0], nil
+	}), nil)
+	if err != nil {
+		t.FailNow()
+	}
+	req, _ := http.NewRequestWithContext(apireg.WithSelectionHint(context.Background(), "tenant-7"), "GET", "http://billing/invoices", nil)
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "billing/invoices" || len(hints) != 1 || hints[0] != "tenant-7" || req.URL.Host != "billing" {
+		t.Fail()
+	}
+}
+
+func TestThatTransportFailsWithoutInstances(t *testing.T) {
+	transport, _ := NewTransport(&staticRegistry{}, apireg.PickerSelector(apireg.NewRandomPicker()), nil)
+
+	if _, err := (&http.Client{Transport: transport}).Get("http://billing/invoices"); err == nil {
+		t.Fail()
+	}
+}
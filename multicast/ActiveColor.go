@@ -0,0 +1,152 @@
+package multicast
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// How far ahead of our clock an active color heard from the group can claim to have been set. Anything further is dropped
+// so that one bad clock can't pin a name's color against every later switch
+const maxColorClockSkew = time.Second * 10
+
+type activeColor struct {
+	color string
+	//When the color was set in unix nanoseconds, the latest setting for a name wins
+	setAt int64
+	//Set when we are the ones that set it so we keep announcing it for registries that join later
+	announcing bool
+}
+
+// syncActiveColors holds the active deployment color of every name that has one
+type syncActiveColors struct {
+	colors map[string]activeColor
+	mutex  *sync.Mutex
+}
+
+func newSyncActiveColors() *syncActiveColors {
+	c := &syncActiveColors{}
+	c.colors = make(map[string]activeColor)
+	c.mutex = &sync.Mutex{}
+
+	return c
+}
+
+// Set makes color active for name if it was set later than the current one, returning the color it replaces and whether it did
+func (this *syncActiveColors) Set(name, color string, setAt int64, announcing bool) (string, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	current, set := this.colors[name]
+
+	if set && current.setAt >= setAt {
+		return current.color, false
+	}
+	this.colors[name] = activeColor{color: color, setAt: setAt, announcing: announcing}
+	return current.color, true
+}
+
+// Claim makes color active for name as set by us at now, or just after the current one if that claims to be later so a
+// switch we make always wins. It returns the color it replaces and when the new one counts as set
+func (this *syncActiveColors) Claim(name, color string, now int64) (string, int64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	current := this.colors[name]
+
+	setAt := max(now, current.setAt+1)
+	this.colors[name] = activeColor{color: color, setAt: setAt, announcing: true}
+	return current.color, setAt
+}
+
+// Get returns the active color of name, empty if there is none
+func (this *syncActiveColors) Get(name string) string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.colors[name].color
+}
+
+// Announcing returns every color we set that hasn't been replaced since, by name
+func (this *syncActiveColors) Announcing() map[string]activeColor {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	announcing := make(map[string]activeColor)
+
+	for curName, curColor := range this.colors {
+		if curColor.announcing {
+			announcing[curName] = curColor
+		}
+	}
+	return announcing
+}
+
+// Visible returns true if a should be returned, which is when it or its name has no color or it is the active one
+func (this *syncActiveColors) Visible(a apireg.Api) bool {
+	return colorVisible(a, this.Get(a.Name()))
+}
+
+func colorVisible(a apireg.Api, active string) bool {
+	return a.Color() == "" || active == "" || a.Color() == active
+}
+
+func (this *multicastApiRegistry) SetActiveColor(name, color string) error {
+	if name == "" {
+		return errors.New("name is required for SetActiveColor")
+	}
+	name = this.normalizeName(name)
+	previous, setAt := this.activeColors.Claim(name, color, time.Now().UnixNano())
+	this.switchColor(name, previous, color)
+	return this.writeActiveColor(name, activeColor{color: color, setAt: setAt})
+}
+
+func (this *multicastApiRegistry) ActiveColor(name string) string {
+	return this.activeColors.Get(this.normalizeName(name))
+}
+
+// switchColor lets listeners know about every api of name that was hidden or shown by the active color changing to color
+func (this *multicastApiRegistry) switchColor(name, previous, color string) {
+	if previous == color {
+		return
+	}
+	this.apiRegs.RebuildView(name)
+	for _, curReg := range this.apiRegs.GetAllRegsForName(name) {
+		a := curReg.Api()
+		wasVisible, isVisible := colorVisible(a, previous), colorVisible(a, color)
+
+		if wasVisible && !isVisible {
+			this.apiRegs.listeners.Notify(apireg.NewRemovedEvent(a))
+		} else if !wasVisible && isVisible {
+			this.apiRegs.listeners.Notify(apireg.NewAddEvent(a))
+		}
+	}
+	this.metrics.Add("apireg_color_switches_total", "Number of times the active color of a name changed", map[string]string{"api": name}, 1)
+}
+
+// sendActiveColors announces every color we set again so that registries that joined since hear about it
+func (this *multicastApiRegistry) sendActiveColors() {
+	for curName, curColor := range this.activeColors.Announcing() {
+		if err := this.writeActiveColor(curName, curColor); err != nil {
+			log.Println("Error announcing active color of", curName, err)
+		}
+	}
+}
+
+func (this *multicastApiRegistry) writeActiveColor(name string, c activeColor) error {
+	//Carries the default token so that a publisher policy on tokens can tell who is switching
+	return this.writeControl(&apiRegisterMessageJSON{Type: activeColorMessage, ApiName: name, Color: c.color, ColorSetAt: c.setAt, Token: this.defaultToken})
+}
+
+func (this *multicastApiRegistry) handleActiveColor(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+	if message.ApiName == "" || message.ColorSetAt == 0 {
+		return
+	} else if message.ColorSetAt > time.Now().Add(maxColorClockSkew).UnixNano() {
+		this.metrics.Add("apireg_color_rejected_total", "Number of active color messages dropped for claiming to be set too far in the future", map[string]string{"api": message.ApiName}, 1)
+		log.Println("Dropped active color for", message.ApiName, "from", rAddr, "set too far in the future")
+		return
+	}
+	if previous, changed := this.activeColors.Set(message.ApiName, message.Color, message.ColorSetAt, false); changed {
+		this.switchColor(message.ApiName, previous, message.Color)
+	}
+}
@@ -0,0 +1,151 @@
+package multicast
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatOlderActiveColorIsIgnored(t *testing.T) {
+	c := newSyncActiveColors()
+
+	if _, changed := c.Set("Checkout", "green", 10, false); !changed {
+		t.Fail()
+	}
+	if previous, changed := c.Set("Checkout", "blue", 5, false); changed || previous != "green" || c.Get("Checkout") != "green" {
+		t.Fail()
+	}
+}
+
+func TestThatOnlyActiveColorIsVisible(t *testing.T) {
+	c := newSyncActiveColors()
+	blue, _ := apireg.NewApi("Checkout", apireg.NewVersion(1, 0, 0), uuid.New(), apireg.All, hookSource.IP, 8080, apireg.WithApiColor("blue"))
+	uncolored, _ := apireg.NewApi("Checkout", apireg.NewVersion(1, 0, 0), uuid.New(), apireg.All, hookSource.IP, 8081)
+
+	if !c.Visible(blue) {
+		t.Fail()
+	}
+	c.Set("Checkout", "green", 1, false)
+	if c.Visible(blue) || !c.Visible(uncolored) {
+		t.Fail()
+	}
+	c.Set("Checkout", "", 2, false)
+	if !c.Visible(blue) {
+		t.Fail()
+	}
+}
+
+func TestThatSetActiveColorRequiresName(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	if r.SetActiveColor("", "green") == nil {
+		t.Fail()
+	}
+}
+
+func TestThatActiveColorSwitchesEveryRegistry(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Checkout", apireg.NewVersion(1, 0, 0), 9480, apireg.WithColor("blue")), t)
+	failOnErr(reg0.RegisterApi("Checkout", apireg.NewVersion(1, 0, 0), 9481, apireg.WithColor("green")), t)
+	time.Sleep(time.Millisecond * 50)
+	if len(reg1.GetApisByApiName("Checkout")) != 2 {
+		t.FailNow()
+	}
+	sub, err := reg1.Subscribe()
+	failOnErr(err, t)
+	defer sub.Close()
+
+	failOnErr(reg0.SetActiveColor("Checkout", "green"), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Checkout")
+	if reg1.ActiveColor("Checkout") != "green" || len(apis) != 1 || apis[0].Color() != "green" || len(reg1.GetAvailableApis()) != 1 {
+		t.Fail()
+	}
+	select {
+	case e := <-sub.Events():
+		if e.Type() != apireg.Removed || e.Api().Color() != "blue" {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Fail()
+	}
+}
+
+func activeColorPayload(name, color string, setAt int64) []byte {
+	return []byte(`{"type":"` + string(activeColorMessage) + `","api-name":"` + name + `","color":"` + color + `","color-set-at":` +
+		strconv.FormatInt(setAt, 10) + `,"sender-uuid":"` + uuid.NewString() + `","env":"all"}`)
+}
+
+func TestThatActiveColorSetInTheFutureIsDropped(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(activeColorPayload("Checkout", "green", time.Now().Add(time.Hour).UnixNano()), hookSource, r.groups[0].name)
+
+	if r.ActiveColor("Checkout") != "" || r.metrics.Value("apireg_color_rejected_total", map[string]string{"api": "Checkout"}) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatLocalSwitchWinsOverColorFromFastClock(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(activeColorPayload("Checkout", "green", time.Now().Add(time.Second*5).UnixNano()), hookSource, r.groups[0].name)
+	failOnErr(r.SetActiveColor("Checkout", "blue"), t)
+
+	if r.ActiveColor("Checkout") != "blue" {
+		t.Fail()
+	}
+}
+
+func TestThatActiveColorOutsidePolicyIsDropped(t *testing.T) {
+	policy, _ := newPublisherPolicy([]PublisherRule{{Names: []string{"Checkout"}, CIDR: "10.1.0.0/16"}})
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	r.publisherPolicy = policy
+
+	r.handleMessage(activeColorPayload("Checkout", "green", time.Now().UnixNano()), hookSource, r.groups[0].name)
+	if r.ActiveColor("Checkout") != "" || r.metrics.Value("apireg_policy_rejected_total", map[string]string{"api": "Checkout"}) != 1 {
+		t.FailNow()
+	}
+	r.handleMessage(activeColorPayload("Checkout", "green", time.Now().UnixNano()), &net.UDPAddr{IP: net.ParseIP("10.1.0.3"), Port: 5324}, r.groups[0].name)
+	if r.ActiveColor("Checkout") != "green" {
+		t.Fail()
+	}
+}
+
+func TestThatActiveColorWithoutTokenIsDropped(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()),
+		WithAdmissionTokens(map[string][]string{"Checkout": {HashRegistrationToken("secret")}}))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(activeColorPayload("Checkout", "green", time.Now().UnixNano()), hookSource, r.groups[0].name)
+	if r.ActiveColor("Checkout") != "" || r.metrics.Value("apireg_admission_rejected_total", map[string]string{"api": "Checkout"}) != 1 {
+		t.FailNow()
+	}
+	tokened := strings.Replace(string(activeColorPayload("Checkout", "green", time.Now().UnixNano())), `"env"`, `"token":"secret","env"`, 1)
+	r.handleMessage([]byte(tokened), hookSource, r.groups[0].name)
+	if r.ActiveColor("Checkout") != "green" {
+		t.Fail()
+	}
+}
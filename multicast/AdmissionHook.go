@@ -0,0 +1,102 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// InboundRegistration is an announcement from another registry about to be tracked, as seen by an AdmissionHook
+type InboundRegistration struct {
+	//Withdrawn is true when the sender is withdrawing the api rather than registering it
+	Withdrawn   bool
+	Name        string
+	Version     apireg.Version
+	Port        int
+	State       apireg.ApiState
+	Tags        map[string]string
+	Environment apireg.Environment
+	SenderUUID  string
+	//Source is the address the api is served on, where the announcement came from
+	Source net.IP
+}
+
+// AdmissionHook decides what happens to every announcement from another registry before it is tracked
+type AdmissionHook interface {
+	//Admit returns an error to reject reg or nil to accept it, and may change Name, Version, Port, State and Tags to
+	//rewrite what is tracked. Withdrawals go through the hook as well so that rewrites can be applied to them the same way
+	Admit(reg *InboundRegistration) error
+}
+
+// AdmissionHookFunc lets a plain function be used as an AdmissionHook
+type AdmissionHookFunc func(reg *InboundRegistration) error
+
+func (this AdmissionHookFunc) Admit(reg *InboundRegistration) error {
+	return this(reg)
+}
+
+// AdmissionRejection is reported on Errors every time an AdmissionHook rejects an announcement
+type AdmissionRejection struct {
+	Registration InboundRegistration
+	Err          error
+}
+
+func (this *AdmissionRejection) Error() string {
+	return fmt.Sprint("announcement of ", this.Registration.Name, " from ", this.Registration.Source, " was rejected: ", this.Err)
+}
+
+func (this *AdmissionRejection) Unwrap() error {
+	return this.Err
+}
+
+// WithAdmissionHooks runs every announcement from another registry past hooks, in order, before tracking it. This includes
+// announcements learned from snapshots and answers to queries, and is where site specific rules like naming conventions
+// or port ranges belong. Rejected announcements are counted in apireg_admission_hook_rejected_total and reported on
+// Errors as an *AdmissionRejection
+func WithAdmissionHooks(hooks ...AdmissionHook) Option {
+	return func(r *multicastApiRegistry) error {
+		for _, curHook := range hooks {
+			if curHook == nil {
+				return errors.New("hooks can't be nil for WithAdmissionHooks")
+			}
+		}
+		r.admissionHooks = append(r.admissionHooks, hooks...)
+		return nil
+	}
+}
+
+// runAdmissionHooks returns false if any hook rejected message, otherwise rewriting message with whatever the hooks changed
+func (this *multicastApiRegistry) runAdmissionHooks(message *apiRegisterMessageJSON, hostIP net.IP) bool {
+	if len(this.admissionHooks) == 0 {
+		return true
+	}
+	reg := &InboundRegistration{
+		Withdrawn:   message.Type == withdrawMessage,
+		Name:        message.ApiName,
+		Version:     apireg.NewVersion(message.ApiVersion.Major, message.ApiVersion.Minor, message.ApiVersion.BugFix),
+		Port:        message.ApiPort,
+		State:       messageState(message),
+		Tags:        message.Tags,
+		Environment: message.Environment,
+		SenderUUID:  message.SenderUUID,
+		Source:      hostIP}
+
+	for _, curHook := range this.admissionHooks {
+		if err := curHook.Admit(reg); err != nil {
+			this.metrics.Add("apireg_admission_hook_rejected_total", "Number of announcements rejected by an admission hook", map[string]string{"api": message.ApiName}, 1)
+			this.reportError(&AdmissionRejection{Registration: *reg, Err: err})
+			return false
+		}
+	}
+	if reg.Version == nil {
+		reg.Version = apireg.NewVersion(message.ApiVersion.Major, message.ApiVersion.Minor, message.ApiVersion.BugFix)
+	}
+	message.ApiName = reg.Name
+	message.ApiVersion = &versionJSON{Major: reg.Version.Major(), Minor: reg.Version.Minor(), BugFix: reg.Version.BugFix()}
+	message.ApiPort = reg.Port
+	message.State = reg.State
+	message.Tags = reg.Tags
+	return true
+}
@@ -0,0 +1,90 @@
+package multicast
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+var errPortOutOfRange = errors.New("port out of range")
+
+var hookSource = &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: DEFAULT_MULTICAST_GROUP_PORT}
+
+func newHookedRegistry(t *testing.T, hooks ...AdmissionHook) *multicastApiRegistry {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithAdmissionHooks(hooks...))
+	failOnErr(err, t)
+	return r
+}
+
+func TestThatAdmissionHookCanRejectRegistration(t *testing.T) {
+	r := newHookedRegistry(t, AdmissionHookFunc(func(reg *InboundRegistration) error {
+		if reg.Port < 8000 || reg.Port > 8999 {
+			return errPortOutOfRange
+		}
+		return nil
+	}))
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Ranged", 9000, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Ranged", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+
+	apis := r.GetApisByApiName("Ranged")
+	if len(apis) != 1 || apis[0].HostPort() != 8080 {
+		t.Fail()
+	}
+	rejection := &AdmissionRejection{}
+	if err := <-r.Errors(); !errors.As(err, &rejection) || !errors.Is(err, errPortOutOfRange) || rejection.Registration.Port != 9000 {
+		t.Fail()
+	}
+}
+
+func TestThatAdmissionHookRewritesRegistrationsAndWithdrawals(t *testing.T) {
+	r := newHookedRegistry(t, AdmissionHookFunc(func(reg *InboundRegistration) error {
+		reg.Name = strings.ToLower(reg.Name)
+		reg.Tags = map[string]string{"admitted": "true"}
+		return nil
+	}))
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Billing", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+
+	apis := r.GetApisByApiName("billing")
+	if len(apis) != 1 || apis[0].Tags()["admitted"] != "true" || len(r.GetApisByApiName("Billing")) != 0 {
+		t.FailNow()
+	}
+	r.handleMessage(sequencedMessageOfType(withdrawMessage, "Billing", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+	if len(r.GetApisByApiName("billing")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatAdmissionHooksRunInOrder(t *testing.T) {
+	order := make([]string, 0)
+	r := newHookedRegistry(t,
+		AdmissionHookFunc(func(reg *InboundRegistration) error {
+			order = append(order, "first")
+			return errors.New("rejected")
+		}),
+		AdmissionHookFunc(func(reg *InboundRegistration) error {
+			order = append(order, "second")
+			return nil
+		}))
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Ordered", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+
+	if len(order) != 1 || order[0] != "first" || len(r.GetApisByApiName("Ordered")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatWithAdmissionHooksReturnsErrorForNilHook(t *testing.T) {
+	if WithAdmissionHooks(nil)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
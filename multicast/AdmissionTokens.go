@@ -0,0 +1,77 @@
+package multicast
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+)
+
+// HashRegistrationToken returns the hex encoded SHA-256 hash of token which is what WithAdmissionTokens is configured with
+// so that receivers never need to know the tokens themselves
+func HashRegistrationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type tokenRule struct {
+	pattern string
+	hashes  [][]byte
+}
+
+// admissionTokens decides if an announcement carries a token that allows it to announce its api name
+type admissionTokens struct {
+	rules []*tokenRule
+}
+
+func newAdmissionTokens(rules map[string][]string) (*admissionTokens, error) {
+	a := &admissionTokens{rules: make([]*tokenRule, 0, len(rules))}
+
+	for curPattern, curHashes := range rules {
+		if _, err := path.Match(curPattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprint("Invalid pattern ", curPattern, " for admission tokens ", err))
+		}
+		rule := &tokenRule{pattern: curPattern, hashes: make([][]byte, len(curHashes))}
+
+		for i, curHash := range curHashes {
+			hash, err := hex.DecodeString(curHash)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, errors.New(fmt.Sprint("Invalid token hash for pattern ", curPattern, ", hashes must be hex encoded SHA-256"))
+			}
+			rule.hashes[i] = hash
+		}
+		a.rules = append(a.rules, rule)
+	}
+	return a, nil
+}
+
+// Admit returns true if token is valid for any rule whose pattern matches name. A name that no rule covers is never admitted
+func (this *admissionTokens) Admit(name, token string) bool {
+	tokenHash := sha256.Sum256([]byte(token))
+
+	for _, curRule := range this.rules {
+		if matched, _ := path.Match(curRule.pattern, name); !matched {
+			continue
+		}
+		for _, curHash := range curRule.hashes {
+			if subtle.ConstantTimeCompare(curHash, tokenHash[:]) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// admitToken returns false if admission tokens are in use and message doesn't carry a valid one for its api name
+func (this *multicastApiRegistry) admitToken(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) bool {
+	if this.admissionTokens == nil || this.admissionTokens.Admit(message.ApiName, message.Token) {
+		return true
+	}
+	this.metrics.Add("apireg_admission_rejected_total", "Number of announcements rejected for not carrying a valid token", map[string]string{"api": message.ApiName}, 1)
+	log.Println("Rejected", message.Type, "message for", message.ApiName, "from", rAddr, "without a valid token")
+	return false
+}
@@ -0,0 +1,51 @@
+package multicast
+
+import "testing"
+
+func TestThatNewAdmissionTokensReturnsErrorForBadHash(t *testing.T) {
+	_, err := newAdmissionTokens(map[string][]string{"*": {"not-a-hash"}})
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewAdmissionTokensReturnsErrorForBadPattern(t *testing.T) {
+	_, err := newAdmissionTokens(map[string][]string{"[": {HashRegistrationToken("a")}})
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatValidTokenForMatchingPatternIsAdmitted(t *testing.T) {
+	a, _ := newAdmissionTokens(map[string][]string{"billing-*": {HashRegistrationToken("secret")}})
+
+	if !a.Admit("billing-api", "secret") {
+		t.Fail()
+	}
+}
+
+func TestThatWrongTokenIsNotAdmitted(t *testing.T) {
+	a, _ := newAdmissionTokens(map[string][]string{"billing-*": {HashRegistrationToken("secret")}})
+
+	if a.Admit("billing-api", "guess") {
+		t.Fail()
+	}
+}
+
+func TestThatNameNotCoveredByAnyPatternIsNotAdmitted(t *testing.T) {
+	a, _ := newAdmissionTokens(map[string][]string{"billing-*": {HashRegistrationToken("secret")}})
+
+	if a.Admit("orders-api", "secret") {
+		t.Fail()
+	}
+}
+
+func TestThatAnyOfSeveralHashesIsAdmitted(t *testing.T) {
+	a, _ := newAdmissionTokens(map[string][]string{"orders": {HashRegistrationToken("old"), HashRegistrationToken("new")}})
+
+	if !a.Admit("orders", "old") || !a.Admit("orders", "new") {
+		t.Fail()
+	}
+}
@@ -1,11 +1,126 @@
 package multicast
 
-import "github.com/ZacharyDuve/apireg"
+import (
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
 
 type apiRegisterMessageJSON struct {
+	Type        messageType        `json:"type,omitempty"`
 	ApiName     string             `json:"api-name"`
 	ApiVersion  *versionJSON       `json:"api-version"`
 	ApiPort     int                `json:"api-port"`
 	SenderUUID  string             `json:"sender-uuid"`
 	Environment apireg.Environment `json:"env"`
+	State       apireg.ApiState    `json:"state,omitempty"`
+	//Seq goes up by one for every message a sender sends so that receivers can tell when messages are being lost
+	Seq uint64 `json:"seq,omitempty"`
+	//Token proves the sender is allowed to announce ApiName to registries that require admission tokens
+	Token string `json:"token,omitempty"`
+	//SnapshotPort is the tcp port the sender serves snapshots of everything it knows on
+	SnapshotPort int `json:"snapshot-port,omitempty"`
+	//AgentVersion of the registry that sent the message
+	AgentVersion string `json:"agent-version,omitempty"`
+	//ConfigDigest of the registry that sent the message, nodes with the same one are configured alike
+	ConfigDigest string `json:"config-digest,omitempty"`
+	//UnicastPort is the udp port the sender can be reached on directly for pings and echoes
+	UnicastPort int `json:"unicast-port,omitempty"`
+	//Nonce ties a pong to the ping it answers
+	Nonce uint64 `json:"nonce,omitempty"`
+	//Change is set on announcements of a registration, drain or withdrawal that the sender wants echoed back once applied
+	Change uint64 `json:"change,omitempty"`
+	//Digests of what the sender tracks from each sender by their UUID, only set on digests
+	Digests map[string]uint64 `json:"digests,omitempty"`
+	//Tags the api was registered with
+	Tags map[string]string `json:"tags,omitempty"`
+	//Deprecated is set when the api was registered as deprecated
+	Deprecated bool `json:"deprecated,omitempty"`
+	//Sunset is when a deprecated api is going away in unix seconds, 0 for no date
+	Sunset int64 `json:"sunset,omitempty"`
+	//Canary is the percentage of traffic the api wants as a canary, 0 if it isn't one
+	Canary float64 `json:"canary,omitempty"`
+	//Color is the deployment the api belongs to, or on an active color message the color being made active
+	Color string `json:"color,omitempty"`
+	//ColorSetAt is when the active color was set in unix nanoseconds, only set on active color messages
+	ColorSetAt int64 `json:"color-set-at,omitempty"`
+	//Endpoints the api can be reached on besides the default one on ApiPort
+	Endpoints []endpointJSON `json:"endpoints,omitempty"`
+	//Fragment is the piece of a bigger message a fragment message carries
+	Fragment *fragmentJSON `json:"fragment,omitempty"`
+}
+
+// endpointJSON is an apireg.Endpoint on the wire, kept short as every endpoint takes up room in the datagram
+type endpointJSON struct {
+	Name     string `json:"name"`
+	Protocol string `json:"proto,omitempty"`
+	Port     int    `json:"port"`
+	Path     string `json:"path,omitempty"`
+}
+
+// newEndpointsJSON leaves out the default endpoint an Api lists when it wasn't given one on port as it is implied by ApiPort
+func newEndpointsJSON(eps []apireg.Endpoint, port int) []endpointJSON {
+	var endpoints []endpointJSON
+	for _, curEndpoint := range eps {
+		if curEndpoint == (apireg.Endpoint{Name: apireg.DefaultEndpointName, Port: port}) {
+			continue
+		}
+		endpoints = append(endpoints, endpointJSON{Name: curEndpoint.Name, Protocol: curEndpoint.Protocol, Port: curEndpoint.Port, Path: curEndpoint.Path})
+	}
+	return endpoints
+}
+
+func (this *apiRegisterMessageJSON) endpoints() []apireg.Endpoint {
+	eps := make([]apireg.Endpoint, 0, len(this.Endpoints))
+	for _, curEndpoint := range this.Endpoints {
+		eps = append(eps, apireg.Endpoint{Name: curEndpoint.Name, Protocol: curEndpoint.Protocol, Port: curEndpoint.Port, Path: curEndpoint.Path})
+	}
+	return eps
+}
+
+// setMetadata puts what an owned api was registered with, other than its state, on the message
+func (this *apiRegisterMessageJSON) setMetadata(opts *apireg.RegisterOptions) {
+	this.Tags = opts.Tags
+	this.setDeprecation(opts.Deprecated, opts.Sunset)
+	this.Canary = opts.CanaryPercent
+	this.Color = opts.Color
+	this.Endpoints = newEndpointsJSON(opts.Endpoints, this.ApiPort)
+}
+
+// setApiMetadata puts what a tracked api was announced with, other than its state, on the message
+func (this *apiRegisterMessageJSON) setApiMetadata(a apireg.Api) {
+	this.Tags = a.Tags()
+	this.setDeprecation(a.Deprecated(), a.Sunset())
+	this.Canary = a.CanaryPercent()
+	this.Color = a.Color()
+	this.Endpoints = newEndpointsJSON(a.Endpoints(), a.HostPort())
+}
+
+func (this *apiRegisterMessageJSON) setDeprecation(deprecated bool, sunset time.Time) {
+	this.Deprecated = deprecated
+	if deprecated && !sunset.IsZero() {
+		this.Sunset = sunset.Unix()
+	}
+}
+
+// apiOptions are the options of the Api the message announces that come from the message itself
+func (this *apiRegisterMessageJSON) apiOptions() []apireg.ApiOption {
+	opts := []apireg.ApiOption{apireg.WithState(messageState(this)), apireg.WithApiTags(this.Tags)}
+	if this.Deprecated {
+		sunset := time.Time{}
+		if this.Sunset != 0 {
+			sunset = time.Unix(this.Sunset, 0)
+		}
+		opts = append(opts, apireg.WithApiDeprecation(sunset))
+	}
+	if this.Canary > 0 {
+		opts = append(opts, apireg.WithApiCanary(this.Canary))
+	}
+	if this.Color != "" {
+		opts = append(opts, apireg.WithApiColor(this.Color))
+	}
+	if len(this.Endpoints) > 0 {
+		opts = append(opts, apireg.WithApiEndpoints(this.endpoints()))
+	}
+	return opts
 }
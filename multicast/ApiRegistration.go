@@ -10,9 +10,14 @@ import (
 
 type apiRegistration struct {
 	api                 apireg.Api
+	apiMutex            sync.RWMutex
 	timeRegistered      time.Time
 	timeRegisteredMutex sync.Mutex
 	lifeSpan            time.Duration
+	//The timeRegistered that an expiring soon warning was last given for, so one is given once per missed refresh
+	warnedFor time.Time
+	//Sequence number of the latest message applied to the registration, 0 if none was sequenced
+	seq uint64
 }
 
 func newApiRegistration(api apireg.Api, timeReged time.Time, lifeSpan time.Duration) (*apiRegistration, error) {
@@ -24,9 +29,37 @@ func newApiRegistration(api apireg.Api, timeReged time.Time, lifeSpan time.Durat
 }
 
 func (this *apiRegistration) Api() apireg.Api {
+	this.apiMutex.RLock()
+	defer this.apiMutex.RUnlock()
 	return this.api
 }
+
+func (this *apiRegistration) UpdateApi(newApi apireg.Api) {
+	this.apiMutex.Lock()
+	this.api = newApi
+	this.apiMutex.Unlock()
+}
+
+// Regressed returns true if seq is older than the latest message applied to the registration without being far enough
+// back to be its sender having restarted, meaning it was delayed or duplicated on its way to us
+func (this *apiRegistration) Regressed(seq uint64) bool {
+	this.apiMutex.RLock()
+	defer this.apiMutex.RUnlock()
+	return seq != 0 && seq < this.seq && this.seq-seq <= maxSequenceGap
+}
+
+// ObserveSeq records that a message with seq was applied to the registration
+func (this *apiRegistration) ObserveSeq(seq uint64) {
+	this.apiMutex.Lock()
+	if seq > this.seq || this.seq-seq > maxSequenceGap {
+		this.seq = seq
+	}
+	this.apiMutex.Unlock()
+}
+
 func (this *apiRegistration) TimeRegistered() time.Time {
+	this.timeRegisteredMutex.Lock()
+	defer this.timeRegisteredMutex.Unlock()
 	return this.timeRegistered
 }
 
@@ -39,6 +72,21 @@ func (this *apiRegistration) UpdateTimeRegistered(newTime time.Time) {
 func (this *apiRegistration) LifeSpan() time.Duration {
 	return this.lifeSpan
 }
+
+// WarnExpiring returns true if the registration expires within threshold of t and it hasn't been warned about since it
+// was last refreshed
+func (this *apiRegistration) WarnExpiring(t time.Time, threshold time.Duration) bool {
+	this.timeRegisteredMutex.Lock()
+	defer this.timeRegisteredMutex.Unlock()
+	expires := this.timeRegistered.Add(this.lifeSpan)
+
+	if this.warnedFor.Equal(this.timeRegistered) || expires.Before(t) || expires.Sub(t) >= threshold {
+		return false
+	}
+	this.warnedFor = this.timeRegistered
+	return true
+}
+
 func (this *apiRegistration) Expired(otherTime time.Time) bool {
-	return this.timeRegistered.Add(this.lifeSpan).Before(otherTime)
+	return this.TimeRegistered().Add(this.lifeSpan).Before(otherTime)
 }
@@ -61,7 +61,39 @@ func TestThatRegistrationIsNotExpiredIfTimePassedInMoreThanRegTimePlusLife(t *te
 	}
 }
 
+func TestThatRegistrationIsWarnedAboutOncePerRefresh(t *testing.T) {
+	now := time.Now()
+	life := time.Second * 30
+	reg, _ := newApiRegistration(getValidApi(), now, life)
+
+	if reg.WarnExpiring(now, time.Second*10) || !reg.WarnExpiring(now.Add(time.Second*25), time.Second*10) ||
+		reg.WarnExpiring(now.Add(time.Second*26), time.Second*10) {
+		t.FailNow()
+	}
+	reg.UpdateTimeRegistered(now.Add(time.Second * 26))
+	if !reg.WarnExpiring(now.Add(time.Second*50), time.Second*10) {
+		t.Fail()
+	}
+}
+
 func getValidApi() apireg.Api {
 	api, _ := apireg.NewApi("someApi", apireg.NewVersion(0, 0, 0), uuid.New(), apireg.All, net.IPv4(192, 168, 0, 3), 8080)
 	return api
 }
+
+func TestThatOlderSequenceIsRegressed(t *testing.T) {
+	reg, _ := newApiRegistration(getValidApi(), time.Now(), registrationLifeSpan)
+
+	if reg.Regressed(5) {
+		t.Fail()
+	}
+	reg.ObserveSeq(5)
+	if !reg.Regressed(4) || reg.Regressed(6) || reg.Regressed(0) {
+		t.Fail()
+	}
+	//Far enough back is a restart rather than a late message
+	reg.ObserveSeq(500)
+	if reg.Regressed(1) {
+		t.Fail()
+	}
+}
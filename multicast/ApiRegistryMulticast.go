@@ -2,11 +2,17 @@ package multicast
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/ZacharyDuve/apireg"
@@ -14,144 +20,648 @@ import (
 )
 
 const (
-	DEFAULT_MULTICAST_GROUP_IP   string        = "224.0.0.78"
-	DEFAULT_MULTICAST_GROUP_PORT int           = 5324
-	registrationMessageSizeBytes int           = 1400
-	registrationLifeSpan         time.Duration = registrationUpdateInterval * 4
-	registrationUpdateInterval   time.Duration = time.Second * 15
-	registrationPurgeInterval    time.Duration = time.Second * 30
+	DEFAULT_MULTICAST_GROUP_IP   string = "224.0.0.78"
+	DEFAULT_MULTICAST_GROUP_PORT int    = 5324
+	registrationMessageSizeBytes int    = 1400
+	//Largest payload a udp datagram can carry over ipv4
+	maxDatagramSizeBytes       int           = 65507
+	registrationLifeSpan       time.Duration = registrationUpdateInterval * 4
+	registrationUpdateInterval time.Duration = time.Second * 15
+	registrationPurgeInterval  time.Duration = time.Second * 30
+	errorsBufferSize           int           = 64
+	//AGENT_VERSION is sent with every message so that operators can tell which versions are taking part, see ListPeers
+	AGENT_VERSION string = "0.1.0"
 )
 
-type ownedApi struct {
-	name    string
-	version apireg.Version
-	port    int
-}
-
 type multicastApiRegistry struct {
 	mAddr *net.UDPAddr
-	mConn *net.UDPConn
+	//How the group is joined and written to, a real multicast group unless WithBroker is used
+	transport transport
+	//Every group we listen on, the first being the one we announce on
+	groups           []*groupMembership
+	additionalGroups []*net.UDPAddr
+	//Only set when control traffic has a group of its own
+	controlAddr  *net.UDPAddr
+	controlGroup *groupMembership
+	//Handlers for every type of control message, which never make it to the announcement handling
+	controlHandlers map[messageType]controlHandler
 	//Need to save all of the apis that have been registered externally
 	apiRegs *syncApiRegStore
 	//Need to know which api registrations are ours so that due to multicast we can double check
-	ownedApis          *syncApiStore
-	purgeExpiredTicker *time.Ticker
-	id                 uuid.UUID
-	environment        apireg.Environment
+	ownedApis *syncApiStore
+	//Every other registry node we have heard from
+	peers       *syncPeerStore
+	id          uuid.UUID
+	environment apireg.Environment
+	//Cancels the context the registry is running under, set once Run has been called
+	cancelRun context.CancelCauseFunc
+	running   bool
+	runDone   chan struct{}
+	runMutex  sync.Mutex
+	errs      chan error
+	//Largest datagram we read, anything bigger is dropped as truncated
+	receiveBufferSize int
+	//Only set by WithMTU, otherwise the MTU comes from the transport
+	mtu int
+	//Largest datagram we send, anything bigger is split into fragments
+	maxPayload int
+	//Short hash of the config that has to match across the group, see describeConfig
+	configDigest string
+	//Fragments of messages from others that are still waiting on the rest
+	fragments *syncFragmentStore
+	//Settled once we have heard what peers had when we started
+	initialSync *initialSync
+	//Called with the payload of any message that panics while being handled
+	crashHandler CrashHandler
+	//Sequence number of the last message we sent
+	seq uint64
+	//Id of the last message we split into fragments
+	fragmentSeq uint64
+	//What messages go through on their way on and off the wire, built from signing and encryption
+	codec      codec
+	signing    codec
+	encryption codec
+	//Whether messages that fail signature checks are dropped or only counted
+	signingEnforcement SigningEnforcement
+	unverified         *syncUnverifiedSources
+	//Token sent with owned apis that don't have their own
+	defaultToken string
+	//Only set when announcements have to carry a valid token
+	admissionTokens *admissionTokens
+	//Only set when publishers are limited in which names they can announce
+	publisherPolicy *publisherPolicy
+	//Run in order on every announcement before it is tracked
+	admissionHooks []AdmissionHook
+	//Only set when conflicting announcements are resolved rather than all tracked
+	conflictResolver ConflictResolver
+	//Only set when we serve snapshots of what we know over tcp, nil config meaning plain tcp
+	snapshotAddr     string
+	snapshotTLS      *tls.Config
+	snapshotListener net.Listener
+	//Only set when we fetch a snapshot from the first peer that serves them, nil config meaning plain tcp
+	bootstrapEnabled bool
+	bootstrapTLS     *tls.Config
+	bootstrapped     uint32
+	//Only set when pinging peers
+	pingInterval time.Duration
+	//Only set when measuring how long our changes take to reach everyone
+	convergence *syncConvergenceTracker
+	//Only set when resends that peers don't need are skipped
+	knownAnswers *syncKnownAnswers
+	//Set when answers to our queries should come straight to us
+	nameQueries bool
+	//Limits how many queries are being answered at once as answering runs health checks
+	queryAnswers chan struct{}
+	//Only set when alarming on registrations being added and expiring too fast
+	churn *syncChurnTracker
+	//Only set when warning about registrations that are close to expiring
+	expiryWarning time.Duration
+	//Only set when every change is written out for conformance testing, subscribed from the start so nothing is missed
+	conformanceEvents  apireg.Subscription
+	conformanceEncoder *json.Encoder
+	//Only set when the registry registers itself as SelfApiName
+	selfRegistrationPort int
+	//Only set when names are normalized before they are used
+	nameNormalizer NameNormalizer
+	//Active deployment color of each name that has one, apis of any other color are hidden
+	activeColors *syncActiveColors
+	//Changes of critical apis that still have to be sent again
+	bursts *syncBurstQueue
+	//Number of heartbeats owned apis have been resent for, only used by the resend loop
+	resendCycle uint64
+	//Only set when peers need to reach us directly for pings or echoes
+	unicastConn *net.UDPConn
+	//Only set when peer channels require mutual TLS
+	nodeCert  *tls.Certificate
+	nodeRoots *x509.CertPool
+	//Only set when the outbound traffic is limited, in which case messages are queued until the budget allows them
+	budget      *sendBudget
+	outbound    *syncSendQueue
+	loss        *syncLossTracker
+	reflections *syncReflectionTracker
+	heartbeat   *heartbeat
+	metrics     *syncMetricStore
 }
 
-func NewMulticastRegistry(lAddr *net.UDPAddr, e apireg.Environment, sId uuid.UUID) (apireg.ApiRegistry, error) {
+// NewMulticastRegistry creates a registry that is already running in the background until Close is called
+func NewMulticastRegistry(lAddr *net.UDPAddr, e apireg.Environment, sId uuid.UUID, opts ...Option) (apireg.ApiRegistry, error) {
+	r, err := newMulticastApiRegistry(lAddr, e, sId, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := r.Run(context.Background())
+		if err != nil {
+			log.Println("Multicast registry stopped", err)
+		}
+	}()
+	return r, nil
+}
+
+// NewRunnableMulticastRegistry creates a registry that doesn't listen for or resend registrations until Run is called
+func NewRunnableMulticastRegistry(lAddr *net.UDPAddr, e apireg.Environment, sId uuid.UUID, opts ...Option) (apireg.RunnableApiRegistry, error) {
+	return newMulticastApiRegistry(lAddr, e, sId, opts...)
+}
+
+func newMulticastApiRegistry(lAddr *net.UDPAddr, e apireg.Environment, sId uuid.UUID, opts ...Option) (*multicastApiRegistry, error) {
 	//If we are not passed in a lAddr then lets set to defaults
 	if lAddr == nil {
 		lAddr = &net.UDPAddr{IP: net.ParseIP(DEFAULT_MULTICAST_GROUP_IP), Port: DEFAULT_MULTICAST_GROUP_PORT}
 	}
 
 	r := &multicastApiRegistry{}
-	r.purgeExpiredTicker = time.NewTicker(registrationPurgeInterval)
-	r.apiRegs = newSyncApiRegistrationStore(r.purgeExpiredTicker.C)
+	//The registry runs the purging itself so that it stops along with everything else
+	r.apiRegs = newSyncApiRegistrationStore(nil)
 	r.id = sId
 	r.environment = e
 	r.mAddr = lAddr
+	r.transport = &udpMulticastTransport{addr: lAddr}
+	r.runDone = make(chan struct{})
+	r.errs = make(chan error, errorsBufferSize)
+	r.metrics = newSyncMetricStore()
+	r.loss = newSyncLossTracker()
+	r.reflections = newSyncReflectionTracker()
+	r.heartbeat = newHeartbeat(registrationUpdateInterval, defaultMinHeartbeatInterval, defaultMaxHeartbeatInterval)
 
 	r.ownedApis = newSyncApiStore()
+	r.peers = newSyncPeerStore()
+	r.controlHandlers = make(map[messageType]controlHandler)
+	r.bursts = newSyncBurstQueue()
+	r.fragments = newSyncFragmentStore()
+	r.queryAnswers = make(chan struct{}, maxConcurrentQueryAnswers)
+	r.controlHandlers[queryMessage] = r.handleQuery
+	r.activeColors = newSyncActiveColors()
+	r.controlHandlers[activeColorMessage] = r.handleActiveColor
+	r.controlHandlers[syncMessage] = r.handleSync
+	r.initialSync = newInitialSync()
+	r.signingEnforcement = EnforceSignatures
+	r.unverified = newSyncUnverifiedSources()
+	r.apiRegs.visibility = r.activeColors.Visible
+	//Reads drop expired apis as they come across them too, so expiries are counted wherever they are noticed
+	r.apiRegs.onExpire = func(a apireg.Api) {
+		r.observeChurn(a, "expire")
+	}
 
-	mC, err := net.ListenMulticastUDP("udp", nil, lAddr)
+	for _, curOpt := range opts {
+		err := curOpt(r)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.signingEnforcement == VerifyAndLog && r.signing == nil {
+		return nil, errors.New("WithSigningEnforcement(VerifyAndLog) needs WithSigningKeys")
+	}
+	r.codec = r.buildCodec()
+	if err := r.sizeMessages(); err != nil {
+		return nil, err
+	}
+	r.configDigest = r.digestConfig()
+	r.metrics.Set("apireg_config_info", "Always 1, labelled with the agent version and config digest of the registry to compare against ListPeers",
+		map[string]string{"agent_version": AGENT_VERSION, "config_digest": r.configDigest}, 1)
+
+	//Options like WithClusterName can have moved us to another group
+	r.groups = []*groupMembership{newGroupMembership(r.mAddr.String(), r.transport)}
+	for _, curGroup := range r.additionalGroups {
+		udpTransport, isUDP := r.transport.(*udpMulticastTransport)
+		if !isUDP {
+			return nil, errors.New("WithAdditionalGroups only applies to multicast groups and can't be used along with WithBroker")
+		}
+		r.groups = append(r.groups, newGroupMembership(curGroup.String(), &udpMulticastTransport{addr: curGroup, reuse: udpTransport.reuse}))
+	}
+
+	//Open the connections up front so that the caller finds out right away if we can't listen
+	var err error
+	for _, curGroup := range r.groups {
+		if _, err = curGroup.Conn(); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = r.joinControlGroup()
+	}
+	if err == nil {
+		err = r.listenSnapshots()
+	}
 
+	if err == nil {
+		err = r.listenUnicast()
+	}
+	if err == nil {
+		err = r.registerSelf()
+	}
 	if err != nil {
+		r.closeMulticastConn()
+		r.closeSnapshotListener()
 		return nil, err
 	}
-	r.mConn = mC
 
-	go r.listenMutlicast()
-	go r.resendOwnedRegistrationsLoop()
 	return r, nil
 }
 
-func (this *multicastApiRegistry) RegisterApi(name string, version apireg.Version, port int) error {
-	if name == "" {
-		return errors.New("name was empty and name is a required parameter")
+func (this *multicastApiRegistry) Run(ctx context.Context) error {
+	this.runMutex.Lock()
+	if this.running {
+		this.runMutex.Unlock()
+		return errors.New("Run has already been called for this registry")
 	}
-	//We just set a bogus ip as listeners don't get this ip but from the actual packet
-	localApi, err := apireg.NewApi(name, version, this.id, this.environment, net.ParseIP("0.0.0.0"), port)
+	this.running = true
+	ctx, this.cancelRun = context.WithCancelCause(ctx)
+	this.runMutex.Unlock()
+	defer close(this.runDone)
+
+	loopsDone := &sync.WaitGroup{}
+	loops := map[string]func(context.Context) error{
+		"listen":   this.listenLoop(this.groups[0]),
+		"resend":   this.resendOwnedRegistrationsLoop,
+		"purge":    this.purgeExpiredLoop,
+		"burst":    this.burstLoop,
+		"send":     this.budgetedSendLoop,
+		"snapshot": this.serveSnapshotsLoop,
+		"ping":     this.pingLoop,
+		"unicast":  this.unicastListenLoop,
+		"expiry":   this.expiryWarningLoop,
+		"sync":     this.initialSyncLoop,
+		"conform":  this.conformanceOutputLoop,
+	}
+	for _, curGroup := range this.groups[1:] {
+		loops["listen "+curGroup.name] = this.listenLoop(curGroup)
+	}
+	if this.controlGroup != nil {
+		loops["control"] = this.listenLoop(this.controlGroup)
+	}
+	for curName, curLoop := range loops {
+		if (curName == "send" && this.budget == nil) || (curName == "snapshot" && this.snapshotListener == nil) ||
+			(curName == "ping" && this.pingInterval == 0) || (curName == "unicast" && this.unicastConn == nil) ||
+			(curName == "expiry" && this.expiryWarning == 0) || (curName == "conform" && this.conformanceEvents == nil) {
+			continue
+		}
+		loopsDone.Add(1)
+		go func(name string, loop func(context.Context) error) {
+			this.supervise(ctx, name, loop)
+			loopsDone.Done()
+		}(curName, curLoop)
+	}
+
+	<-ctx.Done()
+	//Closing the connections is what knocks the listeners out of their blocking reads
+	this.closeMulticastConn()
+	this.closeSnapshotListener()
+	this.closeUnicastConn()
+	loopsDone.Wait()
+	this.withdrawOwnedApis()
+	this.flushOutbound()
+
+	//Being closed is a normal way to stop so only report the parent context being cancelled
+	if context.Cause(ctx) == errRegistryClosed {
+		return nil
+	}
+	return ctx.Err()
+}
+
+var errRegistryClosed = errors.New("registry closed")
+
+func (this *multicastApiRegistry) Close() error {
+	this.runMutex.Lock()
+	running := this.running
+	cancel := this.cancelRun
+	this.runMutex.Unlock()
+
+	if !running {
+		this.withdrawOwnedApis()
+		this.flushOutbound()
+		this.closeMulticastConn()
+		this.closeSnapshotListener()
+		this.closeUnicastConn()
+		return nil
+	}
+	cancel(errRegistryClosed)
+	<-this.runDone
+	return nil
+}
+
+// Let everyone know right away that we are gone instead of having them wait for our registrations to expire
+func (this *multicastApiRegistry) withdrawOwnedApis() {
+	for _, curOwnedApi := range this.ownedApis.All() {
+		//Not worth tracking as we won't be around to hear it echoed
+		this.sendApiMessage(withdrawMessage, curOwnedApi, curOwnedApi.(*ownedApi).opts, false)
+		this.ownedApis.Remove(curOwnedApi)
+	}
+}
+
+func (this *multicastApiRegistry) RegisterApi(name string, version apireg.Version, port int, opts ...apireg.RegisterOption) error {
+	localApi, err := this.newLocalApi(name, version, port)
 
 	if err != nil {
 		return err
 	}
-	//If we already know that we have registered this api from us then don't re-register it
-	if this.ownedApis.Contains(localApi) {
-		return nil
+	newOwned := newOwnedApi(localApi, apireg.NewRegisterOptions(opts...))
+	if err := checkEndpoints(newOwned.opts.Endpoints); err != nil {
+		return err
+	}
+	//If we already know that we have registered this api from us then don't re-register it unless it was draining
+	if existing, owned := this.ownedApis.Get(localApi); owned {
+		if existing.State() == apireg.Serving {
+			return nil
+		}
+		return this.replaceOwnedApi(existing, newOwned)
 	}
 
-	err = this.sendApiRegistration(localApi)
+	err = this.announceOwnedApi(context.Background(), newOwned, true)
 
 	if err == nil {
-		this.ownedApis.Add(localApi)
+		this.ownedApis.Add(newOwned)
 	}
 	return err
 }
 
-func (this *multicastApiRegistry) sendApiRegistration(a apireg.Api) error {
-	conn, err := net.DialUDP("udp", nil, this.mAddr)
+func (this *multicastApiRegistry) DrainApi(name string, version apireg.Version, port int) error {
+	existing, err := this.getOwnedApi(name, version, port)
 
 	if err != nil {
 		return err
 	}
+	if existing.State() == apireg.Draining {
+		return nil
+	}
 
-	message := &apiRegisterMessageJSON{
-		ApiName:     a.Name(),
-		ApiVersion:  &versionJSON{Major: a.Version().Major(), Minor: a.Version().Minor(), BugFix: a.Version().BugFix()},
-		ApiPort:     a.HostPort(),
-		SenderUUID:  this.id.String(),
-		Environment: this.environment}
+	drainingApi, err := existing.withState(apireg.Draining)
 
-	dataOut := bytes.NewBuffer(make([]byte, 0, registrationMessageSizeBytes))
+	if err != nil {
+		return err
+	}
+	return this.replaceOwnedApi(existing, drainingApi)
+}
 
-	err = json.NewEncoder(dataOut).Encode(message)
+func (this *multicastApiRegistry) DeregisterApi(name string, version apireg.Version, port int) error {
+	existing, err := this.getOwnedApi(name, version, port)
 
 	if err != nil {
 		return err
 	}
+	//Remove first so that the resend loop doesn't announce it again right after we withdraw it
+	this.ownedApis.Remove(existing)
 
-	if dataOut.Len() > registrationMessageSizeBytes {
-		return errors.New(fmt.Sprint("Message size for", a.Name(), a.Version(), "exceeds max length of", registrationMessageSizeBytes, "bytes"))
+	return this.sendApiMessage(withdrawMessage, existing, existing.opts, true)
+}
+
+func (this *multicastApiRegistry) ForceAnnounce(name string) error {
+	found := false
+	var err error
+
+	normalized := this.normalizeName(name)
+	for _, curOwned := range this.ownedApis.All() {
+		if curOwned.Name() != normalized {
+			continue
+		}
+		found = true
+		if announceErr := this.announceOwnedApi(context.Background(), curOwned.(*ownedApi), true); announceErr != nil {
+			err = announceErr
+		}
+	}
+	if !found {
+		return errors.New(fmt.Sprint("No api ", name, " has been registered by this registry"))
 	}
+	return err
+}
 
-	_, err = conn.Write(dataOut.Bytes())
+func (this *multicastApiRegistry) ForceAnnounceAll() error {
+	var err error
 
+	for _, curOwned := range this.ownedApis.All() {
+		//Keep going so one api that can't be sent doesn't hold up the rest
+		if announceErr := this.announceOwnedApi(context.Background(), curOwned.(*ownedApi), true); announceErr != nil {
+			err = announceErr
+		}
+	}
 	return err
 }
 
-func (this *multicastApiRegistry) resendOwnedRegistrationsLoop() {
-	updateTicker := time.NewTicker(registrationUpdateInterval)
-	for range updateTicker.C {
-		this.processRegResends()
+func (this *multicastApiRegistry) newLocalApi(name string, version apireg.Version, port int) (apireg.Api, error) {
+	if name == "" {
+		return nil, errors.New("name was empty and name is a required parameter")
+	}
+	name = this.normalizeName(name)
+	//We just set a bogus ip as listeners don't get this ip but from the actual packet
+	return apireg.NewApi(name, version, this.id, this.environment, net.ParseIP("0.0.0.0"), port)
+}
+
+// checkEndpoints returns an error if eps can't all be told apart or reached
+func checkEndpoints(eps []apireg.Endpoint) error {
+	names := make(map[string]bool, len(eps))
+	for _, curEndpoint := range eps {
+		if curEndpoint.Name == "" {
+			return errors.New("every endpoint needs a name for RegisterApi")
+		} else if curEndpoint.Port <= 0 || curEndpoint.Port > 65535 {
+			return errors.New(fmt.Sprint("port of endpoint ", curEndpoint.Name, " must be a valid port for RegisterApi"))
+		} else if names[curEndpoint.Name] {
+			return errors.New(fmt.Sprint("endpoint ", curEndpoint.Name, " was given more than once for RegisterApi"))
+		}
+		names[curEndpoint.Name] = true
 	}
+	return nil
 }
 
-func (this *multicastApiRegistry) processRegResends() {
-	for _, curOwnedApi := range this.ownedApis.All() {
-		this.sendApiRegistration(curOwnedApi)
+func (this *multicastApiRegistry) getOwnedApi(name string, version apireg.Version, port int) (*ownedApi, error) {
+	localApi, err := this.newLocalApi(name, version, port)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existing, owned := this.ownedApis.Get(localApi)
+
+	if !owned {
+		return nil, errors.New(fmt.Sprint("No api ", name, " ", version, " on port ", port, " has been registered by this registry"))
+	}
+	return existing.(*ownedApi), nil
+}
+
+func (this *multicastApiRegistry) replaceOwnedApi(old apireg.Api, new *ownedApi) error {
+	err := this.announceOwnedApi(context.Background(), new, true)
+
+	if err == nil {
+		this.ownedApis.Remove(old)
+		this.ownedApis.Add(new)
+	}
+	return err
+}
+
+// announceOwnedApi sends the registration for o as long as its health check allows it, isChange being false for repeats
+func (this *multicastApiRegistry) announceOwnedApi(ctx context.Context, o *ownedApi, isChange bool) error {
+	a, announce := this.checkOwnedApi(ctx, o)
+
+	if !announce {
+		return nil
+	}
+	return this.sendApiMessage(registerMessage, a, o.opts, isChange)
+}
+
+// resendOwnedApi is the heartbeat of o, resent every interval unless peers don't need it
+func (this *multicastApiRegistry) resendOwnedApi(ctx context.Context, o *ownedApi, interval time.Duration) error {
+	a, announce := this.checkOwnedApi(ctx, o)
+
+	if !announce || this.suppressResend(a, interval) {
+		return nil
+	}
+	return this.sendApiMessage(registerMessage, a, o.opts, false)
+}
+
+// checkOwnedApi runs the health check of o returning what should be announced for it if anything
+func (this *multicastApiRegistry) checkOwnedApi(ctx context.Context, o *ownedApi) (apireg.Api, bool) {
+	a, announce, healthErr := o.announceable(ctx)
+
+	if healthErr != nil {
+		this.metrics.Add("apireg_health_check_failures_total", "Number of times an owned api failed its health check before being announced", map[string]string{"api": o.Name()}, 1)
+	}
+	return a, announce
+}
+
+func (this *multicastApiRegistry) sendApiMessage(t messageType, a apireg.Api, opts *apireg.RegisterOptions, isChange bool) error {
+	message := this.newApiMessage(t, a, opts)
+	if isChange {
+		this.trackChange(message)
+		this.scheduleBurst(a, opts)
+	}
+	this.recordAnnouncement(t, a)
+
+	return this.send(apiKey(a), message)
+}
+
+// newApiMessage is the message of type t announcing a, one of our owned apis
+func (this *multicastApiRegistry) newApiMessage(t messageType, a apireg.Api, opts *apireg.RegisterOptions) *apiRegisterMessageJSON {
+	token := opts.Token
+	if token == "" {
+		token = this.defaultToken
+	}
+
+	message := &apiRegisterMessageJSON{
+		Type:         t,
+		ApiName:      a.Name(),
+		ApiVersion:   &versionJSON{Major: a.Version().Major(), Minor: a.Version().Minor(), BugFix: a.Version().BugFix()},
+		ApiPort:      a.HostPort(),
+		SenderUUID:   this.id.String(),
+		Environment:  this.environment,
+		State:        a.State(),
+		Token:        token,
+		SnapshotPort: this.snapshotPort(),
+		AgentVersion: AGENT_VERSION,
+		ConfigDigest: this.configDigest,
+		UnicastPort:  this.unicastPort()}
+	message.setMetadata(opts)
+	return message
+}
+
+func (this *multicastApiRegistry) resendOwnedRegistrationsLoop(ctx context.Context) error {
+	for this.processRegResends(ctx, this.heartbeat.Interval()) {
+		this.sendDigests()
+		this.sendActiveColors()
+		this.adjustHeartbeat()
+	}
+	return nil
+}
+
+// adjustHeartbeat adapts how often we resend to whether peers have shown they have what we announced since the last resend.
+// Without anything from them about our own announcements it stays where it is
+func (this *multicastApiRegistry) adjustHeartbeat() time.Duration {
+	interval := this.heartbeat.Interval()
+	if this.convergence != nil && len(this.processingPeers()) > 0 {
+		//A change that no peer has echoed within a heartbeat most likely didn't reach them
+		this.reflections.Unreflected(this.convergence.TakeUnechoed(time.Now().Add(-interval)))
+	}
+	if unreflected, signalled := this.reflections.TakeUnreflectedRatio(); signalled {
+		interval = this.heartbeat.Adjust(unreflected)
+		this.metrics.Set("apireg_unreflected_ratio", "Ratio of digests and echoes from peers during the last heartbeat interval that showed them missing what we announced", nil, unreflected)
+	}
+	this.metrics.Set("apireg_heartbeat_interval_seconds", "Current interval owned registrations are resent at", nil, interval.Seconds())
+
+	return interval
+}
+
+func (this *multicastApiRegistry) purgeExpiredLoop(ctx context.Context) error {
+	purgeTicker := time.NewTicker(registrationPurgeInterval)
+	defer purgeTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-purgeTicker.C:
+			this.apiRegs.purgeExpired(t)
+			//A peer that has been quiet for as long as a registration lives has most likely gone away
+			for _, curID := range this.peers.PurgeSilent(t.Add(-registrationLifeSpan)) {
+				this.loss.Forget(curID.String())
+			}
+			if this.convergence != nil {
+				this.convergence.PurgeBefore(t.Add(-registrationLifeSpan))
+			}
+		}
+	}
+}
+
+// processRegResends announces every owned api once, spread evenly across interval so that a registry owning a lot of apis
+// doesn't send them all in one burst. Returns false if ctx was done before it finished
+func (this *multicastApiRegistry) processRegResends(ctx context.Context, interval time.Duration) bool {
+	cycleStart := time.Now()
+	this.startResendCycle(interval)
+	schedule := resendSchedule(this.ownedApis.All(), this.resendCycle, interval)
+	this.resendCycle++
+
+	if len(schedule) == 0 {
+		return sleepUntil(ctx, cycleStart.Add(interval))
+	}
+
+	spacing := interval / time.Duration(len(schedule))
+	for i, curOwnedApi := range schedule {
+		if !sleepUntil(ctx, cycleStart.Add(spacing*time.Duration(i+1))) {
+			return false
+		}
+		//It could have been drained or deregistered while we were waiting for its turn
+		if current, stillOwned := this.ownedApis.Get(curOwnedApi); stillOwned {
+			o := current.(*ownedApi)
+			this.resendOwnedApi(ctx, o, resendInterval(o.opts.Priority, interval))
+		}
+	}
+	return true
+}
+
+// sleepUntil returns true once t has been reached or false if ctx was done first
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
 func (this *multicastApiRegistry) GetAvailableApis() []apireg.Api {
 	allRegs := this.apiRegs.GetAllRegs()
-	allApis := make([]apireg.Api, len(allRegs))
-	for i, curReg := range allRegs {
-		allApis[i] = curReg.Api()
+	allApis := make([]apireg.Api, 0, len(allRegs))
+	for _, curReg := range allRegs {
+		if this.activeColors.Visible(curReg.Api()) {
+			allApis = append(allApis, curReg.Api())
+		}
 	}
 
 	return allApis
 }
 
 func (this *multicastApiRegistry) GetApisByApiName(name string) []apireg.Api {
-	regs := this.apiRegs.GetAllRegsForName(name)
-	apis := make([]apireg.Api, len(regs))
+	return this.apiRegs.ApisForName(this.normalizeName(name), time.Now())
+}
 
-	for i, curReg := range regs {
-		apis[i] = curReg.Api()
-	}
-	return apis
+func (this *multicastApiRegistry) AppendApisByApiName(dst []apireg.Api, name string) []apireg.Api {
+	return append(dst, this.apiRegs.ApisForName(this.normalizeName(name), time.Now())...)
+}
+
+func (this *multicastApiRegistry) GetApisByNamePattern(pattern string) ([]apireg.Api, error) {
+	return this.apiRegs.ApisForPattern(this.normalizePattern(pattern), time.Now())
 }
 
 func (this *multicastApiRegistry) AddEventListener(l apireg.RegistrationListener) {
@@ -162,34 +672,208 @@ func (this *multicastApiRegistry) RemoveEventListener(l apireg.RegistrationListe
 	this.apiRegs.RemoveListener(l)
 }
 
-func (this *multicastApiRegistry) listenMutlicast() {
-	readBuff := make([]byte, registrationMessageSizeBytes)
-	for {
-		nRead, rAddr, err := this.mConn.ReadFromUDP(readBuff)
+func (this *multicastApiRegistry) Subscribe(opts ...apireg.SubscribeOption) (apireg.Subscription, error) {
+	sub, err := this.apiRegs.Subscribe(apireg.NewSubscribeOptions(opts...), func() {
+		this.metrics.Add("apireg_subscription_dropped_events_total", "Number of events dropped for subscribers that weren't keeping up", nil, 1)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (this *multicastApiRegistry) Errors() <-chan error {
+	return this.errs
+}
+
+func (this *multicastApiRegistry) GetApisByGroup(group string) []apireg.Api {
+	apis := make([]apireg.Api, 0)
+	for _, curReg := range this.apiRegs.GetAllRegs() {
+		if curReg.Api().Group() == group && this.activeColors.Visible(curReg.Api()) {
+			apis = append(apis, curReg.Api())
+		}
+	}
+
+	return apis
+}
+
+func (this *multicastApiRegistry) ListPeers() []apireg.Peer {
+	return this.peers.All()
+}
+
+func (this *multicastApiRegistry) Metrics() []apireg.Metric {
+	this.metrics.Set("apireg_peers", "Number of other registry nodes heard from recently", nil, float64(len(this.peers.All())))
+	this.metrics.Set("apireg_registrations", "Number of registrations currently being tracked", nil, float64(len(this.apiRegs.GetAllRegs())))
+	this.metrics.Set("apireg_owned_apis", "Number of apis registered by this registry", nil, float64(len(this.ownedApis.All())))
+	if this.outbound != nil {
+		this.metrics.Set("apireg_send_queue_length", "Number of messages waiting on the send budget", nil, float64(this.outbound.Len()))
+	}
+	return this.metrics.All()
+}
+
+// closeMulticastConn leaves every group for good
+func (this *multicastApiRegistry) closeMulticastConn() {
+	for _, curGroup := range this.groups {
+		curGroup.Close()
+	}
+	if this.controlGroup != nil {
+		this.controlGroup.Close()
+	}
+}
+
+func (this *multicastApiRegistry) listenLoop(g *groupMembership) func(context.Context) error {
+	return func(ctx context.Context) error {
+		conn, err := g.Conn()
+
 		if err != nil {
+			return err
+		}
+		err = this.listenMutlicast(ctx, conn, g.name)
+
+		if errors.Is(err, net.ErrClosed) {
+			//Throw away the dead connection so that the restarted loop joins the group again
+			g.Drop(conn)
+		}
+		return err
+	}
+}
+
+func (this *multicastApiRegistry) listenMutlicast(ctx context.Context, conn groupConn, group string) error {
+	//One byte more than we accept so that we can tell a datagram was cut off
+	readBuff := make([]byte, this.receiveBufferSize+1)
+	for {
+		nRead, rAddr, err := conn.ReadFromUDP(readBuff)
+		if ctx.Err() != nil {
+			//We are shutting down so the error is just from the connection being closed
+			return nil
+		} else if errors.Is(err, net.ErrClosed) {
+			return err
+		} else if err != nil {
 			log.Println("Error during multicast read", err)
+		} else if nRead > this.receiveBufferSize {
+			this.reportTruncated(rAddr)
 		} else {
-			message := &apiRegisterMessageJSON{}
-			err = json.NewDecoder(bytes.NewReader(readBuff[0:nRead])).Decode(message)
-			if err != nil {
-				log.Println("Error decoding multicast json", err)
-			} else {
-				ourIDAsString := this.id.String()
-				//If we got a message from ourselves or for another environment then ignore it
-				if message.SenderUUID == ourIDAsString || !shouldProcessMessage(this.environment, message.Environment) {
-					continue
-				}
-				var a apireg.Api
-				apiVersion := apireg.NewVersion(message.ApiVersion.Major, message.ApiVersion.Minor, message.ApiVersion.BugFix)
-				a, err = apireg.NewApi(message.ApiName, apiVersion, this.id, message.Environment, rAddr.IP, message.ApiPort)
-				if err != nil {
-					log.Println("Error generating new Api from message")
-				} else {
-					this.updateForApi(a)
-				}
+			this.handleMessageRecovered(readBuff[0:nRead], rAddr, group)
+		}
+	}
+}
+
+// reportTruncated lets whoever is reading Errors know a datagram from source was too big to read rather than leaving
+// them to figure it out from a decode error
+func (this *multicastApiRegistry) reportTruncated(source *net.UDPAddr) {
+	this.metrics.Add("apireg_truncated_messages_total", "Number of received datagrams dropped for being larger than the receive buffer", nil, 1)
+	this.reportError(errors.New(fmt.Sprint("dropped datagram from ", source, " larger than the receive buffer of ", this.receiveBufferSize, " bytes, see WithReceiveBufferSize")))
+}
+
+// handleMessageRecovered makes sure that a message which panics while being handled only costs us that one message
+func (this *multicastApiRegistry) handleMessageRecovered(payload []byte, rAddr *net.UDPAddr, group string) {
+	defer func() {
+		if r := recover(); r != nil {
+			this.metrics.Add("apireg_message_panics_total", "Number of received messages dropped because handling them panicked", nil, 1)
+			this.reportError(errors.New(fmt.Sprint("handling message from ", rAddr, " panicked: ", r)))
+			if this.crashHandler != nil {
+				//The read buffer is reused for the next message so give the handler its own copy
+				this.crashHandler(append([]byte{}, payload...), rAddr, r)
 			}
 		}
+	}()
+	this.handleMessage(payload, rAddr, group)
+}
+
+// handleMessage handles a message heard on group from rAddr
+func (this *multicastApiRegistry) handleMessage(data []byte, rAddr *net.UDPAddr, group string) {
+	payload, keyID, err := this.decode(data, rAddr)
+	if err != nil {
+		this.metrics.Add("apireg_decode_failures_total", "Number of received messages that could not be decoded", nil, 1)
+		log.Println("Error decoding message from", rAddr, err)
+		return
+	}
+	this.handlePayload(payload, keyID, rAddr, group)
+}
+
+// handlePayload handles the json of a message heard on group from rAddr, keyID being what it was signed with if anything
+func (this *multicastApiRegistry) handlePayload(payload []byte, keyID string, rAddr *net.UDPAddr, group string) {
+	message := &apiRegisterMessageJSON{}
+	err := json.NewDecoder(bytes.NewReader(payload)).Decode(message)
+	if err != nil {
+		log.Println("Error decoding multicast json", err)
+		return
+	}
+	if message.Type == fragmentMessage && message.Fragment != nil {
+		this.handleFragment(message, keyID, rAddr, group)
+		return
+	}
+	//Even our own messages count as they also tell us whether what we send is making it onto the group
+	if message.Seq != 0 {
+		missed := this.loss.Observe(message.SenderUUID, message.Seq)
+		this.metrics.Add("apireg_messages_missed_total", "Number of messages on the group that were detected as lost", nil, float64(missed))
+	}
+	//If we got a message from ourselves then ignore it
+	if message.SenderUUID == this.id.String() {
+		return
 	}
+	message.ApiName = this.normalizeName(message.ApiName)
+	//Nodes in other environments are still taking part in discovery so they count as peers
+	if senderID, err := uuid.Parse(message.SenderUUID); err == nil {
+		this.peers.Heard(senderID, rAddr.IP, message.AgentVersion, message.ConfigDigest, message.Environment, message.UnicastPort, time.Now())
+	}
+	//Same for messages from another environment
+	if !shouldProcessMessage(this.environment, message.Environment) {
+		return
+	}
+	//Switching the active color moves traffic for a name so it is held to the same tokens and policy as announcing it
+	if message.Type == activeColorMessage && (!this.admitToken(message, rAddr) || !this.admitPublisher(message, keyID, rAddr)) {
+		return
+	}
+	if this.handleControl(message, rAddr, group) {
+		return
+	}
+	if message.SnapshotPort != 0 {
+		this.maybeBootstrapFrom(&net.TCPAddr{IP: rAddr.IP, Port: message.SnapshotPort})
+	}
+	if !this.admitToken(message, rAddr) || !this.admitPublisher(message, keyID, rAddr) {
+		return
+	}
+	//Only changes we actually applied count towards how long the sender's change took to converge
+	if this.applyMessage(message, rAddr.IP, apireg.WithGroup(group)) {
+		this.echoChange(message, rAddr.IP)
+	}
+}
+
+// applyMessage updates our registrations for a message that has passed all the checks, hostIP being where the api is
+// served. Returns false if the message was dropped rather than applied
+func (this *multicastApiRegistry) applyMessage(message *apiRegisterMessageJSON, hostIP net.IP, opts ...apireg.ApiOption) bool {
+	if message.ApiVersion == nil {
+		log.Println("Error message from", hostIP, "is missing api-version")
+		return false
+	}
+	if !this.runAdmissionHooks(message, hostIP) {
+		return false
+	}
+	senderID, err := uuid.Parse(message.SenderUUID)
+	if err != nil {
+		log.Println("Error message from", hostIP, "has an invalid sender-uuid", err)
+		return false
+	}
+	apiVersion := apireg.NewVersion(message.ApiVersion.Major, message.ApiVersion.Minor, message.ApiVersion.BugFix)
+	//Admission hooks can rename the api so it is normalized again
+	a, err := apireg.NewApi(this.normalizeName(message.ApiName), apiVersion, senderID, message.Environment, hostIP, message.ApiPort, append(message.apiOptions(), opts...)...)
+	if err != nil {
+		log.Println("Error generating new Api from message")
+		return false
+	} else if message.Type == withdrawMessage {
+		return this.withdrawApi(a, message.Seq)
+	}
+	return this.updateForApi(a, message.Seq)
+}
+
+// Older senders don't send a state so they are always Serving
+func messageState(m *apiRegisterMessageJSON) apireg.ApiState {
+	if m.State == "" {
+		return apireg.Serving
+	}
+	return m.State
 }
 
 //Us	| Msg	| pro
@@ -207,24 +891,64 @@ func shouldProcessMessage(ourEnv, otherEnv apireg.Environment) bool {
 	return ourEnv == apireg.All || otherEnv == apireg.All || ourEnv == otherEnv
 }
 
-func (this *multicastApiRegistry) updateForApi(a apireg.Api) {
+// apiChanged returns true if updated announces anything different about the same api as old
+func apiChanged(old, updated apireg.Api) bool {
+	return old.State() != updated.State() || !maps.Equal(old.Tags(), updated.Tags()) ||
+		old.Deprecated() != updated.Deprecated() || !old.Sunset().Equal(updated.Sunset()) ||
+		old.CanaryPercent() != updated.CanaryPercent() || old.Color() != updated.Color() ||
+		!slices.Equal(old.Endpoints(), updated.Endpoints()) || old.Group() != updated.Group()
+}
+
+// updateForApi tracks or refreshes a, announced in a message with seq, returning false if the conflict resolver kept
+// what was already tracked instead
+func (this *multicastApiRegistry) updateForApi(a apireg.Api, seq uint64) bool {
 	apisForName := this.apiRegs.GetAllRegsForName(a.Name())
 
 	if len(apisForName) == 0 {
-		reg, _ := newApiRegistration(a, time.Now(), registrationLifeSpan)
-		this.apiRegs.AddReg(reg)
-	} else if len(apisForName) > 0 {
-		matched := false
-		for _, curReg := range apisForName {
-			if curReg.Api().Equal(a) {
-				curReg.UpdateTimeRegistered(time.Now())
-				matched = true
+		this.addReg(a, seq)
+		return true
+	}
+	matched := false
+	applied := false
+	for _, curReg := range apisForName {
+		if curReg.Api().Equal(a) {
+			matched = true
+			if !this.admitRefresh(curReg.Api(), a, curReg.Regressed(seq)) {
+				continue
+			}
+			applied = true
+			curReg.ObserveSeq(seq)
+			this.apiRegs.RefreshReg(curReg, time.Now())
+			if apiChanged(curReg.Api(), a) {
+				this.apiRegs.UpdateRegApi(curReg, a)
 			}
 		}
+	}
+
+	if !matched && this.admitNewInstance(a, apisForName) {
+		this.addReg(a, seq)
+		return true
+	}
+	return applied
+}
 
-		if !matched {
-			reg, _ := newApiRegistration(a, time.Now(), registrationLifeSpan)
-			this.apiRegs.AddReg(reg)
+// withdrawApi stops tracking a, withdrawn in a message with seq, unless the withdrawal is older than what was last applied
+// to it and the conflict resolver keeps what is tracked, in which case it returns false
+func (this *multicastApiRegistry) withdrawApi(a apireg.Api, seq uint64) bool {
+	for _, curReg := range this.apiRegs.GetAllRegsForName(a.Name()) {
+		if curReg.Api().Equal(a) && !this.admitRefresh(curReg.Api(), a, curReg.Regressed(seq)) {
+			return false
 		}
 	}
+	this.apiRegs.RemoveRegForApi(a)
+	return true
+}
+
+func (this *multicastApiRegistry) addReg(a apireg.Api, seq uint64) {
+	reg, _ := newApiRegistration(a, time.Now(), registrationLifeSpan)
+	reg.ObserveSeq(seq)
+	if this.apiRegs.AddReg(reg) {
+		this.initialSync.Added(time.Now())
+		this.observeChurn(a, "add")
+	}
 }
@@ -1,7 +1,12 @@
 package multicast
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"log"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,8 +53,450 @@ func TestThatTwoRegistriesRegisterEachOther(t *testing.T) {
 	}
 }
 
+func TestThatDeregisteredApiIsWithdrawnFromOtherRegistry(t *testing.T) {
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	apiName := "Withdrawn"
+	apiVersion := apireg.NewVersion(0, 1, 3)
+
+	reg0.RegisterApi(apiName, apiVersion, 8081)
+	time.Sleep(time.Second * 1)
+	if len(reg1.GetApisByApiName(apiName)) != 1 {
+		t.Fail()
+	}
+
+	reg0.DrainApi(apiName, apiVersion, 8081)
+	time.Sleep(time.Second * 1)
+	if apis := reg1.GetApisByApiName(apiName); len(apis) != 1 || apis[0].State() != apireg.Draining {
+		t.Fail()
+	}
+
+	failOnErr(reg0.DeregisterApi(apiName, apiVersion, 8081), t)
+	time.Sleep(time.Second * 1)
+	if len(reg1.GetApisByApiName(apiName)) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatRunReturnsContextErrorOnceCancelled(t *testing.T) {
+	r, err := NewRunnableMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error)
+	go func() {
+		runErr <- r.Run(ctx)
+	}()
+	cancel()
+
+	select {
+	case err = <-runErr:
+		if err != context.Canceled {
+			t.Fail()
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return after context was cancelled")
+	}
+}
+
+func TestThatRunReturnsNilOnceClosed(t *testing.T) {
+	r, err := NewRunnableMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+
+	runErr := make(chan error)
+	go func() {
+		runErr <- r.Run(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 100)
+	r.Close()
+
+	if <-runErr != nil {
+		t.Fail()
+	}
+}
+
+func TestThatRunReturnsErrorIfAlreadyRunning(t *testing.T) {
+	r, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer r.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	if r.(apireg.RunnableApiRegistry).Run(context.Background()) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatPanicWhileHandlingMessageIsRecoveredAndReported(t *testing.T) {
+	var crashedPayload []byte
+	var crashedWith interface{}
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()),
+		WithCrashHandler(func(payload []byte, source *net.UDPAddr, recovered interface{}) {
+			crashedPayload = payload
+			crashedWith = recovered
+		}),
+		WithAdmissionHooks(AdmissionHookFunc(func(reg *InboundRegistration) error {
+			panic("hook panicked")
+		})))
+	failOnErr(err, t)
+	defer r.Close()
+	payload := sequencedMessageOfType(registerMessage, "Something", 80, apireg.Serving, uuid.NewString(), 0)
+
+	r.handleMessageRecovered(payload, hookSource, r.groups[0].name)
+
+	if string(crashedPayload) != string(payload) || crashedWith != "hook panicked" || len(r.errs) != 1 ||
+		r.metrics.Value("apireg_message_panics_total", nil) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWithCrashHandlerReturnsErrorForNilHandler(t *testing.T) {
+	if WithCrashHandler(nil)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatApisBeyondSendBudgetAreStillSentOnceBudgetAllows(t *testing.T) {
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSendBudget(0, 2))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	for port := 9001; port <= 9004; port++ {
+		failOnErr(reg0.RegisterApi("Budgeted", apireg.NewVersion(0, 1, 3), port), t)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	if len(reg1.GetApisByApiName("Budgeted")) > 2 {
+		t.Fail()
+	}
+	time.Sleep(time.Second * 2)
+	if len(reg1.GetApisByApiName("Budgeted")) != 4 {
+		t.Fail()
+	}
+}
+
+func TestThatWithSendBudgetReturnsErrorWithNoLimits(t *testing.T) {
+	if WithSendBudget(0, 0)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatResendsOfOwnedApisAreSpreadAcrossTheInterval(t *testing.T) {
+	groupAddr := &net.UDPAddr{IP: net.ParseIP(DEFAULT_MULTICAST_GROUP_IP), Port: DEFAULT_MULTICAST_GROUP_PORT}
+	conn, err := net.ListenMulticastUDP("udp", nil, groupAddr)
+	failOnErr(err, t)
+	defer conn.Close()
+
+	id := uuid.New()
+	interval := time.Millisecond * 900
+	r, err := NewMulticastRegistry(nil, apireg.All, id, WithHeartbeatBounds(interval, interval))
+	failOnErr(err, t)
+	defer r.Close()
+	for port := 9101; port <= 9103; port++ {
+		r.RegisterApi("Staggered", apireg.NewVersion(0, 0, 1), port)
+	}
+
+	//Skip over the announcements from registering and only look at the resends
+	receiveTimes := make([]time.Time, 0)
+	buff := make([]byte, registrationMessageSizeBytes)
+	conn.SetReadDeadline(time.Now().Add(interval * 2))
+	for {
+		n, _, err := conn.ReadFromUDP(buff)
+		if err != nil {
+			break
+		}
+		if bytes.Contains(buff[:n], []byte(id.String())) {
+			receiveTimes = append(receiveTimes, time.Now())
+		}
+	}
+
+	if len(receiveTimes) < 6 {
+		t.Fatal("expected at least the 3 registrations and 3 resends but got", len(receiveTimes))
+	}
+	resendTimes := receiveTimes[3:6]
+	for i := 1; i < len(resendTimes); i++ {
+		if resendTimes[i].Sub(resendTimes[i-1]) < interval/6 {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatRegistryListsPeersItHasHeardFrom(t *testing.T) {
+	reg0ID := uuid.New()
+	reg0, err := NewMulticastRegistry(nil, apireg.NonProd, reg0ID)
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.Prod, uuid.New())
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	reg0.RegisterApi("Peered", apireg.NewVersion(0, 0, 1), 9405)
+	time.Sleep(time.Millisecond * 200)
+
+	//Even though reg1 doesn't track anything from another environment it still hears reg0
+	for _, curPeer := range reg1.ListPeers() {
+		if curPeer.ID == reg0ID {
+			if curPeer.AgentVersion != AGENT_VERSION || curPeer.Environment != apireg.NonProd || time.Since(curPeer.LastHeard) > time.Second {
+				t.Fail()
+			}
+			return
+		}
+	}
+	t.Fail()
+}
+
+func TestThatRegistryRequiringTokensOnlyTracksApisWithValidTokens(t *testing.T) {
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithAdmissionTokens(map[string][]string{"Tokened*": {HashRegistrationToken("secret")}}))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	reg0.RegisterApi("TokenedGood", apireg.NewVersion(0, 0, 1), 9201, apireg.WithToken("secret"))
+	reg0.RegisterApi("TokenedBad", apireg.NewVersion(0, 0, 1), 9202, apireg.WithToken("guess"))
+	time.Sleep(time.Millisecond * 500)
+
+	if len(reg1.GetApisByApiName("TokenedGood")) != 1 || len(reg1.GetApisByApiName("TokenedBad")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatRegistriesSharingEncryptionKeySeeEachOtherButOthersDoNot(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithEncryptionKey(key))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithEncryptionKey(key))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	plainReg, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer plainReg.Close()
+
+	reg0.RegisterApi("Encrypted", apireg.NewVersion(0, 0, 1), 9301)
+	time.Sleep(time.Millisecond * 500)
+
+	if len(reg1.GetApisByApiName("Encrypted")) != 1 || len(plainReg.GetApisByApiName("Encrypted")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatRegistryMidRotationAcceptsOldKeyButSignsWithNewest(t *testing.T) {
+	oldKey := Key{ID: "old", Secret: bytes.Repeat([]byte{1}, 32)}
+	newKey := Key{ID: "new", Secret: bytes.Repeat([]byte{2}, 32)}
+	oldReg, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSigningKeys(oldKey))
+	failOnErr(err, t)
+	defer oldReg.Close()
+
+	rotatedReg, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSigningKeys(oldKey, newKey))
+	failOnErr(err, t)
+	defer rotatedReg.Close()
+
+	oldReg.RegisterApi("SignedOld", apireg.NewVersion(0, 0, 1), 9401)
+	rotatedReg.RegisterApi("SignedNew", apireg.NewVersion(0, 0, 1), 9402)
+	time.Sleep(time.Millisecond * 500)
+
+	if len(rotatedReg.GetApisByApiName("SignedOld")) != 1 || len(oldReg.GetApisByApiName("SignedNew")) != 0 {
+		t.Fail()
+	}
+}
+
 func failOnErr(err error, t *testing.T) {
 	if err != nil {
 		t.Fail()
 	}
 }
+
+func sequencedMessageOfType(t messageType, name string, port int, state apireg.ApiState, sender string, seq uint64) []byte {
+	return []byte(fmt.Sprintf(`{"type":"%s","seq":%d,"api-name":"%s","api-version":{"major":1,"minor":0,"bugfix":0},"api-port":%d,"state":"%s","sender-uuid":"%s"}`, t, seq, name, port, state, sender))
+}
+
+func largeMessage(name string) []byte {
+	return []byte(`{"api-name":"` + name + `","api-version":{"major":1},"api-port":80,"sender-uuid":"` + uuid.NewString() + `","env":"all","padding":"` + strings.Repeat("x", 2000) + `"}`)
+}
+
+func TestThatDatagramLargerThanReceiveBufferIsReportedAsTruncated(t *testing.T) {
+	b := NewBroker()
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	go r.Run(context.Background())
+	defer r.Close()
+	time.Sleep(time.Millisecond * 50)
+
+	b.Write(largeMessage("Truncated"))
+	time.Sleep(time.Millisecond * 50)
+
+	if r.metrics.Value("apireg_truncated_messages_total", nil) != 1 || len(r.Errors()) != 1 || len(r.GetApisByApiName("Truncated")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatLargerReceiveBufferAcceptsLargerDatagrams(t *testing.T) {
+	b := NewBroker()
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithReceiveBufferSize(4096))
+	failOnErr(err, t)
+	go r.Run(context.Background())
+	defer r.Close()
+	time.Sleep(time.Millisecond * 50)
+
+	b.Write(largeMessage("Large"))
+	time.Sleep(time.Millisecond * 50)
+
+	if len(r.GetApisByApiName("Large")) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWithReceiveBufferSizeReturnsErrorForSizeSmallerThanWeSend(t *testing.T) {
+	if WithReceiveBufferSize(512)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatTagsAreAnnouncedWithApi(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Tagged", apireg.NewVersion(0, 0, 1), 9450, apireg.WithTags(map[string]string{"metrics": "true"})), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Tagged")
+	if len(apis) != 1 || apis[0].Tags()["metrics"] != "true" {
+		t.Fail()
+	}
+}
+
+func TestThatEndpointsAreAnnouncedWithApi(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+	metrics := apireg.Endpoint{Name: "metrics", Protocol: "http", Port: 9100, Path: "/metrics"}
+
+	failOnErr(reg0.RegisterApi("Exposed", apireg.NewVersion(0, 0, 1), 9451, apireg.WithEndpoints(metrics)), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Exposed")
+	if len(apis) != 1 || len(apis[0].Endpoints()) != 2 || apis[0].Endpoints()[1] != metrics || apireg.DefaultEndpoint(apis[0]).Port != 9451 {
+		t.Fail()
+	}
+}
+
+func TestThatRegisterApiReturnsErrorForDuplicateEndpoints(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	err = r.RegisterApi("Exposed", apireg.NewVersion(0, 0, 1), 9452, apireg.WithEndpoints(apireg.Endpoint{Name: "metrics", Port: 9100}, apireg.Endpoint{Name: "metrics", Port: 9101}))
+	if err == nil || len(r.ownedApis.All()) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatDeprecationIsAnnouncedWithApi(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+	sunset := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	failOnErr(reg0.RegisterApi("Old", apireg.NewVersion(0, 0, 1), 9455, apireg.WithDeprecation(sunset)), t)
+	failOnErr(reg0.RegisterApi("Old", apireg.NewVersion(0, 0, 2), 9456), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Old")
+	if len(apis) != 2 {
+		t.FailNow()
+	}
+	for _, curApi := range apis {
+		deprecated := curApi.Version().BugFix() == 1
+		if curApi.Deprecated() != deprecated || (deprecated && !curApi.Sunset().Equal(sunset)) || (!deprecated && !curApi.Sunset().IsZero()) {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatCanaryIsAnnouncedWithApi(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Rollout", apireg.NewVersion(0, 0, 1), 9457, apireg.WithCanary(5)), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Rollout")
+	if len(apis) != 1 || apis[0].CanaryPercent() != 5 {
+		t.Fail()
+	}
+}
+
+func TestThatReadingApisByNameDoesNotAllocate(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Hot", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Hot", 8081, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	buffer := make([]apireg.Api, 0, 4)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.GetApisByApiName("Hot")
+		buffer = r.AppendApisByApiName(buffer[:0], "Hot")
+	})
+	if allocs != 0 || len(buffer) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatForceAnnounceSendsOwnedApisRightAway(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	failOnErr(r.RegisterApi("Forced", apireg.NewVersion(0, 0, 1), 9460), t)
+	failOnErr(r.RegisterApi("Forced", apireg.NewVersion(0, 0, 2), 9461), t)
+	failOnErr(r.RegisterApi("Other", apireg.NewVersion(0, 0, 1), 9462), t)
+
+	failOnErr(r.ForceAnnounce("Forced"), t)
+	if r.metrics.Value("apireg_sent_messages_total", nil) != 5 {
+		t.Fail()
+	}
+	failOnErr(r.ForceAnnounceAll(), t)
+	if r.metrics.Value("apireg_sent_messages_total", nil) != 8 {
+		t.Fail()
+	}
+}
+
+func TestThatForceAnnounceReturnsErrorForApiNotRegistered(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	if r.ForceAnnounce("Missing") == nil {
+		t.Fail()
+	}
+}
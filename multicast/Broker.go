@@ -0,0 +1,93 @@
+package multicast
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Messages waiting to be read by a registry on a broker beyond this are dropped, the same as a full socket buffer would
+const brokerConnBufferLen int = 256
+
+// Broker stands in for the multicast group between registries in the same process, for tests and CI runners that aren't
+// allowed to join real groups. Messages still go through the same encoding, decoding and expiry as they would on a group
+// and come from 127.0.0.1 so pings and snapshots between the registries work over loopback
+type Broker struct {
+	conns      map[*brokerConn]struct{}
+	connsMutex *sync.RWMutex
+}
+
+func NewBroker() *Broker {
+	b := &Broker{}
+	b.conns = make(map[*brokerConn]struct{})
+	b.connsMutex = &sync.RWMutex{}
+
+	return b
+}
+
+// WithBroker has the registry use b instead of a multicast group. Every registry on the same broker sees each other
+func WithBroker(b *Broker) Option {
+	return func(r *multicastApiRegistry) error {
+		if b == nil {
+			return errors.New("b (broker) is required for WithBroker")
+		}
+		r.transport = b
+		return nil
+	}
+}
+
+func (this *Broker) Listen() (groupConn, error) {
+	c := &brokerConn{broker: this, messages: make(chan []byte, brokerConnBufferLen), closed: make(chan struct{})}
+	this.connsMutex.Lock()
+	this.conns[c] = struct{}{}
+	this.connsMutex.Unlock()
+
+	return c, nil
+}
+
+// Write hands a copy of payload to every registry listening on the broker, including the writer like a group would
+func (this *Broker) Write(payload []byte) error {
+	this.connsMutex.RLock()
+	for curConn := range this.conns {
+		select {
+		case curConn.messages <- append([]byte{}, payload...):
+		default:
+		}
+	}
+	this.connsMutex.RUnlock()
+
+	return nil
+}
+
+func (this *Broker) remove(c *brokerConn) {
+	this.connsMutex.Lock()
+	delete(this.conns, c)
+	this.connsMutex.Unlock()
+}
+
+var brokerSourceAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: DEFAULT_MULTICAST_GROUP_PORT}
+
+// brokerConn is one registry's view of a broker
+type brokerConn struct {
+	broker    *Broker
+	messages  chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (this *brokerConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case <-this.closed:
+		return 0, nil, net.ErrClosed
+	case message := <-this.messages:
+		return copy(b, message), brokerSourceAddr, nil
+	}
+}
+
+func (this *brokerConn) Close() error {
+	this.closeOnce.Do(func() {
+		this.broker.remove(this)
+		close(this.closed)
+	})
+	return nil
+}
@@ -0,0 +1,61 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatRegistriesOnSameBrokerSeeEachOther(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Brokered", apireg.NewVersion(1, 0, 0), 80), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Brokered")
+	if len(apis) != 1 || !apis[0].HostIP().Equal(brokerSourceAddr.IP) {
+		t.FailNow()
+	}
+
+	failOnErr(reg0.DeregisterApi("Brokered", apireg.NewVersion(1, 0, 0), 80), t)
+	time.Sleep(time.Millisecond * 50)
+
+	if len(reg1.GetApisByApiName("Brokered")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatRegistriesOnDifferentBrokersDoNotSeeEachOther(t *testing.T) {
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Brokered", apireg.NewVersion(1, 0, 0), 80), t)
+	time.Sleep(time.Millisecond * 50)
+
+	if len(reg1.GetApisByApiName("Brokered")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatClosedBrokerConnStopsReceiving(t *testing.T) {
+	b := NewBroker()
+	c, _ := b.Listen()
+	c.Close()
+	b.Write([]byte("hello"))
+
+	if _, _, err := c.ReadFromUDP(make([]byte, 16)); err == nil || len(b.conns) != 0 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,130 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// ChurnAlarm is reported on Errors when registrations are being added and expiring faster than the thresholds of
+// WithChurnAlarm, which is usually a crash loop or trouble on the network
+type ChurnAlarm struct {
+	//Name of the api that is churning, empty when it is the whole fleet
+	Name string
+	//Transitions is how many registrations were added or expired within Window
+	Transitions int
+	Window      time.Duration
+}
+
+func (this *ChurnAlarm) Error() string {
+	if this.Name == "" {
+		return fmt.Sprint(this.Transitions, " registrations were added or expired across the fleet in the last ", this.Window)
+	}
+	return fmt.Sprint(this.Transitions, " registrations of ", this.Name, " were added or expired in the last ", this.Window)
+}
+
+// WithChurnAlarm reports a *ChurnAlarm on Errors when more than perApi registrations of one api name are added or expire
+// within window, or more than fleet registrations across every name. Either threshold can be 0 to only watch the other.
+// An alarm isn't reported again until the churn has dropped back under its threshold. Every transition is counted in
+// apireg_churn_transitions_total and every alarm in apireg_churn_alarms_total
+func WithChurnAlarm(window time.Duration, perApi, fleet int) Option {
+	return func(r *multicastApiRegistry) error {
+		if window <= 0 {
+			return errors.New("window must be > 0 for WithChurnAlarm")
+		} else if perApi < 0 || fleet < 0 {
+			return errors.New("perApi and fleet can't be negative for WithChurnAlarm")
+		} else if perApi == 0 && fleet == 0 {
+			return errors.New("at least one of perApi or fleet must be > 0 for WithChurnAlarm")
+		}
+		r.churn = newSyncChurnTracker(window, perApi, fleet)
+		return nil
+	}
+}
+
+// syncChurnTracker keeps when each transition within the window happened, per name and across the fleet
+type syncChurnTracker struct {
+	window      time.Duration
+	perApi      int
+	fleet       int
+	transitions map[string][]time.Time
+	fleetTimes  []time.Time
+	//Names, and the empty name for the fleet, that have an alarm that hasn't cleared yet
+	alarming map[string]bool
+	mutex    *sync.Mutex
+}
+
+func newSyncChurnTracker(window time.Duration, perApi, fleet int) *syncChurnTracker {
+	c := &syncChurnTracker{window: window, perApi: perApi, fleet: fleet}
+	c.transitions = make(map[string][]time.Time)
+	c.alarming = make(map[string]bool)
+	c.mutex = &sync.Mutex{}
+
+	return c
+}
+
+// Observe records a transition of name at t and returns any alarms it set off
+func (this *syncChurnTracker) Observe(name string, t time.Time) []*ChurnAlarm {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	alarms := make([]*ChurnAlarm, 0)
+	since := t.Add(-this.window)
+
+	this.transitions[name] = append(trimBefore(this.transitions[name], since), t)
+	this.fleetTimes = append(trimBefore(this.fleetTimes, since), t)
+	if alarm := this.check(name, len(this.transitions[name]), this.perApi); alarm != nil {
+		alarms = append(alarms, alarm)
+	}
+	if alarm := this.check("", len(this.fleetTimes), this.fleet); alarm != nil {
+		alarms = append(alarms, alarm)
+	}
+	//Names that have gone quiet don't need to be remembered
+	for curName, curTimes := range this.transitions {
+		if len(trimBefore(curTimes, since)) == 0 {
+			delete(this.transitions, curName)
+			delete(this.alarming, curName)
+		}
+	}
+	return alarms
+}
+
+// check returns an alarm for name if count went over threshold and it isn't already alarming
+func (this *syncChurnTracker) check(name string, count, threshold int) *ChurnAlarm {
+	if threshold == 0 {
+		return nil
+	} else if count <= threshold {
+		delete(this.alarming, name)
+		return nil
+	} else if this.alarming[name] {
+		return nil
+	}
+	this.alarming[name] = true
+	return &ChurnAlarm{Name: name, Transitions: count, Window: this.window}
+}
+
+// trimBefore drops every time before since from times, which are in order
+func trimBefore(times []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(since) {
+		i++
+	}
+	return times[i:]
+}
+
+// observeChurn counts a transition of a, either "add" or "expire", raising any alarm it sets off
+func (this *multicastApiRegistry) observeChurn(a apireg.Api, transition string) {
+	if this.churn == nil {
+		return
+	}
+	this.metrics.Add("apireg_churn_transitions_total", "Number of registrations added or expired", map[string]string{"api": a.Name(), "transition": transition}, 1)
+	for _, curAlarm := range this.churn.Observe(a.Name(), time.Now()) {
+		labels := map[string]string{"scope": "api", "api": curAlarm.Name}
+		if curAlarm.Name == "" {
+			labels = map[string]string{"scope": "fleet"}
+		}
+		this.metrics.Add("apireg_churn_alarms_total", "Number of times registrations were added or expired faster than the churn alarm allows", labels, 1)
+		this.reportError(curAlarm)
+	}
+}
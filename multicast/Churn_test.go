@@ -0,0 +1,95 @@
+package multicast
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatWithChurnAlarmNeedsAThreshold(t *testing.T) {
+	if WithChurnAlarm(time.Minute, 0, 0)(&multicastApiRegistry{}) == nil || WithChurnAlarm(0, 1, 1)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatChurnOverThresholdAlarmsOnce(t *testing.T) {
+	c := newSyncChurnTracker(time.Minute, 2, 0)
+	start := time.Now()
+
+	if len(c.Observe("Flappy", start)) != 0 || len(c.Observe("Flappy", start.Add(time.Second))) != 0 {
+		t.FailNow()
+	}
+	alarms := c.Observe("Flappy", start.Add(time.Second*2))
+	if len(alarms) != 1 || alarms[0].Name != "Flappy" || alarms[0].Transitions != 3 {
+		t.FailNow()
+	}
+	if len(c.Observe("Flappy", start.Add(time.Second*3))) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatChurnAlarmRearmsOnceQuiet(t *testing.T) {
+	c := newSyncChurnTracker(time.Minute, 1, 0)
+	start := time.Now()
+
+	c.Observe("Flappy", start)
+	if len(c.Observe("Flappy", start.Add(time.Second))) != 1 {
+		t.FailNow()
+	}
+	//Everything before has left the window so this one alone is under the threshold
+	c.Observe("Flappy", start.Add(time.Minute*2))
+	if len(c.Observe("Flappy", start.Add(time.Minute*2+time.Second))) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatFleetChurnAlarmCountsEveryName(t *testing.T) {
+	c := newSyncChurnTracker(time.Minute, 0, 2)
+	start := time.Now()
+
+	c.Observe("A", start)
+	c.Observe("B", start)
+	alarms := c.Observe("C", start)
+	if len(alarms) != 1 || alarms[0].Name != "" {
+		t.Fail()
+	}
+}
+
+func TestThatRegistryReportsChurnAlarm(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithChurnAlarm(time.Minute, 2, 0))
+	failOnErr(err, t)
+	defer r.Close()
+
+	for _, curPort := range []int{8080, 8081, 8082} {
+		r.handleMessage(sequencedMessageOfType(registerMessage, "Flappy", curPort, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	}
+
+	alarm := &ChurnAlarm{}
+	if err := <-r.Errors(); !errors.As(err, &alarm) || alarm.Name != "Flappy" {
+		t.Fail()
+	}
+	if r.metrics.Value("apireg_churn_alarms_total", map[string]string{"scope": "api", "api": "Flappy"}) != 1 ||
+		r.metrics.Value("apireg_churn_transitions_total", map[string]string{"api": "Flappy", "transition": "add"}) != 3 {
+		t.Fail()
+	}
+}
+
+func TestThatExpiryNoticedOnReadIsCounted(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithChurnAlarm(time.Minute, 10, 0))
+	failOnErr(err, t)
+	defer r.Close()
+	a, err := apireg.NewApi("Lapsed", apireg.NewVersion(1, 0, 0), uuid.New(), apireg.All, hookSource.IP, 8080)
+	failOnErr(err, t)
+	reg, _ := newApiRegistration(a, time.Now().Add(-registrationLifeSpan*2), registrationLifeSpan)
+	r.apiRegs.AddReg(reg)
+
+	r.apiRegs.GetAllRegsForName("Lapsed")
+	r.apiRegs.purgeExpired(time.Now())
+
+	if r.metrics.Value("apireg_churn_transitions_total", map[string]string{"api": "Lapsed", "transition": "expire"}) != 1 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,46 @@
+package multicast
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+)
+
+const (
+	//Cluster groups are in 239.255.0.0/16, the organization local scope that is meant for groups allocated on site
+	clusterGroupPrefix0 byte = 239
+	clusterGroupPrefix1 byte = 255
+	//Cluster ports are kept under the ephemeral range most platforms hand out
+	clusterPortBase  int = 20000
+	clusterPortRange int = 10000
+)
+
+// WithClusterName puts the registry on a group and port derived from name, like "payments-lab", in place of lAddr so
+// that clusters sharing a LAN can keep to themselves without anyone having to hand out groups. Every registry with the
+// same name lands on the same group, see ClusterGroup
+func WithClusterName(name string) Option {
+	return func(r *multicastApiRegistry) error {
+		if name == "" {
+			return errors.New("name is required for WithClusterName")
+		}
+		udpTransport, isUDP := r.transport.(*udpMulticastTransport)
+		if !isUDP {
+			return errors.New("WithClusterName only applies to a multicast group and can't be used along with WithBroker")
+		}
+		r.mAddr = ClusterGroup(name)
+		udpTransport.addr = r.mAddr
+		return nil
+	}
+}
+
+// ClusterGroup is the group and port registries created WithClusterName(name) are on. Groups are in 239.255.0.0/16
+// leaving out 239.255.0.x and 239.255.255.x, the latter being where SSDP lives, and ports are between 20000 and 29999
+func ClusterGroup(name string) *net.UDPAddr {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	sum := h.Sum64()
+
+	ip := net.IPv4(clusterGroupPrefix0, clusterGroupPrefix1, byte(1+sum%254), byte(1+(sum>>8)%254))
+	port := clusterPortBase + int((sum>>16)%uint64(clusterPortRange))
+	return &net.UDPAddr{IP: ip, Port: port}
+}
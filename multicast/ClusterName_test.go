@@ -0,0 +1,55 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatClusterGroupIsStableAndInSafeRange(t *testing.T) {
+	for _, curName := range []string{"payments-lab", "payments-prod", "", "a"} {
+		group := ClusterGroup(curName)
+		ip := group.IP.To4()
+
+		if !group.IP.Equal(ClusterGroup(curName).IP) || group.Port != ClusterGroup(curName).Port {
+			t.Fail()
+		}
+		if ip[0] != 239 || ip[1] != 255 || ip[2] == 0 || ip[2] == 255 || ip[3] == 0 || ip[3] == 255 || group.Port < 20000 || group.Port > 29999 {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatDifferentClusterNamesGetDifferentGroups(t *testing.T) {
+	if ClusterGroup("payments-lab").String() == ClusterGroup("payments-prod").String() {
+		t.Fail()
+	}
+}
+
+func TestThatRegistriesOnlySeeTheirOwnCluster(t *testing.T) {
+	lab0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithClusterName("payments-lab"))
+	failOnErr(err, t)
+	defer lab0.Close()
+	lab1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithClusterName("payments-lab"))
+	failOnErr(err, t)
+	defer lab1.Close()
+	prod, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithClusterName("payments-prod"))
+	failOnErr(err, t)
+	defer prod.Close()
+
+	failOnErr(lab0.RegisterApi("Clustered", apireg.NewVersion(0, 0, 1), 9490), t)
+	time.Sleep(time.Millisecond * 200)
+
+	apis := lab1.GetApisByApiName("Clustered")
+	if len(apis) != 1 || apis[0].Group() != ClusterGroup("payments-lab").String() || len(prod.GetApisByApiName("Clustered")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatWithClusterNameCantBeUsedWithBroker(t *testing.T) {
+	if _, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithClusterName("lab")); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,109 @@
+package multicast
+
+import (
+	"errors"
+	"net"
+)
+
+// codec turns encoded messages into what is actually put on the wire and back again
+type codec interface {
+	Encode(payload []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// keyedCodec is a codec that can also tell which key a message was signed with
+type keyedCodec interface {
+	codec
+	open(data []byte) ([]byte, string, error)
+}
+
+// openWith decodes data with c, also returning the id of the key it was signed with if c knows it
+func openWith(c codec, data []byte) ([]byte, string, error) {
+	if keyed, isKeyed := c.(keyedCodec); isKeyed {
+		return keyed.open(data)
+	}
+	payload, err := c.Decode(data)
+	return payload, "", err
+}
+
+// buildCodec signs before encrypting so that the signature is hidden too
+func (this *multicastApiRegistry) buildCodec() codec {
+	chain := make(chainCodec, 0, 2)
+	for _, curCodec := range []codec{this.signing, this.encryption} {
+		if curCodec != nil {
+			chain = append(chain, curCodec)
+		}
+	}
+
+	if len(chain) == 0 {
+		return plainCodec{}
+	}
+	return chain
+}
+
+// decode takes a message from rAddr off the wire with codec, also returning the id of the key it was signed with if it was
+func (this *multicastApiRegistry) decode(data []byte, rAddr *net.UDPAddr) ([]byte, string, error) {
+	payload, keyID, err := openWith(this.codec, data)
+
+	unverified := &unverifiedError{}
+	if errors.As(err, &unverified) && this.signingEnforcement == VerifyAndLog {
+		this.recordUnverified(unverified.err, rAddr)
+		return unverified.payload, "", nil
+	}
+	return payload, keyID, err
+}
+
+// keyObserver counts the key ids seen on decoded messages so operators can tell when an old key is no longer in use
+func (this *multicastApiRegistry) keyObserver(kind string) func(kid string) {
+	return func(kid string) {
+		this.metrics.Add("apireg_key_id_seen_total", "Number of received messages decoded with each key id", map[string]string{"codec": kind, "kid": kid}, 1)
+	}
+}
+
+// plainCodec puts messages on the wire as is
+type plainCodec struct{}
+
+func (this plainCodec) Encode(payload []byte) ([]byte, error) {
+	return payload, nil
+}
+
+func (this plainCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// chainCodec runs payloads through each codec in order when encoding and in reverse when decoding
+type chainCodec []codec
+
+func (this chainCodec) Encode(payload []byte) ([]byte, error) {
+	var err error
+	for _, curCodec := range this {
+		payload, err = curCodec.Encode(payload)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+func (this chainCodec) Decode(data []byte) ([]byte, error) {
+	payload, _, err := this.open(data)
+	return payload, err
+}
+
+// open is Decode that also returns the key id given by whichever codec in the chain signs messages
+func (this chainCodec) open(data []byte) ([]byte, string, error) {
+	keyID := ""
+	for i := len(this) - 1; i >= 0; i-- {
+		var curKeyID string
+		var err error
+		data, curKeyID, err = openWith(this[i], data)
+
+		if err != nil {
+			return nil, "", err
+		} else if curKeyID != "" {
+			keyID = curKeyID
+		}
+	}
+	return data, keyID, nil
+}
@@ -0,0 +1,35 @@
+package multicast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// PROTOCOL_VERSION is the version of the wire format, bumped whenever a change means nodes on different versions can't
+// work together. It is part of the config digest so such nodes show up as configured differently in ListPeers
+const PROTOCOL_VERSION int = 1
+
+// describeConfig lists what a node has to agree with the rest of the group on for them to work together, which is what
+// the config digest is taken over. Settings nodes are free to tune on their own, like heartbeat bounds and datagram size,
+// are left out. Keys and tokens are only noted as being used so the digest gives nothing away
+func (this *multicastApiRegistry) describeConfig() string {
+	control := ""
+	if this.controlAddr != nil {
+		control = this.controlAddr.String()
+	}
+	return fmt.Sprint("protocol=", PROTOCOL_VERSION,
+		" group=", this.mAddr,
+		" control=", control,
+		" lifespan=", registrationLifeSpan,
+		" encrypted=", this.encryption != nil,
+		" signed=", this.signing != nil,
+		" tokens=", this.admissionTokens != nil,
+		" normalized=", this.nameNormalizer != nil)
+}
+
+// digestConfig is a short hash of describeConfig that every message carries, nodes with the same digest are configured alike
+func (this *multicastApiRegistry) digestConfig() string {
+	sum := sha256.Sum256([]byte(this.describeConfig()))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,51 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatRegistriesConfiguredAlikeShareDigest(t *testing.T) {
+	reg0, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer reg1.Close()
+	//Heartbeat bounds and datagram size can differ between nodes that work together
+	reg2, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithHeartbeatBounds(time.Second, time.Second*10), WithMTU(1400))
+	failOnErr(err, t)
+	defer reg2.Close()
+	reg3, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithEncryptionKey(make([]byte, 32)))
+	failOnErr(err, t)
+	defer reg3.Close()
+
+	if reg0.configDigest == "" || reg0.configDigest != reg1.configDigest || reg0.configDigest != reg2.configDigest || reg0.configDigest == reg3.configDigest {
+		t.Fail()
+	}
+	if reg0.metrics.Value("apireg_config_info", map[string]string{"agent_version": AGENT_VERSION, "config_digest": reg0.configDigest}) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatPeersAreListedWithTheirConfigDigest(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithNameNormalization(FoldCase))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Described", apireg.NewVersion(0, 0, 1), 9495), t)
+	time.Sleep(time.Millisecond * 50)
+
+	peers := reg1.ListPeers()
+	if len(peers) != 1 || peers[0].ConfigDigest != reg0.(*multicastApiRegistry).configDigest ||
+		peers[0].ConfigDigest == reg1.(*multicastApiRegistry).configDigest {
+		t.Fail()
+	}
+}
@@ -0,0 +1,125 @@
+package multicast
+
+import (
+	"errors"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// ConflictKind is what makes an incoming announcement conflict with what is already tracked
+type ConflictKind string
+
+const (
+	//The same sender announced the same name and version on a different port
+	ConflictPortChange ConflictKind = "port-change"
+	//Another sender or host announced the same name and version
+	ConflictHost ConflictKind = "host"
+	//The announcement refreshes or withdraws a tracked api but is older than the last message applied to it
+	ConflictSeqRegression ConflictKind = "seq-regression"
+)
+
+// ConflictResolution is what a ConflictResolver decided to do about a Conflict
+type ConflictResolution string
+
+const (
+	//Keep what is tracked and drop the incoming announcement
+	KeepExisting ConflictResolution = "keep-existing"
+	//Stop tracking the existing api and track the incoming one in its place
+	Replace ConflictResolution = "replace"
+	//Track both, which is what happens without a resolver. For a sequence regression it applies the announcement
+	KeepBoth ConflictResolution = "keep-both"
+)
+
+// Conflict is an incoming announcement that conflicts with an api that is already tracked
+type Conflict struct {
+	Kind     ConflictKind
+	Existing apireg.Api
+	Incoming apireg.Api
+}
+
+// ConflictResolver decides what happens when an announcement conflicts with what is already tracked
+type ConflictResolver interface {
+	Resolve(c Conflict) ConflictResolution
+}
+
+// ConflictResolverFunc lets a plain function be used as a ConflictResolver
+type ConflictResolverFunc func(c Conflict) ConflictResolution
+
+func (this ConflictResolverFunc) Resolve(c Conflict) ConflictResolution {
+	return this(c)
+}
+
+// StaticResolution resolves every conflict with res
+func StaticResolution(res ConflictResolution) ConflictResolver {
+	return ConflictResolverFunc(func(c Conflict) ConflictResolution {
+		return res
+	})
+}
+
+// WithConflictResolver has resolver decide what happens when an announcement conflicts with a tracked api: the same sender
+// moving an api to another port, a second sender or host announcing the same name and version, or a sender's older
+// message arriving after a newer one. Without it every instance is tracked side by side and every refresh is applied.
+// Each conflict is counted in apireg_conflicts_total by kind and resolution
+func WithConflictResolver(resolver ConflictResolver) Option {
+	return func(r *multicastApiRegistry) error {
+		if resolver == nil {
+			return errors.New("resolver is required for WithConflictResolver")
+		}
+		r.conflictResolver = resolver
+		return nil
+	}
+}
+
+// conflictKind returns what kind of conflict incoming has with existing, empty if they don't conflict
+func conflictKind(existing, incoming apireg.Api) ConflictKind {
+	if existing.Name() != incoming.Name() || !existing.Version().Equal(incoming.Version()) {
+		return ""
+	} else if existing.UUID() == incoming.UUID() && existing.HostIP().Equal(incoming.HostIP()) {
+		if existing.HostPort() == incoming.HostPort() {
+			return ""
+		}
+		return ConflictPortChange
+	}
+	return ConflictHost
+}
+
+// resolveConflict asks the resolver what to do about a conflict of kind between existing and incoming
+func (this *multicastApiRegistry) resolveConflict(kind ConflictKind, existing, incoming apireg.Api) ConflictResolution {
+	res := this.conflictResolver.Resolve(Conflict{Kind: kind, Existing: existing, Incoming: incoming})
+
+	if res != KeepExisting && res != Replace {
+		res = KeepBoth
+	}
+	this.metrics.Add("apireg_conflicts_total", "Number of announcements that conflicted with a tracked api", map[string]string{"kind": string(kind), "resolution": string(res)}, 1)
+	return res
+}
+
+// admitNewInstance returns false if a, which isn't tracked yet, should be dropped over a conflict, removing any tracked api
+// the resolver wants it to replace
+func (this *multicastApiRegistry) admitNewInstance(a apireg.Api, apisForName []*apiRegistration) bool {
+	if this.conflictResolver == nil {
+		return true
+	}
+	for _, curReg := range apisForName {
+		kind := conflictKind(curReg.Api(), a)
+		if kind == "" {
+			continue
+		}
+		switch this.resolveConflict(kind, curReg.Api(), a) {
+		case KeepExisting:
+			return false
+		case Replace:
+			this.apiRegs.RemoveRegForApi(curReg.Api())
+		}
+	}
+	return true
+}
+
+// admitRefresh returns false if a refresh or withdrawal of existing by a, older than the last message applied to it, should be
+// dropped
+func (this *multicastApiRegistry) admitRefresh(existing, a apireg.Api, regressed bool) bool {
+	if this.conflictResolver == nil || !regressed {
+		return true
+	}
+	return this.resolveConflict(ConflictSeqRegression, existing, a) != KeepExisting
+}
@@ -0,0 +1,151 @@
+package multicast
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+var otherHookSource = &net.UDPAddr{IP: net.ParseIP("10.0.0.3"), Port: DEFAULT_MULTICAST_GROUP_PORT}
+
+func newResolvingRegistry(t *testing.T, resolver ConflictResolver) *multicastApiRegistry {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithConflictResolver(resolver))
+	failOnErr(err, t)
+	return r
+}
+
+func sequencedMessage(name string, port int, state apireg.ApiState, sender string, seq uint64) []byte {
+	return sequencedMessageOfType(registerMessage, name, port, state, sender, seq)
+}
+
+func TestThatConflictResolverIsRequired(t *testing.T) {
+	_, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithConflictResolver(nil))
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatWithoutResolverEveryHostIsTracked(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Shared", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Shared", 8080, apireg.Serving, uuid.NewString(), 0), otherHookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Shared")) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatKeepExistingDropsSecondHost(t *testing.T) {
+	var conflicts []Conflict
+	r := newResolvingRegistry(t, ConflictResolverFunc(func(c Conflict) ConflictResolution {
+		conflicts = append(conflicts, c)
+		return KeepExisting
+	}))
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Shared", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Shared", 8080, apireg.Serving, uuid.NewString(), 0), otherHookSource, r.groups[0].name)
+
+	apis := r.GetApisByApiName("Shared")
+	if len(apis) != 1 || !apis[0].HostIP().Equal(hookSource.IP) {
+		t.Fail()
+	}
+	if len(conflicts) != 1 || conflicts[0].Kind != ConflictHost || !conflicts[0].Incoming.HostIP().Equal(otherHookSource.IP) {
+		t.Fail()
+	}
+}
+
+func TestThatReplaceMovesSenderToNewPort(t *testing.T) {
+	r := newResolvingRegistry(t, StaticResolution(Replace))
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Moving", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Moving", 9090, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+
+	apis := r.GetApisByApiName("Moving")
+	if len(apis) != 1 || apis[0].HostPort() != 9090 {
+		t.Fail()
+	}
+	if r.metrics.Value("apireg_conflicts_total", map[string]string{"kind": string(ConflictPortChange), "resolution": string(Replace)}) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatKeepBothTracksEveryInstance(t *testing.T) {
+	r := newResolvingRegistry(t, StaticResolution(KeepBoth))
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Moving", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Moving", 9090, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Moving")) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatKeepExistingIgnoresRegressedRefresh(t *testing.T) {
+	r := newSeqKeepingRegistry(t)
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessage("Late", 8080, apireg.Serving, sender, 5), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessage("Late", 8080, apireg.Draining, sender, 4), hookSource, r.groups[0].name)
+
+	apis := r.GetApisByApiName("Late")
+	if len(apis) != 1 || apis[0].State() != apireg.Serving {
+		t.FailNow()
+	}
+	r.handleMessage(sequencedMessage("Late", 8080, apireg.Draining, sender, 6), hookSource, r.groups[0].name)
+	if apis := r.GetApisByApiName("Late"); len(apis) != 1 || apis[0].State() != apireg.Draining {
+		t.Fail()
+	}
+}
+
+func newSeqKeepingRegistry(t *testing.T) *multicastApiRegistry {
+	return newResolvingRegistry(t, ConflictResolverFunc(func(c Conflict) ConflictResolution {
+		if c.Kind == ConflictSeqRegression {
+			return KeepExisting
+		}
+		return KeepBoth
+	}))
+}
+
+func TestThatRegressionIsJudgedPerApi(t *testing.T) {
+	r := newSeqKeepingRegistry(t)
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessage("X", 8080, apireg.Serving, sender, 3), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessage("Y", 8081, apireg.Serving, sender, 5), hookSource, r.groups[0].name)
+	//Newer than anything heard about X even though Y has a later one
+	r.handleMessage(sequencedMessage("X", 8080, apireg.Draining, sender, 4), hookSource, r.groups[0].name)
+
+	if apis := r.GetApisByApiName("X"); len(apis) != 1 || apis[0].State() != apireg.Draining {
+		t.Fail()
+	}
+}
+
+func TestThatDelayedWithdrawalIsCheckedForRegression(t *testing.T) {
+	r := newSeqKeepingRegistry(t)
+	defer r.Close()
+	sender := uuid.NewString()
+
+	r.handleMessage(sequencedMessage("Back", 8080, apireg.Serving, sender, 5), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(withdrawMessage, "Back", 8080, apireg.Serving, sender, 4), hookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Back")) != 1 {
+		t.FailNow()
+	}
+	r.handleMessage(sequencedMessageOfType(withdrawMessage, "Back", 8080, apireg.Serving, sender, 6), hookSource, r.groups[0].name)
+	if len(r.GetApisByApiName("Back")) != 0 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,138 @@
+package multicast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+// ConformanceApi is an Api as it is written out by the conformance suite so other implementations can compare against it
+type ConformanceApi struct {
+	Name     string          `json:"name"`
+	Version  string          `json:"version"`
+	HostIP   string          `json:"host-ip"`
+	HostPort int             `json:"host-port"`
+	State    apireg.ApiState `json:"state"`
+}
+
+// ConformanceStep is one message of a conformance script, as it would arrive on the group from Source, along with every
+// api that should be tracked once it has been handled
+type ConformanceStep struct {
+	Source  string           `json:"source"`
+	Message json.RawMessage  `json:"message"`
+	Expect  []ConformanceApi `json:"expect"`
+}
+
+// conformanceEventJSON is a line written by WithConformanceOutput, without an api for gaps
+type conformanceEventJSON struct {
+	Event apireg.EventType `json:"event"`
+	Api   *ConformanceApi  `json:"api,omitempty"`
+}
+
+func newConformanceApi(a apireg.Api) ConformanceApi {
+	return ConformanceApi{Name: a.Name(), Version: a.Version().String(), HostIP: a.HostIP().String(), HostPort: a.HostPort(), State: a.State()}
+}
+
+// sortConformanceApis orders apis the way they are written in conformance scripts
+func sortConformanceApis(apis []ConformanceApi) {
+	sort.Slice(apis, func(i, j int) bool {
+		if apis[i].Name != apis[j].Name {
+			return apis[i].Name < apis[j].Name
+		} else if apis[i].Version != apis[j].Version {
+			return apis[i].Version < apis[j].Version
+		} else if apis[i].HostIP != apis[j].HostIP {
+			return apis[i].HostIP < apis[j].HostIP
+		}
+		return apis[i].HostPort < apis[j].HostPort
+	})
+}
+
+// LoadConformanceScript reads a conformance script, a JSON array of steps like the ones in testdata/conformance
+func LoadConformanceScript(r io.Reader) ([]ConformanceStep, error) {
+	steps := make([]ConformanceStep, 0)
+	err := json.NewDecoder(r).Decode(&steps)
+
+	if err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// RunConformance hands each step's message to a fresh registry that isn't on any group, returning an error for the first
+// step after which the tracked apis aren't the expected ones. Other implementations can run the same scripts against
+// themselves to prove they speak the same protocol
+func RunConformance(steps []ConformanceStep) error {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for i, curStep := range steps {
+		source := net.ParseIP(curStep.Source)
+		if source == nil {
+			return errors.New(fmt.Sprint("step ", i, " has an invalid source ", curStep.Source))
+		}
+		r.handleMessageRecovered(curStep.Message, &net.UDPAddr{IP: source, Port: DEFAULT_MULTICAST_GROUP_PORT}, r.groups[0].name)
+
+		got := make([]ConformanceApi, 0)
+		for _, curApi := range r.GetAvailableApis() {
+			got = append(got, newConformanceApi(curApi))
+		}
+		expected := append(make([]ConformanceApi, 0, len(curStep.Expect)), curStep.Expect...)
+		sortConformanceApis(got)
+		sortConformanceApis(expected)
+
+		if !reflect.DeepEqual(got, expected) {
+			return errors.New(fmt.Sprint("step ", i, ": expected ", expected, " but got ", got))
+		}
+	}
+	return nil
+}
+
+// WithConformanceOutput writes every change to what the registry tracks to w as a line of JSON, like
+// {"event":"add","api":{...}}, in the order they happened, so that a registry can be run as a test server that alternate
+// implementations announce to and check the output of
+func WithConformanceOutput(w io.Writer) Option {
+	return func(r *multicastApiRegistry) error {
+		if w == nil {
+			return errors.New("w (writer) is required for WithConformanceOutput")
+		}
+		sub, err := r.Subscribe(apireg.WithSlowConsumerPolicy(apireg.Block))
+		if err != nil {
+			return err
+		}
+		r.conformanceEvents = sub
+		r.conformanceEncoder = json.NewEncoder(w)
+		return nil
+	}
+}
+
+// conformanceOutputLoop writes out every event of the conformance subscription until the registry is closed
+func (this *multicastApiRegistry) conformanceOutputLoop(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			this.conformanceEvents.Close()
+			return nil
+		case e := <-this.conformanceEvents.Events():
+			line := &conformanceEventJSON{Event: e.Type()}
+			if e.Api() != nil {
+				api := newConformanceApi(e.Api())
+				line.Api = &api
+			}
+			if err := this.conformanceEncoder.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package multicast
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+var goldenSender = uuid.MustParse("9a0c4f7e-2b1d-4c3a-8e5f-6d7b8a9c0d1e")
+
+// goldenMessages are encoded and compared against testdata/conformance/messages so that any change to the wire format shows up
+var goldenMessages = map[string]*apiRegisterMessageJSON{
+	"register": {Type: registerMessage, ApiName: "orders", ApiVersion: &versionJSON{Major: 1, Minor: 2, BugFix: 3}, ApiPort: 8080,
+		SenderUUID: goldenSender.String(), Environment: apireg.Prod, State: apireg.Serving, Seq: 1, AgentVersion: "0.1.0"},
+	"draining": {Type: registerMessage, ApiName: "orders", ApiVersion: &versionJSON{Major: 1, Minor: 2, BugFix: 3}, ApiPort: 8080,
+		SenderUUID: goldenSender.String(), Environment: apireg.Prod, State: apireg.Draining, Seq: 2, AgentVersion: "0.1.0"},
+	"withdraw": {Type: withdrawMessage, ApiName: "orders", ApiVersion: &versionJSON{Major: 1, Minor: 2, BugFix: 3}, ApiPort: 8080,
+		SenderUUID: goldenSender.String(), Environment: apireg.Prod, State: apireg.Serving, Seq: 3, AgentVersion: "0.1.0"},
+	"ping": {Type: pingMessage, SenderUUID: goldenSender.String(), Environment: apireg.Prod, Nonce: 42, AgentVersion: "0.1.0"},
+}
+
+func TestThatEncodedMessagesMatchGoldenFixtures(t *testing.T) {
+	r := &multicastApiRegistry{codec: plainCodec{}, maxPayload: registrationMessageSizeBytes}
+	for curName, curMessage := range goldenMessages {
+		encoded, err := r.encodePayload(curMessage)
+		failOnErr(err, t)
+		golden, err := os.ReadFile(filepath.Join("testdata", "conformance", "messages", curName+".json"))
+		failOnErr(err, t)
+
+		if !bytes.Equal(encoded, golden) {
+			t.Error(curName, "encoded as", string(encoded), "instead of", string(golden))
+		}
+	}
+}
+
+func TestThatConformanceScriptPasses(t *testing.T) {
+	script, err := os.Open(filepath.Join("testdata", "conformance", "script.json"))
+	failOnErr(err, t)
+	defer script.Close()
+	steps, err := LoadConformanceScript(script)
+	failOnErr(err, t)
+
+	failOnErr(RunConformance(steps), t)
+}
+
+func TestThatConformanceReportsStepWithUnexpectedResult(t *testing.T) {
+	steps := []ConformanceStep{{
+		Source:  "10.0.0.1",
+		Message: []byte(`{"api-name":"orders","api-version":{"major":1},"api-port":8080,"sender-uuid":"` + goldenSender.String() + `","env":"prod"}`),
+		Expect:  []ConformanceApi{}}}
+
+	err := RunConformance(steps)
+	if err == nil || !strings.HasPrefix(err.Error(), "step 0") {
+		t.Fail()
+	}
+}
+
+func TestThatConformanceOutputWritesEveryChange(t *testing.T) {
+	out := &syncBuffer{}
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithConformanceOutput(out))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("orders", apireg.NewVersion(1, 2, 3), 8080), t)
+	time.Sleep(time.Millisecond * 50)
+
+	if out.String() != `{"event":"add","api":{"name":"orders","version":"v1.2.3","host-ip":"127.0.0.1","host-port":8080,"state":"serving"}}`+"\n" {
+		t.Error(out.String())
+	}
+}
+
+func TestThatConformanceOutputKeepsChangesInOrder(t *testing.T) {
+	out := &syncBuffer{}
+	reg, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithConformanceOutput(out))
+	failOnErr(err, t)
+	defer reg.Close()
+	r := reg.(*multicastApiRegistry)
+	sender := uuid.NewString()
+
+	for i := 0; i < 20; i++ {
+		r.handleMessage(sequencedMessageOfType(registerMessage, "orders", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+		r.handleMessage(sequencedMessageOfType(withdrawMessage, "orders", 8080, apireg.Serving, sender, 0), hookSource, r.groups[0].name)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 40 {
+		t.FailNow()
+	}
+	for i, curLine := range lines {
+		if (i%2 == 0) != strings.HasPrefix(curLine, `{"event":"add"`) {
+			t.Fail()
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read from different goroutines
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (this *syncBuffer) Write(p []byte) (int, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.Write(p)
+}
+
+func (this *syncBuffer) String() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.String()
+}
@@ -0,0 +1,88 @@
+package multicast
+
+import (
+	"errors"
+	"net"
+)
+
+// controlHandler handles a control message that has passed the same checks as announcements
+type controlHandler func(message *apiRegisterMessageJSON, rAddr *net.UDPAddr)
+
+// WithControlGroup sends control traffic that goes to the whole group, like queries and digests, on its own group so it
+// can be rate limited and filtered apart from announcements. The registry listens on both, only taking control messages
+// from the control group, and still accepts control messages on the announcement group from registries without it
+func WithControlGroup(addr *net.UDPAddr) Option {
+	return func(r *multicastApiRegistry) error {
+		if addr == nil || !addr.IP.IsMulticast() {
+			return errors.New("addr must be a multicast group for WithControlGroup")
+		}
+		r.controlAddr = addr
+		return nil
+	}
+}
+
+// joinControlGroup sets up the control group if there is one, sharing the socket options of the announcement group
+func (this *multicastApiRegistry) joinControlGroup() error {
+	if this.controlAddr == nil {
+		return nil
+	}
+	udpTransport, isUDP := this.transport.(*udpMulticastTransport)
+	if !isUDP {
+		return errors.New("WithControlGroup only applies to multicast groups and can't be used along with WithBroker")
+	}
+	this.controlGroup = newGroupMembership(this.controlAddr.String(), &udpMulticastTransport{addr: this.controlAddr, reuse: udpTransport.reuse})
+	_, err := this.controlGroup.Conn()
+	return err
+}
+
+// writeControl sends a control message to the control group, or the announcement group without one. Control messages
+// aren't sequenced so that they never look like loss on the announcement group
+func (this *multicastApiRegistry) writeControl(message *apiRegisterMessageJSON) error {
+	this.stampControl(message)
+	datagrams, err := this.encodeDatagrams(message)
+
+	if err != nil {
+		return err
+	}
+	this.waitForBudget(datagrams)
+	for _, curDatagram := range datagrams {
+		if this.controlGroup != nil {
+			err = this.controlGroup.transport.Write(curDatagram)
+		} else {
+			err = this.transport.Write(curDatagram)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err == nil {
+		this.metrics.Add("apireg_sent_control_messages_total", "Number of control messages sent", map[string]string{"type": string(message.Type)}, 1)
+	}
+	return err
+}
+
+// stampControl fills in who a control message is from
+func (this *multicastApiRegistry) stampControl(message *apiRegisterMessageJSON) {
+	message.SenderUUID = this.id.String()
+	message.Environment = this.environment
+	message.AgentVersion = AGENT_VERSION
+	message.ConfigDigest = this.configDigest
+	message.UnicastPort = this.unicastPort()
+}
+
+// handleControl hands message to its control handler returning false if it isn't a control message. Anything else heard
+// on the control group is dropped so announcements sent there by mistake don't get mixed in
+func (this *multicastApiRegistry) handleControl(message *apiRegisterMessageJSON, rAddr *net.UDPAddr, group string) bool {
+	handler, isControl := this.controlHandlers[message.Type]
+
+	if isControl {
+		this.metrics.Add("apireg_control_messages_total", "Number of control messages received", map[string]string{"type": string(message.Type)}, 1)
+		handler(message, rAddr)
+		return true
+	} else if this.controlGroup != nil && group == this.controlGroup.name {
+		this.metrics.Add("apireg_control_group_rejected_total", "Number of messages heard on the control group that weren't control messages", nil, 1)
+		return true
+	}
+	return false
+}
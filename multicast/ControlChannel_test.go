@@ -0,0 +1,105 @@
+package multicast
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+const testControlMessage messageType = "test-control"
+
+var testControlGroup = &net.UDPAddr{IP: net.ParseIP("224.0.0.80"), Port: 5327}
+
+func TestThatControlMessagesAreOnlyHeardByRegistriesOnTheControlGroup(t *testing.T) {
+	sender, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithControlGroup(testControlGroup))
+	failOnErr(err, t)
+	defer sender.Close()
+	receiver, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithControlGroup(testControlGroup))
+	failOnErr(err, t)
+	defer receiver.Close()
+	dataOnly, err := newMulticastApiRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer dataOnly.Close()
+
+	received := &atomic.Int32{}
+	receiver.controlHandlers[testControlMessage] = func(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+		received.Add(1)
+	}
+	dataOnlyReceived := &atomic.Int32{}
+	dataOnly.controlHandlers[testControlMessage] = func(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+		dataOnlyReceived.Add(1)
+	}
+	go receiver.Run(context.Background())
+
+	failOnErr(sender.writeControl(&apiRegisterMessageJSON{Type: testControlMessage}), t)
+	time.Sleep(time.Millisecond * 200)
+
+	if received.Load() != 1 || dataOnlyReceived.Load() != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatControlMessagesOnTheAnnouncementGroupAreStillHandled(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithControlGroup(testControlGroup))
+	failOnErr(err, t)
+	defer r.Close()
+	received := &atomic.Int32{}
+	r.controlHandlers[testControlMessage] = func(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+		received.Add(1)
+	}
+	message := []byte(`{"type":"test-control","sender-uuid":"` + uuid.NewString() + `"}`)
+
+	r.handleMessage(message, &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5324}, r.groups[0].name)
+
+	if received.Load() != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatAnnouncementsOnTheControlGroupAreDropped(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithControlGroup(testControlGroup))
+	failOnErr(err, t)
+	defer r.Close()
+	message := []byte(`{"type":"register","api-name":"Misplaced","api-version":{"major":0,"minor":0,"bugfix":1},"api-port":9420,"sender-uuid":"` + uuid.NewString() + `"}`)
+
+	r.handleMessage(message, &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5327}, r.controlGroup.name)
+
+	if len(r.GetApisByApiName("Misplaced")) != 0 {
+		t.Fail()
+	}
+	//The same announcement is tracked when it arrives where it belongs
+	r.handleMessage(message, &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5324}, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Misplaced")) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWithControlGroupCantBeUsedWithBroker(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithControlGroup(testControlGroup))
+	if err == nil {
+		r.Close()
+		t.Fail()
+	}
+}
+
+func TestThatControlMessagesTakeFromTheSendBudget(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSendBudget(0, 2))
+	failOnErr(err, t)
+	defer r.Close()
+
+	start := time.Now()
+	//The first two fit in the burst, the third has to wait on the budget
+	for i := 0; i < 3; i++ {
+		failOnErr(r.writeControl(&apiRegisterMessageJSON{Type: testControlMessage}), t)
+	}
+
+	if time.Since(start) < time.Millisecond*400 {
+		t.Fail()
+	}
+}
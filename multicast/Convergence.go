@@ -0,0 +1,129 @@
+package multicast
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Upper bounds in seconds of the buckets convergence times are counted in
+var convergenceBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// WithConvergenceTracking has every registration, drain and withdrawal we announce ask the registries that apply it to echo
+// it back so that the time it takes to show up on each of them is counted in the apireg_convergence_seconds histogram.
+// Registries echo without any option set, only the announcing side needs this
+func WithConvergenceTracking() Option {
+	return func(r *multicastApiRegistry) error {
+		r.convergence = newSyncConvergenceTracker()
+		return nil
+	}
+}
+
+type pendingChange struct {
+	sent   time.Time
+	echoed bool
+	//Set once the change has been counted as not echoed so the heartbeat only hears about it once
+	counted bool
+}
+
+// syncConvergenceTracker remembers when each change we announced was sent until the echoes for it stop coming in
+type syncConvergenceTracker struct {
+	pending      map[uint64]*pendingChange
+	pendingMutex *sync.Mutex
+}
+
+func newSyncConvergenceTracker() *syncConvergenceTracker {
+	t := &syncConvergenceTracker{}
+	t.pending = make(map[uint64]*pendingChange)
+	t.pendingMutex = &sync.Mutex{}
+
+	return t
+}
+
+// Track records that the change was announced at t
+func (this *syncConvergenceTracker) Track(change uint64, t time.Time) {
+	this.pendingMutex.Lock()
+	this.pending[change] = &pendingChange{sent: t}
+	this.pendingMutex.Unlock()
+}
+
+// Echoed returns how long it took change to be applied by a peer that echoed it back at t, false if it isn't being tracked.
+// Changes stay tracked as every peer echoes them
+func (this *syncConvergenceTracker) Echoed(change uint64, t time.Time) (time.Duration, bool) {
+	this.pendingMutex.Lock()
+	defer this.pendingMutex.Unlock()
+	pending, tracked := this.pending[change]
+
+	if !tracked {
+		return 0, false
+	}
+	pending.echoed = true
+	return t.Sub(pending.sent), true
+}
+
+// TakeUnechoed returns how many changes announced before t haven't been echoed by anyone, counting each change only once
+func (this *syncConvergenceTracker) TakeUnechoed(t time.Time) int {
+	this.pendingMutex.Lock()
+	defer this.pendingMutex.Unlock()
+	unechoed := 0
+	for _, curPending := range this.pending {
+		if !curPending.echoed && !curPending.counted && curPending.sent.Before(t) {
+			curPending.counted = true
+			unechoed++
+		}
+	}
+	return unechoed
+}
+
+// PurgeBefore stops tracking every change announced before t
+func (this *syncConvergenceTracker) PurgeBefore(t time.Time) {
+	this.pendingMutex.Lock()
+	for curChange, curPending := range this.pending {
+		if curPending.sent.Before(t) {
+			delete(this.pending, curChange)
+		}
+	}
+	this.pendingMutex.Unlock()
+}
+
+// trackChange stamps message as a change to be echoed if we are tracking convergence
+func (this *multicastApiRegistry) trackChange(message *apiRegisterMessageJSON) {
+	if this.convergence == nil || this.unicastConn == nil {
+		return
+	}
+	message.Change = newNonce()
+	this.convergence.Track(message.Change, time.Now())
+}
+
+// echoChange lets the sender of a change know that we have applied it
+func (this *multicastApiRegistry) echoChange(message *apiRegisterMessageJSON, senderIP net.IP) {
+	if message.Change == 0 || message.UnicastPort == 0 {
+		return
+	}
+	err := this.writeUnicast(ackMessage, message.Change, &net.UDPAddr{IP: senderIP, Port: message.UnicastPort})
+	if err != nil {
+		log.Println("Error echoing change for", message.ApiName, "to", senderIP, err)
+	}
+}
+
+// observeAck counts the time it took for the change echoed back at t to converge
+func (this *multicastApiRegistry) observeAck(change uint64, t time.Time) {
+	took, tracked := this.convergence.Echoed(change, t)
+
+	if !tracked {
+		return
+	}
+	this.reflections.Reflected(1)
+	seconds := took.Seconds()
+	for _, curBucket := range convergenceBuckets {
+		if seconds <= curBucket {
+			this.metrics.Add("apireg_convergence_seconds_bucket", "Number of announced changes applied by a peer within le seconds", map[string]string{"le": strconv.FormatFloat(curBucket, 'f', -1, 64)}, 1)
+		}
+	}
+	this.metrics.Add("apireg_convergence_seconds_bucket", "Number of announced changes applied by a peer within le seconds", map[string]string{"le": "+Inf"}, 1)
+	this.metrics.Add("apireg_convergence_seconds_sum", "Total seconds it took announced changes to be applied by peers", nil, seconds)
+	this.metrics.Add("apireg_convergence_seconds_count", "Number of times a peer applied one of our announced changes", nil, 1)
+	this.metrics.Set("apireg_convergence_last_seconds", "Seconds it took the last announced change to be applied by a peer", nil, seconds)
+}
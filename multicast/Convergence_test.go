@@ -0,0 +1,100 @@
+package multicast
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatEchoedChangeReportsHowLongItTook(t *testing.T) {
+	c := newSyncConvergenceTracker()
+	sent := time.Now()
+	c.Track(7, sent)
+
+	took, tracked := c.Echoed(7, sent.Add(time.Millisecond*20))
+
+	if !tracked || took != time.Millisecond*20 {
+		t.Fail()
+	}
+}
+
+func TestThatPurgedChangeIsNoLongerTracked(t *testing.T) {
+	c := newSyncConvergenceTracker()
+	sent := time.Now()
+	c.Track(7, sent)
+
+	c.PurgeBefore(sent.Add(time.Second))
+
+	if _, tracked := c.Echoed(7, sent.Add(time.Second)); tracked {
+		t.Fail()
+	}
+}
+
+func TestThatChangeNobodyEchoedIsOnlyTakenOnce(t *testing.T) {
+	c := newSyncConvergenceTracker()
+	sent := time.Now()
+	c.Track(7, sent)
+	c.Track(8, sent)
+	c.Echoed(8, sent.Add(time.Millisecond))
+
+	if c.TakeUnechoed(sent.Add(time.Second)) != 1 || c.TakeUnechoed(sent.Add(time.Second)) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatRegistrationEchoedByPeerIsCountedInConvergenceHistogram(t *testing.T) {
+	reg0, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithConvergenceTracking())
+	failOnErr(err, t)
+	go reg0.Run(context.Background())
+	defer reg0.Close()
+
+	//Peers echo without having the option themselves
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer reg1.Close()
+	time.Sleep(time.Millisecond * 50)
+
+	failOnErr(reg0.RegisterApi("Converged", apireg.NewVersion(0, 0, 1), 9408), t)
+	time.Sleep(time.Millisecond * 200)
+
+	if reg0.metrics.Value("apireg_convergence_seconds_count", nil) < 1 || reg0.metrics.Value("apireg_convergence_seconds_bucket", map[string]string{"le": "+Inf"}) < 1 {
+		t.Fail()
+	}
+}
+
+func TestThatRegistrationDroppedByAdmissionHookIsNotEchoed(t *testing.T) {
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	failOnErr(err, t)
+	defer sender.Close()
+	r := newHookedRegistry(t, AdmissionHookFunc(func(reg *InboundRegistration) error {
+		if reg.Name == "Dropped" {
+			return errPortOutOfRange
+		}
+		return nil
+	}))
+	defer r.Close()
+	changed := func(name string) []byte {
+		message := strings.TrimSuffix(string(sequencedMessageOfType(registerMessage, name, 8080, apireg.Serving, uuid.NewString(), 0)), "}")
+		return []byte(message + `,"change":7,"unicast-port":` + strconv.Itoa(sender.LocalAddr().(*net.UDPAddr).Port) + "}")
+	}
+	source := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: DEFAULT_MULTICAST_GROUP_PORT}
+	buffer := make([]byte, 2048)
+
+	r.handleMessage(changed("Dropped"), source, r.groups[0].name)
+	sender.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+	if _, _, err := sender.ReadFromUDP(buffer); err == nil {
+		t.FailNow()
+	}
+	//What was applied is still echoed
+	r.handleMessage(changed("Kept"), source, r.groups[0].name)
+	sender.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := sender.ReadFromUDP(buffer); err != nil {
+		t.Fail()
+	}
+}
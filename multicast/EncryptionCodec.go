@@ -0,0 +1,86 @@
+package multicast
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const aesGCMAlgorithm string = "A-GCM"
+
+type encryptedEnvelopeJSON struct {
+	Algorithm  string `json:"alg"`
+	KeyID      string `json:"kid,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	CipherText []byte `json:"ct"`
+}
+
+// aesGCMCodec encrypts every message with the newest pre-shared key and a random nonce
+type aesGCMCodec struct {
+	keys *keyRing[cipher.AEAD]
+	//Called with the key id of every message decoded
+	observeKey func(kid string)
+}
+
+func newAESGCMCodec(keys []Key, observeKey func(kid string)) (*aesGCMCodec, error) {
+	ring, err := newKeyRing(keys, newAESGCM)
+
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCMCodec{keys: ring, observeKey: observeKey}, nil
+}
+
+func newAESGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (this *aesGCMCodec) Encode(payload []byte) ([]byte, error) {
+	kid, aead := this.keys.Newest()
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &encryptedEnvelopeJSON{Algorithm: aesGCMAlgorithm, KeyID: kid, Nonce: nonce, CipherText: aead.Seal(nil, nonce, payload, nil)}
+	return json.Marshal(envelope)
+}
+
+func (this *aesGCMCodec) Decode(data []byte) ([]byte, error) {
+	envelope := &encryptedEnvelopeJSON{}
+
+	err := json.NewDecoder(bytes.NewReader(data)).Decode(envelope)
+
+	if err != nil {
+		return nil, err
+	} else if envelope.Algorithm != aesGCMAlgorithm {
+		return nil, errors.New("message is not encrypted")
+	}
+
+	aead, contains := this.keys.Get(envelope.KeyID)
+
+	if !contains {
+		return nil, errors.New(fmt.Sprint("message is encrypted with unknown key id ", envelope.KeyID))
+	} else if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, errors.New("message has an invalid nonce")
+	}
+
+	payload, err := aead.Open(nil, envelope.Nonce, envelope.CipherText, nil)
+
+	if err == nil && this.observeKey != nil {
+		this.observeKey(envelope.KeyID)
+	}
+	return payload, err
+}
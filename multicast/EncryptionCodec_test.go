@@ -0,0 +1,94 @@
+package multicast
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestThatNewAESGCMCodecReturnsErrorForBadKeyLength(t *testing.T) {
+	_, err := newAESGCMCodec([]Key{{Secret: []byte("short")}}, nil)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecDecodesWhatItEncodes(t *testing.T) {
+	c, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	payload := []byte(`{"api-name":"Something"}`)
+
+	data, _ := c.Encode(payload)
+	decoded, err := c.Decode(data)
+
+	if err != nil || !bytes.Equal(decoded, payload) {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecDoesNotLeakPayload(t *testing.T) {
+	c, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+
+	data, _ := c.Encode([]byte(`{"api-name":"Something"}`))
+
+	if bytes.Contains(data, []byte("Something")) {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecUsesNewNonceEveryMessage(t *testing.T) {
+	c, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	payload := []byte(`{"api-name":"Something"}`)
+
+	data0, _ := c.Encode(payload)
+	data1, _ := c.Encode(payload)
+
+	if bytes.Equal(data0, data1) {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecRejectsOtherKeys(t *testing.T) {
+	c0, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	c1, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{2}, 32)}}, nil)
+
+	data, _ := c0.Encode([]byte(`{"api-name":"Something"}`))
+
+	if _, err := c1.Decode(data); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecRejectsPlainMessages(t *testing.T) {
+	c, _ := newAESGCMCodec([]Key{{Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+
+	if _, err := c.Decode([]byte(`{"api-name":"Something"}`)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecEncryptsWithNewestKey(t *testing.T) {
+	oldKey := Key{ID: "old", Secret: bytes.Repeat([]byte{1}, 32)}
+	newKey := Key{ID: "new", Secret: bytes.Repeat([]byte{2}, 32)}
+	rotated, _ := newAESGCMCodec([]Key{oldKey, newKey}, nil)
+	onlyNew, _ := newAESGCMCodec([]Key{newKey}, nil)
+
+	data, _ := rotated.Encode([]byte(`{"api-name":"Something"}`))
+
+	if _, err := onlyNew.Decode(data); err != nil {
+		t.Fail()
+	}
+}
+
+func TestThatAESGCMCodecAcceptsAnyConfiguredKey(t *testing.T) {
+	oldKey := Key{ID: "old", Secret: bytes.Repeat([]byte{1}, 32)}
+	newKey := Key{ID: "new", Secret: bytes.Repeat([]byte{2}, 32)}
+	onlyOld, _ := newAESGCMCodec([]Key{oldKey}, nil)
+	var seenKid string
+	rotated, _ := newAESGCMCodec([]Key{oldKey, newKey}, func(kid string) { seenKid = kid })
+
+	data, _ := onlyOld.Encode([]byte(`{"api-name":"Something"}`))
+
+	if _, err := rotated.Decode(data); err != nil || seenKid != "old" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,49 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// WithExpiryWarning sends listeners an ExpiringSoon event for every registration that less than threshold is left of
+// without a refresh having been heard, giving a heads up about a struggling instance before it is gone. It is sent once
+// for each refresh that was missed and every one is counted in apireg_expiring_soon_total
+func WithExpiryWarning(threshold time.Duration) Option {
+	return func(r *multicastApiRegistry) error {
+		if threshold <= 0 {
+			return errors.New("threshold must be > 0 for WithExpiryWarning")
+		} else if threshold >= registrationLifeSpan {
+			return errors.New(fmt.Sprint("threshold must be < ", registrationLifeSpan, " for WithExpiryWarning so registrations aren't warned about as soon as they are heard"))
+		}
+		r.expiryWarning = threshold
+		return nil
+	}
+}
+
+func (this *multicastApiRegistry) expiryWarningLoop(ctx context.Context) error {
+	//Checking a few times within the threshold so the warning still comes well before the registration expires
+	warnTicker := time.NewTicker(min(this.expiryWarning/4, registrationPurgeInterval))
+	defer warnTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-warnTicker.C:
+			this.warnExpiring(t)
+		}
+	}
+}
+
+// warnExpiring lets listeners know about every registration that expires within the threshold of t
+func (this *multicastApiRegistry) warnExpiring(t time.Time) {
+	for _, curReg := range this.apiRegs.getAllRegsForTime(t) {
+		if curReg.WarnExpiring(t, this.expiryWarning) {
+			this.metrics.Add("apireg_expiring_soon_total", "Number of registrations that were close to expiring without a refresh", map[string]string{"api": curReg.Api().Name()}, 1)
+			this.apiRegs.notify(apireg.NewExpiringSoonEvent(curReg.Api()))
+		}
+	}
+}
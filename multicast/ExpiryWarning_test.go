@@ -0,0 +1,50 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatWithExpiryWarningNeedsThresholdUnderLifeSpan(t *testing.T) {
+	if WithExpiryWarning(0)(&multicastApiRegistry{}) == nil || WithExpiryWarning(registrationLifeSpan)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatRegistryWarnsAboutRegistrationCloseToExpiring(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithExpiryWarning(time.Second*20))
+	failOnErr(err, t)
+	defer r.Close()
+	sub, err := r.Subscribe()
+	failOnErr(err, t)
+	defer sub.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Struggling", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	if e := <-sub.Events(); e.Type() != apireg.Added {
+		t.FailNow()
+	}
+	//Nothing is close yet so nothing is sent
+	r.warnExpiring(time.Now())
+	r.warnExpiring(time.Now().Add(registrationLifeSpan - time.Second*10))
+	r.warnExpiring(time.Now().Add(registrationLifeSpan - time.Second*5))
+
+	select {
+	case e := <-sub.Events():
+		if e.Type() != apireg.ExpiringSoon || e.Api().Name() != "Struggling" {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+	select {
+	case <-sub.Events():
+		t.Fail()
+	case <-time.After(time.Millisecond * 50):
+	}
+	if r.metrics.Value("apireg_expiring_soon_total", map[string]string{"api": "Struggling"}) != 1 {
+		t.Fail()
+	}
+}
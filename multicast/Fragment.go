@@ -0,0 +1,141 @@
+package multicast
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//Most fragments a message is split into, anything that needs more is too big to send
+	maxFragments int = 32
+	//How long the fragments of a message are kept waiting on the rest before they are thrown away
+	fragmentReassemblyTimeout time.Duration = time.Second * 5
+	//Most messages being put back together at once so a flood of partial messages can't use up memory
+	maxPendingReassemblies int = 256
+)
+
+// fragmentJSON is one piece of an encoded message that didn't fit in a single datagram
+type fragmentJSON struct {
+	//ID is unique to the sender among the messages it fragmented
+	ID    uint64 `json:"id"`
+	Index int    `json:"index"`
+	Count int    `json:"count"`
+	Data  []byte `json:"data"`
+}
+
+// fragmentPayload splits payload, the json of message, into datagrams of fragment messages that each fit in maxPayload
+func (this *multicastApiRegistry) fragmentPayload(message *apiRegisterMessageJSON, payload []byte) ([][]byte, error) {
+	//Encoding a fragment with no data tells us how much room the envelope and codec take up, the rest is for data which
+	//grows by a third being base64 encoded
+	//Control messages and unicast answers aren't sequenced so fragmented messages get their own ids
+	id := atomic.AddUint64(&this.fragmentSeq, 1)
+	empty, err := this.encodeFragment(message, &fragmentJSON{ID: id, Index: maxFragments, Count: maxFragments})
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := (this.maxPayload - len(empty)) / 4 * 3
+	if chunkSize <= 0 || (len(payload)+chunkSize-1)/chunkSize > maxFragments {
+		return nil, errors.New(fmt.Sprint("Message size for ", message.ApiName, " exceeds max length of ", maxFragments, " fragments of ", this.maxPayload, " bytes"))
+	}
+
+	count := (len(payload) + chunkSize - 1) / chunkSize
+	datagrams := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := payload[i*chunkSize : min((i+1)*chunkSize, len(payload))]
+		datagram, err := this.encodeFragment(message, &fragmentJSON{ID: id, Index: i, Count: count, Data: chunk})
+		if err != nil {
+			return nil, err
+		}
+		datagrams = append(datagrams, datagram)
+	}
+	this.metrics.Add("apireg_fragmented_messages_total", "Number of messages split into fragments for being bigger than a datagram", nil, 1)
+	return datagrams, nil
+}
+
+func (this *multicastApiRegistry) encodeFragment(message *apiRegisterMessageJSON, f *fragmentJSON) ([]byte, error) {
+	return this.encodePayload(&apiRegisterMessageJSON{Type: fragmentMessage, ApiName: message.ApiName, SenderUUID: message.SenderUUID,
+		Environment: message.Environment, Fragment: f})
+}
+
+// handleFragment holds on to a fragment until the rest of its message arrives and then handles the whole message
+func (this *multicastApiRegistry) handleFragment(message *apiRegisterMessageJSON, keyID string, rAddr *net.UDPAddr, group string) {
+	payload, complete, err := this.fragments.Add(message.SenderUUID, rAddr.String(), keyID, message.Fragment, time.Now())
+	if err != nil {
+		this.metrics.Add("apireg_fragments_dropped_total", "Number of received fragments that couldn't be put back into a message", nil, 1)
+		log.Println("Error reassembling message from", rAddr, err)
+		return
+	} else if complete {
+		this.metrics.Add("apireg_reassembled_messages_total", "Number of received messages put back together from fragments", nil, 1)
+		this.handlePayload(payload, keyID, rAddr, group)
+	}
+}
+
+type pendingMessage struct {
+	//Key id the fragments were signed with, which every one of them has to agree on
+	keyID    string
+	parts    [][]byte
+	received int
+	started  time.Time
+}
+
+// syncFragmentStore puts the fragments of messages back together, by sender, where they were sent from and message
+type syncFragmentStore struct {
+	pending map[string]*pendingMessage
+	mutex   *sync.Mutex
+}
+
+func newSyncFragmentStore() *syncFragmentStore {
+	s := &syncFragmentStore{}
+	s.pending = make(map[string]*pendingMessage)
+	s.mutex = &sync.Mutex{}
+
+	return s
+}
+
+// Add records fragment f from sender at source, signed with keyID, at t. It returns the whole message and true once every
+// one of its fragments is in. Fragments are only put together with others from the same source signed with the same key so
+// that no one can splice their own into someone else's message
+func (this *syncFragmentStore) Add(sender, source, keyID string, f *fragmentJSON, t time.Time) ([]byte, bool, error) {
+	if f.Count < 2 || f.Count > maxFragments || f.Index < 0 || f.Index >= f.Count {
+		return nil, false, errors.New(fmt.Sprint("fragment ", f.Index, " of ", f.Count, " is out of range"))
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for curKey, curPending := range this.pending {
+		if t.Sub(curPending.started) > fragmentReassemblyTimeout {
+			delete(this.pending, curKey)
+		}
+	}
+
+	key := fmt.Sprint(sender, "/", source, "/", f.ID)
+	p, started := this.pending[key]
+	if !started {
+		if len(this.pending) >= maxPendingReassemblies {
+			return nil, false, errors.New("too many messages are already being reassembled")
+		}
+		p = &pendingMessage{keyID: keyID, parts: make([][]byte, f.Count), started: t}
+		this.pending[key] = p
+	} else if len(p.parts) != f.Count {
+		delete(this.pending, key)
+		return nil, false, errors.New(fmt.Sprint("fragments of message ", f.ID, " disagree on how many there are"))
+	} else if p.keyID != keyID {
+		delete(this.pending, key)
+		return nil, false, errors.New(fmt.Sprint("fragments of message ", f.ID, " are signed with different keys"))
+	}
+	//A repeated fragment changes nothing
+	if p.parts[f.Index] == nil {
+		p.parts[f.Index] = f.Data
+		p.received++
+	}
+	if p.received < f.Count {
+		return nil, false, nil
+	}
+	delete(this.pending, key)
+	return bytes.Join(p.parts, nil), true, nil
+}
@@ -0,0 +1,168 @@
+package multicast
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatFragmentsAreReassembledInAnyOrder(t *testing.T) {
+	s := newSyncFragmentStore()
+	now := time.Now()
+
+	if _, complete, err := s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 1, Count: 2, Data: []byte("world")}, now); err != nil || complete {
+		t.FailNow()
+	}
+	//Hearing the same fragment twice changes nothing
+	s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 1, Count: 2, Data: []byte("world")}, now)
+	payload, complete, err := s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 0, Count: 2, Data: []byte("hello ")}, now)
+	if err != nil || !complete || string(payload) != "hello world" || len(s.pending) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatFragmentsOutOfRangeAreRejected(t *testing.T) {
+	s := newSyncFragmentStore()
+
+	if _, _, err := s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 2, Count: 2}, time.Now()); err == nil {
+		t.Fail()
+	}
+	if _, _, err := s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 0, Count: maxFragments + 1}, time.Now()); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatStaleFragmentsAreThrownAway(t *testing.T) {
+	s := newSyncFragmentStore()
+	now := time.Now()
+
+	s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 0, Count: 2, Data: []byte("hello ")}, now)
+	if _, complete, _ := s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 1, Count: 2, Data: []byte("world")}, now.Add(fragmentReassemblyTimeout*2)); complete {
+		t.Fail()
+	}
+}
+
+func TestThatWithMTUNeedsUsableMTU(t *testing.T) {
+	if WithMTU(100)(&multicastApiRegistry{}) == nil || WithMTU(maxDatagramSizeBytes+udpIPv4HeaderBytes+1)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatReceiveBufferSmallerThanPayloadIsAnError(t *testing.T) {
+	_, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithMTU(9000), WithReceiveBufferSize(registrationMessageSizeBytes))
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatMTUSizesPayloadAndReceiveBuffer(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithMTU(9000))
+	failOnErr(err, t)
+	defer r.Close()
+
+	if r.maxPayload != 9000-udpIPv4HeaderBytes || r.receiveBufferSize != r.maxPayload {
+		t.Fail()
+	}
+}
+
+// bigTags are enough tags that announcing them takes several datagrams at the smallest MTU
+func bigTags(n int) map[string]string {
+	tags := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		tags[fmt.Sprint("tag-", i)] = strings.Repeat("x", 64)
+	}
+	return tags
+}
+
+func TestThatMessagesBiggerThanDatagramAreFragmented(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Fragmented", apireg.NewVersion(0, 0, 1), 9470, apireg.WithTags(bigTags(20))), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("Fragmented")
+	if len(apis) != 1 || len(apis[0].Tags()) != 20 {
+		t.FailNow()
+	}
+	if reg0.(*multicastApiRegistry).metrics.Value("apireg_fragmented_messages_total", nil) == 0 || reg1.(*multicastApiRegistry).metrics.Value("apireg_reassembled_messages_total", nil) == 0 {
+		t.Fail()
+	}
+}
+
+func TestThatMessageNeedingTooManyFragmentsIsAnError(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer r.Close()
+
+	if r.RegisterApi("Huge", apireg.NewVersion(0, 0, 1), 9471, apireg.WithTags(bigTags(500))) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatBigUnicastAnswersAreFragmented(t *testing.T) {
+	b := NewBroker()
+	owner, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer owner.Close()
+	go owner.Run(context.Background())
+	failOnErr(owner.RegisterApi("Queried", apireg.NewVersion(0, 0, 1), 9472, apireg.WithTags(bigTags(20))), t)
+	consumer, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithNameQueries(), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), queryRetryInterval/2)
+	defer cancel()
+
+	apis, err := consumer.WaitForApi(ctx, "Queried")
+	if err != nil || len(apis) != 1 || len(apis[0].Tags()) != 20 {
+		t.Fail()
+	}
+}
+
+func TestThatBigControlMessagesAreFragmented(t *testing.T) {
+	b := NewBroker()
+	reg0, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithMTU(minMTU))
+	failOnErr(err, t)
+	defer reg1.Close()
+	color := strings.Repeat("green", 200)
+
+	failOnErr(reg0.SetActiveColor("Checkout", color), t)
+	time.Sleep(time.Millisecond * 50)
+
+	if reg1.ActiveColor("Checkout") != color || reg0.metrics.Value("apireg_fragmented_messages_total", nil) == 0 {
+		t.Fail()
+	}
+}
+
+func TestThatFragmentsSignedWithDifferentKeysAreDropped(t *testing.T) {
+	s := newSyncFragmentStore()
+	now := time.Now()
+
+	s.Add("sender", "10.0.0.2:5324", "a", &fragmentJSON{ID: 1, Index: 0, Count: 2, Data: []byte("hello ")}, now)
+	if _, complete, err := s.Add("sender", "10.0.0.2:5324", "b", &fragmentJSON{ID: 1, Index: 1, Count: 2, Data: []byte("world")}, now); err == nil || complete || len(s.pending) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatFragmentsFromDifferentSourcesAreNotJoined(t *testing.T) {
+	s := newSyncFragmentStore()
+	now := time.Now()
+
+	s.Add("sender", "10.0.0.2:5324", "", &fragmentJSON{ID: 1, Index: 0, Count: 2, Data: []byte("hello ")}, now)
+	if _, complete, _ := s.Add("sender", "10.0.0.9:5324", "", &fragmentJSON{ID: 1, Index: 1, Count: 2, Data: []byte("world")}, now); complete {
+		t.Fail()
+	}
+}
@@ -0,0 +1,75 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// WithAdditionalGroups has the registry also listen on groups, for sites that split discovery up by team or environment
+// over different group addresses. Apis are tagged with the group they were heard on, see apireg.Api.Group and
+// GetApisByGroup. Our own apis are still only announced on the group the registry was created with
+func WithAdditionalGroups(groups ...*net.UDPAddr) Option {
+	return func(r *multicastApiRegistry) error {
+		for _, curGroup := range groups {
+			if curGroup == nil || !curGroup.IP.IsMulticast() {
+				return errors.New(fmt.Sprint(curGroup, " is not a multicast group for WithAdditionalGroups"))
+			}
+		}
+		r.additionalGroups = append(r.additionalGroups, groups...)
+		return nil
+	}
+}
+
+// groupMembership is one group the registry listens on, joining it again whenever the connection is lost
+type groupMembership struct {
+	//name is what apis heard on the group are tagged with
+	name      string
+	transport transport
+	conn      groupConn
+	connMutex sync.Mutex
+	//Once the registry is shutting down the connection should never be opened again
+	closed bool
+}
+
+func newGroupMembership(name string, t transport) *groupMembership {
+	return &groupMembership{name: name, transport: t}
+}
+
+// Conn returns the connection to the group, joining it if the last connection was lost
+func (this *groupMembership) Conn() (groupConn, error) {
+	this.connMutex.Lock()
+	defer this.connMutex.Unlock()
+
+	if this.closed {
+		return nil, net.ErrClosed
+	} else if this.conn == nil {
+		conn, err := this.transport.Listen()
+
+		if err != nil {
+			return nil, err
+		}
+		this.conn = conn
+	}
+	return this.conn, nil
+}
+
+// Drop throws away conn if it is still the current connection so that the next call to Conn joins the group again
+func (this *groupMembership) Drop(conn groupConn) {
+	this.connMutex.Lock()
+	if this.conn == conn {
+		this.conn = nil
+	}
+	this.connMutex.Unlock()
+}
+
+func (this *groupMembership) Close() {
+	this.connMutex.Lock()
+	this.closed = true
+	if this.conn != nil {
+		this.conn.Close()
+		this.conn = nil
+	}
+	this.connMutex.Unlock()
+}
@@ -0,0 +1,70 @@
+package multicast
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatRegistryListeningOnSeveralGroupsTagsApisWithTheirGroup(t *testing.T) {
+	otherGroup := &net.UDPAddr{IP: net.ParseIP("224.0.0.79"), Port: 5326}
+	defaultReg, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer defaultReg.Close()
+	otherReg, err := NewMulticastRegistry(otherGroup, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer otherReg.Close()
+
+	bothReg, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithAdditionalGroups(otherGroup))
+	failOnErr(err, t)
+	defer bothReg.Close()
+
+	failOnErr(defaultReg.RegisterApi("GroupedDefault", apireg.NewVersion(0, 0, 1), 9410), t)
+	failOnErr(otherReg.RegisterApi("GroupedOther", apireg.NewVersion(0, 0, 1), 9411), t)
+	time.Sleep(time.Millisecond * 200)
+
+	others := bothReg.GetApisByGroup(otherGroup.String())
+	if len(others) != 1 || others[0].Name() != "GroupedOther" {
+		t.Fail()
+	}
+	defaults := bothReg.GetApisByApiName("GroupedDefault")
+	if len(defaults) != 1 || defaults[0].Group() != DEFAULT_MULTICAST_GROUP_IP+":5324" {
+		t.Fail()
+	}
+	//The registry on just the default group never hears the other one
+	if len(defaultReg.GetApisByApiName("GroupedOther")) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatWithAdditionalGroupsReturnsErrorForNonMulticastAddress(t *testing.T) {
+	if WithAdditionalGroups(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5324})(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatClosedGroupMembershipIsNeverJoinedAgain(t *testing.T) {
+	g := newGroupMembership("broker", NewBroker())
+	_, err := g.Conn()
+	failOnErr(err, t)
+
+	g.Close()
+
+	if _, err := g.Conn(); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatApiHeardOnAnotherGroupIsChanged(t *testing.T) {
+	old, err := apireg.NewApi("Regrouped", apireg.NewVersion(0, 0, 1), uuid.New(), apireg.All, net.ParseIP("10.0.0.2"), 9412, apireg.WithGroup("224.0.0.78:5324"))
+	failOnErr(err, t)
+	updated, err := apireg.CloneApi(old, apireg.WithGroup("224.0.0.79:5326"))
+	failOnErr(err, t)
+
+	if !apiChanged(old, updated) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,59 @@
+package multicast
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinHeartbeatInterval time.Duration = time.Second * 5
+	//Never let peers go more than this long without hearing from us so that a couple of lost messages don't expire us
+	defaultMaxHeartbeatInterval time.Duration = registrationLifeSpan / 3
+	//Any more of what peers tell us showing they are missing our announcements than this and we start announcing faster
+	heartbeatUnreflectedThreshold float64 = 0.05
+)
+
+// heartbeat is the interval owned registrations are resent at. It speeds up when peers show they are missing what we
+// announced and slowly backs off towards its max while they show they have all of it
+type heartbeat struct {
+	interval      time.Duration
+	min           time.Duration
+	max           time.Duration
+	intervalMutex *sync.Mutex
+}
+
+func newHeartbeat(start, min, max time.Duration) *heartbeat {
+	h := &heartbeat{min: min, max: max, intervalMutex: &sync.Mutex{}}
+	h.interval = h.clamp(start)
+
+	return h
+}
+
+func (this *heartbeat) Interval() time.Duration {
+	this.intervalMutex.Lock()
+	defer this.intervalMutex.Unlock()
+	return this.interval
+}
+
+// Adjust moves the interval based on the ratio of signals from peers since the last adjustment that showed them missing
+// what we announced and returns the new interval
+func (this *heartbeat) Adjust(unreflected float64) time.Duration {
+	this.intervalMutex.Lock()
+	defer this.intervalMutex.Unlock()
+
+	if unreflected > heartbeatUnreflectedThreshold {
+		this.interval = this.clamp(this.interval / 2)
+	} else if unreflected == 0 {
+		this.interval = this.clamp(this.interval + this.interval/4)
+	}
+	return this.interval
+}
+
+func (this *heartbeat) clamp(d time.Duration) time.Duration {
+	if d < this.min {
+		return this.min
+	} else if d > this.max {
+		return this.max
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+package multicast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatNewHeartbeatClampsStartToBounds(t *testing.T) {
+	h := newHeartbeat(time.Second, time.Second*5, time.Second*20)
+
+	if h.Interval() != time.Second*5 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatSpeedsUpWhenAnnouncementsAreNotReflected(t *testing.T) {
+	h := newHeartbeat(time.Second*16, time.Second*5, time.Second*20)
+
+	if h.Adjust(0.5) != time.Second*8 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatNeverGoesBelowMin(t *testing.T) {
+	h := newHeartbeat(time.Second*6, time.Second*5, time.Second*20)
+
+	if h.Adjust(0.5) != time.Second*5 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatBacksOffWhenAnnouncementsAreReflected(t *testing.T) {
+	h := newHeartbeat(time.Second*8, time.Second*5, time.Second*20)
+
+	if h.Adjust(0) != time.Second*10 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatNeverGoesAboveMax(t *testing.T) {
+	h := newHeartbeat(time.Second*18, time.Second*5, time.Second*20)
+
+	if h.Adjust(0) != time.Second*20 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatHoldsWhenFewAnnouncementsAreNotReflected(t *testing.T) {
+	h := newHeartbeat(time.Second*10, time.Second*5, time.Second*20)
+
+	if h.Adjust(heartbeatUnreflectedThreshold/2) != time.Second*10 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatSpeedsUpWhenPeerDigestMissesOurAnnouncement(t *testing.T) {
+	owner, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithKnownAnswerSuppression())
+	failOnErr(err, t)
+	defer owner.Close()
+	go owner.Run(context.Background())
+	peer := uuid.New()
+	owner.peers.Heard(peer, hookSource.IP, "", "", apireg.All, 0, time.Now())
+
+	failOnErr(owner.RegisterApi("Unreflected", apireg.NewVersion(0, 0, 1), 9431), t)
+	time.Sleep(time.Millisecond * 50)
+	owner.handleDigest(&apiRegisterMessageJSON{SenderUUID: peer.String(), Digests: map[string]uint64{owner.id.String(): 42}}, hookSource)
+	before := owner.heartbeat.Interval()
+	owner.startResendCycle(before)
+
+	if owner.adjustHeartbeat() >= before || owner.metrics.Value("apireg_unreflected_ratio", nil) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatHeartbeatHoldsWithoutSignalsAboutOurAnnouncements(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	before := r.heartbeat.Interval()
+
+	if r.adjustHeartbeat() != before {
+		t.Fail()
+	}
+}
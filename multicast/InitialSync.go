@@ -0,0 +1,138 @@
+package multicast
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	//The initial sync is settled once nothing new has been heard for this long after asking for everything
+	initialSyncQuietPeriod time.Duration = time.Millisecond * 500
+	//Longest the initial sync waits on answers, by which point every peer will have resent its apis anyway
+	initialSyncTimeout time.Duration = registrationUpdateInterval
+	//Answers to a sync request are spread out over up to this long so a registry starting up isn't hit by every peer at once
+	syncAnswerJitter time.Duration = time.Millisecond * 200
+)
+
+// initialSync is the startup barrier WaitForInitialSync waits on
+type initialSync struct {
+	//When peers were asked for everything they have, which is where the sync starts
+	asked     time.Time
+	lastAdded time.Time
+	settled   chan struct{}
+	once      sync.Once
+	mutex     *sync.Mutex
+}
+
+func newInitialSync() *initialSync {
+	return &initialSync{settled: make(chan struct{}), mutex: &sync.Mutex{}}
+}
+
+func (this *initialSync) Asked(t time.Time) {
+	this.mutex.Lock()
+	this.asked = t
+	this.mutex.Unlock()
+}
+
+// Added records that a registration we didn't know about was heard at t
+func (this *initialSync) Added(t time.Time) {
+	this.mutex.Lock()
+	this.lastAdded = t
+	this.mutex.Unlock()
+}
+
+// QuietSince returns true if nothing new has been heard since t
+func (this *initialSync) QuietSince(t time.Time) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.lastAdded.Before(t)
+}
+
+// Settle lets everyone waiting go, returning how long the sync took or false if it had already settled
+func (this *initialSync) Settle(t time.Time) (time.Duration, bool) {
+	settled := false
+	this.once.Do(func() {
+		close(this.settled)
+		settled = true
+	})
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return t.Sub(this.asked), settled
+}
+
+// WaitForInitialSync blocks until the registry has heard what its peers had registered when it started, either from a
+// snapshot or from their answers to the sync request sent by Run, so that an application can hold off serving traffic until
+// its view of its dependencies is filled in. Answers have settled once none are new for half a second, or after a
+// heartbeat at the latest. Returns the error of ctx if it is done first
+func (this *multicastApiRegistry) WaitForInitialSync(ctx context.Context) error {
+	select {
+	case <-this.initialSync.settled:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// initialSyncLoop asks every peer for everything they have registered and settles the initial sync once the answers stop
+func (this *multicastApiRegistry) initialSyncLoop(ctx context.Context) error {
+	asked := time.Now()
+	this.initialSync.Asked(asked)
+	if err := this.writeControl(&apiRegisterMessageJSON{Type: syncMessage}); err != nil {
+		log.Println("Error asking peers for their apis", err)
+	}
+
+	quietTicker := time.NewTicker(initialSyncQuietPeriod / 4)
+	defer quietTicker.Stop()
+	timeout := time.NewTimer(initialSyncTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-this.initialSync.settled:
+			//Nothing left to do but the loop has to keep running until the registry stops
+			<-ctx.Done()
+			return nil
+		case <-timeout.C:
+			this.settleInitialSync("timeout")
+		case t := <-quietTicker.C:
+			if t.Sub(asked) >= initialSyncQuietPeriod && this.initialSync.QuietSince(t.Add(-initialSyncQuietPeriod)) {
+				this.settleInitialSync("quiet")
+			}
+		}
+	}
+}
+
+// settleInitialSync lets WaitForInitialSync return, by being how it settled for apireg_initial_sync_seconds
+func (this *multicastApiRegistry) settleInitialSync(by string) {
+	if took, settled := this.initialSync.Settle(time.Now()); settled {
+		this.metrics.Set("apireg_initial_sync_seconds", "How long the initial sync took to settle after asking peers for their apis", map[string]string{"by": by}, took.Seconds())
+	}
+}
+
+// handleSync answers a request for everything we have registered the same way a query is answered, each answer after a
+// random delay
+func (this *multicastApiRegistry) handleSync(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+	if len(this.ownedApis.All()) == 0 {
+		return
+	}
+
+	select {
+	case this.queryAnswers <- struct{}{}:
+	default:
+		this.metrics.Add("apireg_queries_dropped_total", "Number of queries for our apis not answered as too many were being answered already", nil, 1)
+		return
+	}
+	go func() {
+		defer func() { <-this.queryAnswers }()
+		time.Sleep(rand.N(syncAnswerJitter))
+		//Taken after the delay so nothing deregistered in the meantime is announced again
+		for _, curOwned := range this.ownedApis.All() {
+			this.answerQuery(curOwned.(*ownedApi), message.UnicastPort, rAddr)
+		}
+	}()
+}
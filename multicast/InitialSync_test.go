@@ -0,0 +1,55 @@
+package multicast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatInitialSyncSettlesWithoutPeers(t *testing.T) {
+	r, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	failOnErr(r.WaitForInitialSync(ctx), t)
+	if r.(*multicastApiRegistry).metrics.Value("apireg_initial_sync_seconds", map[string]string{"by": "quiet"}) == 0 {
+		t.Fail()
+	}
+}
+
+func TestThatInitialSyncHearsApisRegisteredBeforeStarting(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	failOnErr(reg0.RegisterApi("Early", apireg.NewVersion(1, 0, 0), 9490), t)
+
+	//Not resent for a whole heartbeat so only the answer to the sync request can get it to reg1 in time
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	failOnErr(reg1.WaitForInitialSync(ctx), t)
+	if len(reg1.GetApisByApiName("Early")) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWaitForInitialSyncReturnsContextErrorBeforeRun(t *testing.T) {
+	r, err := NewRunnableMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if r.WaitForInitialSync(ctx) != context.DeadlineExceeded {
+		t.Fail()
+	}
+}
@@ -0,0 +1,53 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Key is a secret used for signing or encrypting messages along with the ID that is put in the envelope so receivers know
+// which of their keys to check it with
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// keyRing is every key that is accepted, with the newest key being the one that is sent with
+type keyRing[T any] struct {
+	newestID string
+	keys     map[string]T
+}
+
+// newKeyRing builds a key ring where keys are ordered oldest to newest, each turned into what the codec needs by prepare
+func newKeyRing[T any](keys []Key, prepare func(secret []byte) (T, error)) (*keyRing[T], error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	ring := &keyRing[T]{keys: make(map[string]T, len(keys))}
+
+	for _, curKey := range keys {
+		if _, contains := ring.keys[curKey.ID]; contains {
+			return nil, errors.New(fmt.Sprint("Key ID ", curKey.ID, " was used more than once"))
+		}
+		prepared, err := prepare(curKey.Secret)
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("Invalid key ", curKey.ID, " ", err))
+		}
+		ring.keys[curKey.ID] = prepared
+	}
+	ring.newestID = keys[len(keys)-1].ID
+
+	return ring, nil
+}
+
+// Newest returns the key that should be sent with and its ID
+func (this *keyRing[T]) Newest() (string, T) {
+	return this.newestID, this.keys[this.newestID]
+}
+
+// Get returns the key for id
+func (this *keyRing[T]) Get(id string) (T, bool) {
+	key, contains := this.keys[id]
+	return key, contains
+}
@@ -0,0 +1,33 @@
+package multicast
+
+import "testing"
+
+func prepareSecret(secret []byte) ([]byte, error) {
+	return secret, nil
+}
+
+func TestThatNewKeyRingReturnsErrorWithNoKeys(t *testing.T) {
+	_, err := newKeyRing(nil, prepareSecret)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewKeyRingReturnsErrorForDuplicateIDs(t *testing.T) {
+	_, err := newKeyRing([]Key{{ID: "a"}, {ID: "a"}}, prepareSecret)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewestKeyIsTheLastKey(t *testing.T) {
+	ring, _ := newKeyRing([]Key{{ID: "a", Secret: []byte("0")}, {ID: "b", Secret: []byte("1")}}, prepareSecret)
+
+	kid, secret := ring.Newest()
+
+	if kid != "b" || string(secret) != "1" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,313 @@
+package multicast
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+// WithKnownAnswerSuppression skips resending an owned registration when it was already announced in the last half of the
+// heartbeat interval, or when every peer's digest shows it already has exactly what we last announced. Every registry with
+// this option sends a digest of what it tracks from each sender once per heartbeat, over the control group if there is one.
+// A registration is never skipped twice in a row, nor when skipping would leave it more than half its lifespan between
+// resends, so that peers that don't send digests, like ones that only listen, still hear it well before it expires
+func WithKnownAnswerSuppression() Option {
+	return func(r *multicastApiRegistry) error {
+		r.knownAnswers = newSyncKnownAnswers()
+		r.controlHandlers[digestMessage] = r.handleDigest
+		return nil
+	}
+}
+
+type announcement struct {
+	state apireg.ApiState
+	sent  time.Time
+}
+
+type peerDigest struct {
+	//Digest the peer has of what it tracks from us, 0 if it tracks nothing
+	digest   uint64
+	received time.Time
+}
+
+// syncKnownAnswers remembers what we last announced for each owned api and what each peer says it has from us
+type syncKnownAnswers struct {
+	announced map[string]announcement
+	digests   map[uuid.UUID]peerDigest
+	//When what we announce last changed, digests from before it can't say whether a peer heard the change
+	changed time.Time
+	//Set at the start of each resend cycle when every peer already has what we last announced
+	peersFresh bool
+	mutex      *sync.Mutex
+}
+
+func newSyncKnownAnswers() *syncKnownAnswers {
+	k := &syncKnownAnswers{}
+	k.announced = make(map[string]announcement)
+	k.digests = make(map[uuid.UUID]peerDigest)
+	k.mutex = &sync.Mutex{}
+
+	return k
+}
+
+// Announced records that the api with key was announced in state s at t
+func (this *syncKnownAnswers) Announced(key string, s apireg.ApiState, t time.Time) {
+	this.mutex.Lock()
+	if last, announced := this.announced[key]; !announced || last.state != s {
+		this.changed = t
+	}
+	this.announced[key] = announcement{state: s, sent: t}
+	this.mutex.Unlock()
+}
+
+// Withdrawn forgets the api with key as it is no longer announced at t
+func (this *syncKnownAnswers) Withdrawn(key string, t time.Time) {
+	this.mutex.Lock()
+	if _, announced := this.announced[key]; announced {
+		this.changed = t
+	}
+	delete(this.announced, key)
+	this.mutex.Unlock()
+}
+
+// Digested records the digest the peer id sent of what it has from us at t
+func (this *syncKnownAnswers) Digested(id uuid.UUID, digest uint64, t time.Time) {
+	this.mutex.Lock()
+	this.digests[id] = peerDigest{digest: digest, received: t}
+	this.mutex.Unlock()
+}
+
+// StartCycle decides whether resends can rely on the peers having fresh state for the cycle starting at t. It is only the
+// case when each of peers sent a digest after since that matches what we last announced for every one of owned
+func (this *syncKnownAnswers) StartCycle(owned []string, peers []uuid.UUID, since time.Time) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	ours := this.digestOf(owned)
+	fresh := ours != 0 && len(peers) > 0
+	known := make(map[uuid.UUID]peerDigest, len(peers))
+	for _, curPeer := range peers {
+		curDigest, digested := this.digests[curPeer]
+		if digested {
+			known[curPeer] = curDigest
+		}
+		if !digested || curDigest.received.Before(since) || curDigest.digest != ours {
+			fresh = false
+		}
+	}
+	//Drop the digests of peers that have gone away
+	this.digests = known
+	this.peersFresh = fresh
+	return fresh
+}
+
+// Reflections counts how many of peers sent a digest after since, and after what we announce last changed, that matches
+// what we last announced for every one of owned and how many sent one that doesn't. Peers that haven't sent a digest since
+// then count as neither, as they may not send them at all
+func (this *syncKnownAnswers) Reflections(owned []string, peers []uuid.UUID, since time.Time) (int, int) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	ours := this.digestOf(owned)
+	if ours == 0 {
+		return 0, 0
+	}
+	if this.changed.After(since) {
+		since = this.changed
+	}
+	reflected, unreflected := 0, 0
+	for _, curPeer := range peers {
+		curDigest, digested := this.digests[curPeer]
+		if !digested || curDigest.received.Before(since) {
+			continue
+		}
+		if curDigest.digest == ours {
+			reflected++
+		} else {
+			unreflected++
+		}
+	}
+	return reflected, unreflected
+}
+
+// Suppress returns why the api with key shouldn't be resent in state s at t given interval, empty if it should be
+func (this *syncKnownAnswers) Suppress(key string, s apireg.ApiState, t time.Time, interval time.Duration) string {
+	this.mutex.Lock()
+	last, announced := this.announced[key]
+	peersFresh := this.peersFresh
+	this.mutex.Unlock()
+
+	if !announced || last.state != s {
+		return ""
+	}
+	since := t.Sub(last.sent)
+	//Background apis already skip every other heartbeat, this stops a suppression from leaving them about as long as they live
+	if since+interval > maxResendGap {
+		return ""
+	}
+	if since < interval/2 {
+		return "recent"
+	} else if peersFresh && since < interval*3/2 {
+		//Less than a cycle and a half means the last cycle did send it, so this is never a second skip in a row
+		return "known-answer"
+	}
+	return ""
+}
+
+// digestOf hashes what was last announced for each of keys, 0 if none of them have been
+func (this *syncKnownAnswers) digestOf(keys []string) uint64 {
+	entries := make([]string, 0, len(keys))
+	for _, curKey := range keys {
+		if last, announced := this.announced[curKey]; announced {
+			entries = append(entries, fmt.Sprint(curKey, "|", last.state))
+		}
+	}
+	return digestEntries(entries)
+}
+
+// digestEntries hashes entries regardless of their order, 0 meaning there were no entries
+func digestEntries(entries []string) uint64 {
+	if len(entries) == 0 {
+		return 0
+	}
+	sort.Strings(entries)
+	h := fnv.New64a()
+	for _, curEntry := range entries {
+		h.Write([]byte(curEntry))
+		h.Write([]byte{'\n'})
+	}
+	if digest := h.Sum64(); digest != 0 {
+		return digest
+	}
+	return 1
+}
+
+// apiKey is how an api is known to the send queue and known answers
+func apiKey(a apireg.Api) string {
+	return fmt.Sprint(a.Name(), "|", a.Version(), "|", a.HostPort())
+}
+
+// recordAnnouncement keeps track of what we announce so that resends of it can be suppressed
+func (this *multicastApiRegistry) recordAnnouncement(t messageType, a apireg.Api) {
+	if this.knownAnswers == nil {
+		return
+	}
+	if t == registerMessage {
+		this.knownAnswers.Announced(apiKey(a), a.State(), time.Now())
+	} else if t == withdrawMessage {
+		this.knownAnswers.Withdrawn(apiKey(a), time.Now())
+	}
+}
+
+// startResendCycle works out if the peers already have fresh state for the cycle about to run with interval, and tells the
+// heartbeat whether their digests show they have what we announced
+func (this *multicastApiRegistry) startResendCycle(interval time.Duration) {
+	if this.knownAnswers == nil {
+		return
+	}
+	owned := this.ownedApis.All()
+	keys := make([]string, len(owned))
+	for i, curOwned := range owned {
+		keys[i] = apiKey(curOwned)
+	}
+	peers := this.processingPeers()
+	//Digests are sent once a cycle so anything from the last two is still current
+	since := time.Now().Add(-interval * 2)
+	reflected, unreflected := this.knownAnswers.Reflections(keys, peers, since)
+	this.reflections.Reflected(reflected)
+	this.reflections.Unreflected(unreflected)
+	this.knownAnswers.StartCycle(keys, peers, since)
+}
+
+// processingPeers returns the ids of the peers in an environment whose messages we process, which are the ones expected to
+// have what we announce
+func (this *multicastApiRegistry) processingPeers() []uuid.UUID {
+	peers := make([]uuid.UUID, 0)
+	for _, curPeer := range this.peers.All() {
+		if shouldProcessMessage(this.environment, curPeer.Environment) {
+			peers = append(peers, curPeer.ID)
+		}
+	}
+	return peers
+}
+
+// suppressResend returns true if a should not be resent with interval as everyone already has it
+func (this *multicastApiRegistry) suppressResend(a apireg.Api, interval time.Duration) bool {
+	if this.knownAnswers == nil {
+		return false
+	}
+	reason := this.knownAnswers.Suppress(apiKey(a), a.State(), time.Now(), interval)
+
+	if reason == "" {
+		return false
+	}
+	this.metrics.Add("apireg_suppressed_resends_total", "Number of owned registrations not resent as peers already had them", map[string]string{"reason": reason}, 1)
+	return true
+}
+
+// sendDigests tells everyone what we track from each sender so they can tell whether their resends are needed
+func (this *multicastApiRegistry) sendDigests() {
+	if this.knownAnswers == nil {
+		return
+	}
+	entries := make(map[string][]string)
+	for _, curReg := range this.apiRegs.GetAllRegs() {
+		a := curReg.Api()
+		sender := a.UUID().String()
+		entries[sender] = append(entries[sender], fmt.Sprint(apiKey(a), "|", a.State()))
+	}
+	//Peers we track nothing from still need to know that we have nothing of theirs
+	for _, curPeer := range this.peers.All() {
+		if _, tracked := entries[curPeer.ID.String()]; !tracked {
+			entries[curPeer.ID.String()] = nil
+		}
+	}
+
+	//Each message covers as many senders as fit in one datagram once encoded, which depends on the codecs and the MTU
+	digests := make(map[string]uint64)
+	for curSender, curEntries := range entries {
+		digests[curSender] = digestEntries(curEntries)
+		if len(digests) > 1 && !this.digestsFit(digests) {
+			delete(digests, curSender)
+			this.writeDigests(digests)
+			digests = map[string]uint64{curSender: digestEntries(curEntries)}
+		}
+	}
+	if len(digests) > 0 {
+		this.writeDigests(digests)
+	}
+}
+
+// digestsFit returns true if a digest message of digests fits in one datagram
+func (this *multicastApiRegistry) digestsFit(digests map[string]uint64) bool {
+	message := &apiRegisterMessageJSON{Type: digestMessage, Digests: digests}
+	this.stampControl(message)
+	_, err := this.encodePayload(message)
+
+	return err == nil
+}
+
+func (this *multicastApiRegistry) writeDigests(digests map[string]uint64) {
+	err := this.writeControl(&apiRegisterMessageJSON{Type: digestMessage, Digests: digests})
+	if err != nil {
+		log.Println("Error sending digests", err)
+	}
+}
+
+func (this *multicastApiRegistry) handleDigest(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+	senderID, err := uuid.Parse(message.SenderUUID)
+	if err != nil {
+		return
+	}
+	//Digests are split across messages by sender so only the one that covers us says anything about what it has from us
+	if digest, covered := message.Digests[this.id.String()]; covered {
+		this.knownAnswers.Digested(senderID, digest, time.Now())
+	}
+}
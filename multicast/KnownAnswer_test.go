@@ -0,0 +1,183 @@
+package multicast
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatResendJustAfterAnnouncementIsSuppressed(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+
+	if k.Suppress("a|0.0.1|80", apireg.Serving, now.Add(time.Second), time.Second*10) != "recent" {
+		t.Fail()
+	}
+	//A change of state always has to go out
+	if k.Suppress("a|0.0.1|80", apireg.Draining, now.Add(time.Second), time.Second*10) != "" {
+		t.Fail()
+	}
+	if k.Suppress("a|0.0.1|80", apireg.Serving, now.Add(time.Second*6), time.Second*10) != "" {
+		t.Fail()
+	}
+}
+
+func TestThatResendIsSuppressedOnlyOnceWhenPeersHaveFreshDigests(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	peer := uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(peer, k.digestOf([]string{"a|0.0.1|80"}), now)
+
+	if !k.StartCycle([]string{"a|0.0.1|80"}, []uuid.UUID{peer}, now.Add(-time.Second)) {
+		t.FailNow()
+	}
+	if k.Suppress("a|0.0.1|80", apireg.Serving, now.Add(time.Second*10), time.Second*10) != "known-answer" {
+		t.Fail()
+	}
+	//Skipped last cycle so it has to go out this one
+	if k.Suppress("a|0.0.1|80", apireg.Serving, now.Add(time.Second*20), time.Second*10) != "" {
+		t.Fail()
+	}
+}
+
+func TestThatPeerWithoutDigestStopsSuppression(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	peer := uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(peer, k.digestOf([]string{"a|0.0.1|80"}), now)
+
+	if k.StartCycle([]string{"a|0.0.1|80"}, []uuid.UUID{peer, uuid.New()}, now.Add(-time.Second)) {
+		t.Fail()
+	}
+}
+
+func TestThatPeerWithStaleDigestStopsSuppression(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	peer := uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(peer, k.digestOf([]string{"a|0.0.1|80"}), now)
+	k.Announced("a|0.0.1|80", apireg.Draining, now)
+
+	if k.StartCycle([]string{"a|0.0.1|80"}, []uuid.UUID{peer}, now.Add(-time.Second)) {
+		t.Fail()
+	}
+}
+
+func TestThatDigestsFromPeersAllowSuppression(t *testing.T) {
+	b := NewBroker()
+	owner, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithKnownAnswerSuppression())
+	failOnErr(err, t)
+	defer owner.Close()
+	peer, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithKnownAnswerSuppression())
+	failOnErr(err, t)
+	defer peer.Close()
+	go owner.Run(context.Background())
+
+	failOnErr(owner.RegisterApi("Suppressed", apireg.NewVersion(0, 0, 1), 9430), t)
+	time.Sleep(time.Millisecond * 50)
+	peer.(*multicastApiRegistry).sendDigests()
+	time.Sleep(time.Millisecond * 50)
+
+	owner.startResendCycle(time.Second * 10)
+	if !owner.knownAnswers.peersFresh {
+		t.Fail()
+	}
+}
+
+func TestThatDigestNotCoveringUsKeepsPeersDigest(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithKnownAnswerSuppression())
+	failOnErr(err, t)
+	defer r.Close()
+	peer := uuid.New()
+
+	r.handleDigest(&apiRegisterMessageJSON{SenderUUID: peer.String(), Digests: map[string]uint64{r.id.String(): 42}}, hookSource)
+	r.handleDigest(&apiRegisterMessageJSON{SenderUUID: peer.String(), Digests: map[string]uint64{uuid.NewString(): 7}}, hookSource)
+
+	if r.knownAnswers.digests[peer].digest != 42 {
+		t.Fail()
+	}
+}
+
+func TestThatDigestsAreSplitToFitEncryptedDatagrams(t *testing.T) {
+	b := NewBroker()
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithKnownAnswerSuppression(), WithEncryptionKey(make([]byte, 32)))
+	failOnErr(err, t)
+	defer r.Close()
+	conn, err := b.Listen()
+	failOnErr(err, t)
+	defer conn.Close()
+	for i := 0; i < 40; i++ {
+		r.peers.Heard(uuid.New(), hookSource.IP, "", "", apireg.All, 0, time.Now())
+	}
+
+	go r.sendDigests()
+	covered := 0
+	buffer := make([]byte, 65536)
+	for covered < 40 {
+		n, _, err := conn.ReadFromUDP(buffer)
+		failOnErr(err, t)
+		if n > r.maxPayload {
+			t.FailNow()
+		}
+		payload, _, err := r.decode(buffer[:n], hookSource)
+		failOnErr(err, t)
+		message := &apiRegisterMessageJSON{}
+		failOnErr(json.Unmarshal(payload, message), t)
+		covered += len(message.Digests)
+	}
+	if r.metrics.Value("apireg_sent_control_messages_total", map[string]string{"type": string(digestMessage)}) < 2 {
+		t.Fail()
+	}
+}
+
+func TestThatMatchingDigestAfterChangeIsReflected(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	reflecting, missing, silent := uuid.New(), uuid.New(), uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(reflecting, k.digestOf([]string{"a|0.0.1|80"}), now.Add(time.Second))
+	k.Digested(missing, 42, now.Add(time.Second))
+
+	reflected, unreflected := k.Reflections([]string{"a|0.0.1|80"}, []uuid.UUID{reflecting, missing, silent}, now.Add(-time.Second*20))
+
+	//A peer that never sent a digest says nothing either way
+	if reflected != 1 || unreflected != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatDigestFromBeforeChangeIsNotCounted(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	peer := uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(peer, k.digestOf([]string{"a|0.0.1|80"}), now.Add(time.Second))
+	k.Announced("a|0.0.1|80", apireg.Draining, now.Add(time.Second*2))
+
+	if reflected, unreflected := k.Reflections([]string{"a|0.0.1|80"}, []uuid.UUID{peer}, now.Add(-time.Second*20)); reflected != 0 || unreflected != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatBackgroundResendIsNotSuppressedOnTopOfItsTier(t *testing.T) {
+	k := newSyncKnownAnswers()
+	now := time.Now()
+	peer := uuid.New()
+	k.Announced("a|0.0.1|80", apireg.Serving, now)
+	k.Digested(peer, k.digestOf([]string{"a|0.0.1|80"}), now)
+	k.StartCycle([]string{"a|0.0.1|80"}, []uuid.UUID{peer}, now.Add(-time.Second))
+	interval := resendInterval(apireg.BackgroundPriority, time.Second*15)
+
+	//Already resent half as often, skipping one more would leave it about as long as it lives
+	if k.Suppress("a|0.0.1|80", apireg.Serving, now.Add(interval), interval) != "" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,70 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	//Bytes of every datagram taken up by the ipv4 and udp headers
+	udpIPv4HeaderBytes int = 28
+	//Smallest MTU every ipv4 link has to support
+	minMTU int = 576
+)
+
+// WithMTU sizes outgoing datagrams for a link MTU of mtu bytes instead of the MTU of the network interfaces, for when a
+// tunnel or VPN along the way lowers it. Announcements too big for one datagram are split into fragments
+func WithMTU(mtu int) Option {
+	return func(r *multicastApiRegistry) error {
+		if mtu < minMTU || mtu > maxDatagramSizeBytes+udpIPv4HeaderBytes {
+			return errors.New(fmt.Sprint("mtu must be between ", minMTU, " and ", maxDatagramSizeBytes+udpIPv4HeaderBytes, " for WithMTU"))
+		}
+		r.mtu = mtu
+		return nil
+	}
+}
+
+// MTU is the smallest MTU of the interfaces a group can be sent out of, those that are up and can multicast, 0 if there aren't any
+func (this *udpMulticastTransport) MTU() int {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0
+	}
+	mtu := 0
+	for _, curIface := range ifaces {
+		if curIface.Flags&net.FlagUp == 0 || curIface.Flags&net.FlagMulticast == 0 || curIface.Flags&net.FlagLoopback != 0 || curIface.MTU <= 0 {
+			continue
+		}
+		if mtu == 0 || curIface.MTU < mtu {
+			mtu = curIface.MTU
+		}
+	}
+	return mtu
+}
+
+// MTU of a broker isn't known so registries on one use the default size
+func (this *Broker) MTU() int {
+	return 0
+}
+
+// sizeMessages works out the largest datagram we send from the MTU and makes sure we can read datagrams that size
+func (this *multicastApiRegistry) sizeMessages() error {
+	mtu := this.mtu
+	if mtu == 0 {
+		mtu = this.transport.MTU()
+	}
+	this.maxPayload = registrationMessageSizeBytes
+	if mtu != 0 {
+		this.maxPayload = min(mtu-udpIPv4HeaderBytes, maxDatagramSizeBytes)
+	}
+	this.metrics.Set("apireg_max_payload_bytes", "Largest datagram the registry sends", nil, float64(this.maxPayload))
+
+	if this.receiveBufferSize == 0 {
+		//Peers on the same link send datagrams as big as ours so that is what we need to be able to read
+		this.receiveBufferSize = max(this.maxPayload, registrationMessageSizeBytes)
+	} else if this.receiveBufferSize < this.maxPayload {
+		return errors.New(fmt.Sprint("receive buffer of ", this.receiveBufferSize, " bytes is smaller than the ", this.maxPayload, " byte datagrams sent for the MTU, see WithReceiveBufferSize"))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package multicast
+
+type messageType string
+
+const (
+	//registerMessage announces (or refreshes) an Api. An empty type is also treated as a register so older senders still work
+	registerMessage messageType = "register"
+	//withdrawMessage tells everyone to stop tracking an Api right away instead of waiting for it to expire
+	withdrawMessage messageType = "withdraw"
+	//pingMessage asks a peer to answer with a pongMessage carrying the same nonce, only ever sent over unicast
+	pingMessage messageType = "ping"
+	pongMessage messageType = "pong"
+	//ackMessage echoes the change nonce of an announcement back to its sender once applied, only ever sent over unicast
+	ackMessage messageType = "ack"
+	//digestMessage carries a hash of what the sender tracks from each other sender, see WithKnownAnswerSuppression
+	digestMessage messageType = "digest"
+	//queryMessage asks the owners of an api name to answer with an answerMessage for each of their apis by that name
+	queryMessage messageType = "query"
+	//answerMessage is a registration sent over unicast to the registry that queried for it
+	answerMessage messageType = "answer"
+	//activeColorMessage sets the active deployment color of an api name, see SetActiveColor
+	activeColorMessage messageType = "active-color"
+	//fragmentMessage carries a piece of a message too big for one datagram, see WithMTU
+	fragmentMessage messageType = "fragment"
+	//syncMessage asks every registry to answer with all of their apis like a query for every name, see WaitForInitialSync
+	syncMessage messageType = "sync"
+)
@@ -0,0 +1,125 @@
+package multicast
+
+import (
+	"errors"
+	"strings"
+)
+
+// NameNormalizer turns an api name into the form it is announced, tracked and looked up under, so that names which only
+// differ in ways the normalizer drops are treated as the same api
+type NameNormalizer func(name string) string
+
+// FoldCase normalizes names to lower case so "OrderService" and "orderservice" are the same
+func FoldCase(name string) string {
+	return strings.ToLower(name)
+}
+
+// StripSeparators drops the dashes, underscores and spaces teams put between words so "order-service" and "order_service"
+// are the same as "orderservice"
+func StripSeparators(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == ' ' {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// NormalizeNames applies each of normalizers in turn
+func NormalizeNames(normalizers ...NameNormalizer) NameNormalizer {
+	return func(name string) string {
+		for _, curNormalizer := range normalizers {
+			name = curNormalizer(name)
+		}
+		return name
+	}
+}
+
+// WithNameNormalization normalizes every api name with normalizer, whether it is being registered, heard or looked up, like
+// NormalizeNames(FoldCase, StripSeparators) to have "OrderService" and "order-service" find each other. What is registered
+// is announced normalized and apis are returned with their normalized names. Only the literal parts of the patterns given
+// to GetApisByNamePattern are normalized, their character classes have to be written in normalized form. Admission tokens, publisher policies and
+// admission hooks also see the normalized names. Every registry that shares apis should use the same normalizer as one
+// without it only finds the normalized names
+func WithNameNormalization(normalizer NameNormalizer) Option {
+	return func(r *multicastApiRegistry) error {
+		if normalizer == nil {
+			return errors.New("normalizer is required for WithNameNormalization")
+		}
+		r.nameNormalizer = normalizer
+		return nil
+	}
+}
+
+// normalizeName returns name as the registry tracks it
+func (this *multicastApiRegistry) normalizeName(name string) string {
+	if this.nameNormalizer == nil {
+		return name
+	}
+	return this.nameNormalizer(name)
+}
+
+// normalizePattern normalizes the literal parts of pattern, a path.Match pattern, leaving its wildcards and character
+// classes as they are so the normalizer can't change what they mean. Classes have to be written in normalized form
+func (this *multicastApiRegistry) normalizePattern(pattern string) string {
+	if this.nameNormalizer == nil {
+		return pattern
+	}
+	normalized := &strings.Builder{}
+	literal := &strings.Builder{}
+	flush := func() {
+		normalized.WriteString(escapePattern(this.nameNormalizer(literal.String())))
+		literal.Reset()
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				literal.WriteByte(pattern[i])
+			} else {
+				//Left as is for path.Match to report as a bad pattern
+				flush()
+				normalized.WriteByte('\\')
+			}
+		case '*', '?':
+			flush()
+			normalized.WriteByte(pattern[i])
+		case '[':
+			flush()
+			end := classEnd(pattern, i)
+			normalized.WriteString(pattern[i:end])
+			i = end - 1
+		default:
+			literal.WriteByte(pattern[i])
+		}
+	}
+	flush()
+	return normalized.String()
+}
+
+// classEnd returns the index just past the character class of pattern starting at start, or the end of the pattern if
+// the class is never closed
+func classEnd(pattern string, start int) int {
+	for i := start + 1; i < len(pattern); i++ {
+		if pattern[i] == '\\' {
+			i++
+		} else if pattern[i] == ']' {
+			return i + 1
+		}
+	}
+	return len(pattern)
+}
+
+// escapePattern escapes everything in literal that path.Match would otherwise take as part of a pattern
+func escapePattern(literal string) string {
+	escaped := &strings.Builder{}
+	for i := 0; i < len(literal); i++ {
+		if strings.IndexByte(`*?[]\`, literal[i]) >= 0 {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(literal[i])
+	}
+	return escaped.String()
+}
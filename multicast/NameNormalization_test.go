@@ -0,0 +1,86 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatNormalizeNamesFoldsCaseAndStripsSeparators(t *testing.T) {
+	normalize := NormalizeNames(FoldCase, StripSeparators)
+
+	for _, curName := range []string{"OrderService", "orderservice", "order-service", "Order_Service"} {
+		if normalize(curName) != "orderservice" {
+			t.Fail()
+		}
+	}
+}
+
+func TestThatWithNameNormalizationNeedsNormalizer(t *testing.T) {
+	if WithNameNormalization(nil)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNormalizedNamesFindEachOther(t *testing.T) {
+	b := NewBroker()
+	normalize := WithNameNormalization(NormalizeNames(FoldCase, StripSeparators))
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), normalize)
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), normalize)
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("OrderService", apireg.NewVersion(1, 0, 0), 9460), t)
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName("order-service")
+	if len(apis) != 1 || apis[0].Name() != "orderservice" || len(reg1.GetApisByApiName("Order_Service")) != 1 {
+		t.FailNow()
+	}
+	failOnErr(reg0.DrainApi("order_service", apireg.NewVersion(1, 0, 0), 9460), t)
+	time.Sleep(time.Millisecond * 50)
+	if apis := reg1.GetApisByApiName("OrderService"); len(apis) != 1 || apis[0].State() != apireg.Draining {
+		t.Fail()
+	}
+}
+
+func TestThatHeardNamesAreNormalized(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithNameNormalization(FoldCase))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "BillingService", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	if apis, err := r.GetApisByNamePattern("Billing*"); err != nil || len(apis) != 1 || apis[0].Name() != "billingservice" {
+		t.Fail()
+	}
+}
+
+func TestThatForceAnnounceNormalizesName(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithNameNormalization(NormalizeNames(FoldCase, StripSeparators)))
+	failOnErr(err, t)
+	defer r.Close()
+
+	failOnErr(r.RegisterApi("OrderService", apireg.NewVersion(1, 0, 0), 9461), t)
+	if r.ForceAnnounce("OrderService") != nil || r.ForceAnnounce("order-service") != nil {
+		t.Fail()
+	}
+}
+
+func TestThatOnlyLiteralPartsOfPatternsAreNormalized(t *testing.T) {
+	r := &multicastApiRegistry{nameNormalizer: NormalizeNames(FoldCase, StripSeparators)}
+
+	for pattern, normalized := range map[string]string{
+		"Order-Service*": "orderservice*",
+		"svc[0-9]":       "svc[0-9]",
+		"A_B?[^a-c]x-Y":  "ab?[^a-c]xy",
+		`Lit\*Star`:      `lit\*star`,
+	} {
+		if r.normalizePattern(pattern) != normalized {
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package multicast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// WithNodeIdentity gives the registry a certificate proving who it is and the roots that the certificates of other nodes
+// have to chain up to. Once set the TCP peer channels, the snapshot server and bootstrap, require mutual TLS and everything
+// learned over them carries the identity of the node it came from, see apireg.Api.Identity. It does nothing for udp, so
+// announcements on the group and the pings, acks and answers to queries sent straight to a peer are still accepted from
+// anyone and carry no identity, WithSigningKeys is what protects those. Nodes are known by the first
+// URI in their certificate, like a SPIFFE ID, falling back to the first DNS name and then the common name. As peers are
+// dialed by the address they announce from, certificates are checked against roots and not against that address
+func WithNodeIdentity(cert tls.Certificate, roots *x509.CertPool) Option {
+	return func(r *multicastApiRegistry) error {
+		if len(cert.Certificate) == 0 {
+			return errors.New("cert is required for WithNodeIdentity")
+		} else if roots == nil {
+			return errors.New("roots are required for WithNodeIdentity")
+		}
+		r.nodeCert = &cert
+		r.nodeRoots = roots
+		return nil
+	}
+}
+
+// certificateIdentity is what a node is known by given its certificate
+func certificateIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	} else if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// verifyNodeCertificate checks that the peer presented a certificate that chains up to roots
+func verifyNodeCertificate(roots *x509.CertPool) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("peer did not present a node certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, curCert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(curCert)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+}
+
+// peerServerTLS is the config peer channels are served with, nil meaning plain tcp
+func (this *multicastApiRegistry) peerServerTLS(base *tls.Config) *tls.Config {
+	if this.nodeCert == nil {
+		return base
+	}
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	config.Certificates = []tls.Certificate{*this.nodeCert}
+	config.ClientAuth = tls.RequireAnyClientCert
+	config.VerifyConnection = verifyNodeCertificate(this.nodeRoots)
+	return config
+}
+
+// peerClientTLS is the config peer channels are dialed with, nil meaning plain tcp
+func (this *multicastApiRegistry) peerClientTLS(base *tls.Config) *tls.Config {
+	if this.nodeCert == nil {
+		return base
+	}
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	config.Certificates = []tls.Certificate{*this.nodeCert}
+	//The standard verification would check the certificate against the address which isn't what identifies a node
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = verifyNodeCertificate(this.nodeRoots)
+	return config
+}
+
+// peerIdentity is the identity the other end of a peer channel proved, empty if it proved nothing
+func (this *multicastApiRegistry) peerIdentity(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) > 0 {
+		return certificateIdentity(state.VerifiedChains[0][0])
+	} else if this.nodeCert != nil && len(state.PeerCertificates) > 0 {
+		//Already checked against our roots by verifyNodeCertificate as part of the handshake
+		return certificateIdentity(state.PeerCertificates[0])
+	}
+	return ""
+}
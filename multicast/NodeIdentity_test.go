@@ -0,0 +1,134 @@
+package multicast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+// testCA issues node certificates for tests
+type testCA struct {
+	cert  *x509.Certificate
+	key   *ecdsa.PrivateKey
+	roots *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	failOnErr(err, t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	failOnErr(err, t)
+	cert, err := x509.ParseCertificate(der)
+	failOnErr(err, t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &testCA{cert: cert, key: key, roots: roots}
+}
+
+func (this *testCA) issue(t *testing.T, id string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	failOnErr(err, t)
+	uri, err := url.Parse(id)
+	failOnErr(err, t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{uri},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, this.cert, &key.PublicKey, this.key)
+	failOnErr(err, t)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestThatMutualTLSBootstrapAttachesPeerIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", nil),
+		WithNodeIdentity(ca.issue(t, "spiffe://apireg/node0"), ca.roots))
+	failOnErr(err, t)
+	defer reg0.Close()
+	failOnErr(reg0.RegisterApi("Identified", apireg.NewVersion(1, 0, 0), 9404), t)
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(nil),
+		WithNodeIdentity(ca.issue(t, "spiffe://apireg/node1"), ca.roots))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)), t)
+
+	apis := reg1.GetApisByApiName("Identified")
+	if len(apis) != 1 || apis[0].Identity() != "spiffe://apireg/node0" {
+		t.Fail()
+	}
+}
+
+func TestThatMutualTLSRejectsPeersFromOtherRoots(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", nil),
+		WithNodeIdentity(ca.issue(t, "spiffe://apireg/node0"), ca.roots))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(nil),
+		WithNodeIdentity(otherCA.issue(t, "spiffe://apireg/node1"), otherCA.roots))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	if reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatMutualTLSRejectsPeersWithoutCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", nil),
+		WithNodeIdentity(ca.issue(t, "spiffe://apireg/node0"), ca.roots))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(&tls.Config{InsecureSkipVerify: true}))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	if reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatCertificateIdentityPrefersURIThenDNSThenCommonName(t *testing.T) {
+	uri, _ := url.Parse("spiffe://apireg/node")
+	if certificateIdentity(&x509.Certificate{URIs: []*url.URL{uri}, DNSNames: []string{"node"}}) != "spiffe://apireg/node" ||
+		certificateIdentity(&x509.Certificate{DNSNames: []string{"node"}, Subject: pkix.Name{CommonName: "cn"}}) != "node" ||
+		certificateIdentity(&x509.Certificate{Subject: pkix.Name{CommonName: "cn"}}) != "cn" {
+		t.Fail()
+	}
+}
+
+func TestThatWithNodeIdentityReturnsErrorWithoutRoots(t *testing.T) {
+	if WithNodeIdentity(tls.Certificate{Certificate: [][]byte{{1}}}, nil)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,115 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Option configures the optional behavior of a multicast registry
+type Option func(*multicastApiRegistry) error
+
+// CrashHandler is called with the raw payload of a message whose handling panicked, the address it came from and what was recovered
+type CrashHandler func(payload []byte, source *net.UDPAddr, recovered interface{})
+
+// WithCrashHandler sets a function that is called every time handling a message panics. The message is dropped either way
+func WithCrashHandler(h CrashHandler) Option {
+	return func(r *multicastApiRegistry) error {
+		if h == nil {
+			return errors.New("h (crash handler) is required for WithCrashHandler")
+		}
+		r.crashHandler = h
+		return nil
+	}
+}
+
+// WithHeartbeatBounds sets how fast and how slow owned registrations can be resent as the heartbeat adapts to whether peers
+// show they have what we announced. Passing the same value for both turns off adapting
+func WithHeartbeatBounds(min, max time.Duration) Option {
+	return func(r *multicastApiRegistry) error {
+		if min <= 0 {
+			return errors.New("min must be > 0 for WithHeartbeatBounds")
+		} else if max < min {
+			return errors.New("max must be >= min for WithHeartbeatBounds")
+		} else if max > registrationLifeSpan/2 {
+			return errors.New(fmt.Sprint("max must be <= ", registrationLifeSpan/2, " for WithHeartbeatBounds so registrations don't expire between heartbeats"))
+		}
+		r.heartbeat = newHeartbeat(registrationUpdateInterval, min, max)
+		return nil
+	}
+}
+
+// WithReceiveBufferSize sets the largest datagram that is read, by default the largest one sent for the MTU. It can't be
+// smaller than that, anything over the size is dropped and reported as truncated
+func WithReceiveBufferSize(bytes int) Option {
+	return func(r *multicastApiRegistry) error {
+		if bytes < registrationMessageSizeBytes {
+			return errors.New(fmt.Sprint("bytes must be >= ", registrationMessageSizeBytes, " for WithReceiveBufferSize so messages we send ourselves fit"))
+		} else if bytes > maxDatagramSizeBytes {
+			return errors.New(fmt.Sprint("bytes must be <= ", maxDatagramSizeBytes, " for WithReceiveBufferSize"))
+		}
+		r.receiveBufferSize = bytes
+		return nil
+	}
+}
+
+// WithSendBudget caps how much this registry sends to the group. Messages beyond the budget are queued and sent once
+// there is budget for them, with a newer message for the same api replacing one that is still waiting. Control messages,
+// like digests, queries and active color switches, and answers sent straight to a peer take from the same budget, waiting
+// on it rather than being queued. 0 leaves that limit off
+func WithSendBudget(bytesPerSecond, packetsPerSecond int) Option {
+	return func(r *multicastApiRegistry) error {
+		if bytesPerSecond < 0 || packetsPerSecond < 0 {
+			return errors.New("bytesPerSecond and packetsPerSecond must be >= 0 for WithSendBudget")
+		} else if bytesPerSecond == 0 && packetsPerSecond == 0 {
+			return errors.New("at least one of bytesPerSecond or packetsPerSecond must be > 0 for WithSendBudget")
+		}
+		r.budget = newSendBudget(bytesPerSecond, packetsPerSecond, time.Now())
+		r.outbound = newSyncSendQueue(sendQueueMaxLen)
+		return nil
+	}
+}
+
+// WithRegistrationToken sets the token sent with every owned api that wasn't registered with its own apireg.WithToken
+func WithRegistrationToken(token string) Option {
+	return func(r *multicastApiRegistry) error {
+		r.defaultToken = token
+		return nil
+	}
+}
+
+// WithAdmissionTokens requires every announcement to carry a valid token for its api name. rules maps name patterns,
+// as used by path.Match like "billing-*" or "*", to the hashes (see HashRegistrationToken) of the tokens allowed to announce
+// those names. Announcements for names that no pattern covers are rejected
+func WithAdmissionTokens(rules map[string][]string) Option {
+	return func(r *multicastApiRegistry) error {
+		tokens, err := newAdmissionTokens(rules)
+
+		if err != nil {
+			return err
+		}
+		r.admissionTokens = tokens
+		return nil
+	}
+}
+
+// WithEncryptionKey encrypts every message with AES-GCM using the pre-shared key, which must be 16, 24 or 32 bytes.
+// Every registry on the group needs the same key, messages that aren't encrypted with it are dropped
+func WithEncryptionKey(key []byte) Option {
+	return WithEncryptionKeys(Key{Secret: key})
+}
+
+// WithEncryptionKeys is WithEncryptionKey with more than one key so they can be rotated. keys are ordered oldest to newest,
+// messages are encrypted with the newest and messages encrypted with any of them are accepted
+func WithEncryptionKeys(keys ...Key) Option {
+	return func(r *multicastApiRegistry) error {
+		c, err := newAESGCMCodec(keys, r.keyObserver("encryption"))
+
+		if err != nil {
+			return err
+		}
+		r.encryption = c
+		return nil
+	}
+}
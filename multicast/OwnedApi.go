@@ -0,0 +1,57 @@
+package multicast
+
+import (
+	"context"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+const healthCheckTimeout time.Duration = time.Second * 5
+
+// ownedApi is an Api that was registered by this registry along with the options it was registered with
+type ownedApi struct {
+	apireg.Api
+	opts *apireg.RegisterOptions
+}
+
+func newOwnedApi(a apireg.Api, opts *apireg.RegisterOptions) *ownedApi {
+	if opts == nil {
+		opts = apireg.NewRegisterOptions()
+	}
+	return &ownedApi{Api: a, opts: opts}
+}
+
+// withState returns a copy in state s that keeps the same options
+func (this *ownedApi) withState(s apireg.ApiState) (*ownedApi, error) {
+	a, err := apireg.CloneApi(this.Api, apireg.WithState(s))
+
+	if err != nil {
+		return nil, err
+	}
+	return newOwnedApi(a, this.opts), nil
+}
+
+// announceable runs the health check and returns what should be announced if anything along with why it was unhealthy
+func (this *ownedApi) announceable(ctx context.Context) (apireg.Api, bool, error) {
+	//Once draining it doesn't matter how healthy we are
+	if this.opts.HealthCheck == nil || this.State() == apireg.Draining {
+		return this.Api, true, nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	healthErr := this.opts.HealthCheck(checkCtx)
+
+	if healthErr == nil {
+		return this.Api, true, nil
+	} else if this.opts.UnhealthyPolicy == apireg.SkipAnnouncement {
+		return nil, false, healthErr
+	}
+
+	drainingApi, err := apireg.CloneApi(this.Api, apireg.WithState(apireg.Draining))
+	if err != nil {
+		return nil, false, err
+	}
+	return drainingApi, true, healthErr
+}
@@ -0,0 +1,49 @@
+package multicast
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+func TestThatOwnedApiWithoutHealthCheckIsAnnouncedAsIs(t *testing.T) {
+	o := newOwnedApi(getValidApi(), nil)
+
+	a, announce, err := o.announceable(context.Background())
+
+	if !announce || err != nil || a.State() != apireg.Serving {
+		t.Fail()
+	}
+}
+
+func TestThatUnhealthyOwnedApiIsAnnouncedAsDrainingByDefault(t *testing.T) {
+	o := newOwnedApi(getValidApi(), apireg.NewRegisterOptions(apireg.WithHealthy(func() bool { return false })))
+
+	a, announce, err := o.announceable(context.Background())
+
+	if !announce || err == nil || a.State() != apireg.Draining {
+		t.Fail()
+	}
+}
+
+func TestThatUnhealthyOwnedApiIsSkippedWithSkipPolicy(t *testing.T) {
+	o := newOwnedApi(getValidApi(), apireg.NewRegisterOptions(apireg.WithHealthy(func() bool { return false }), apireg.WithUnhealthyPolicy(apireg.SkipAnnouncement)))
+
+	_, announce, err := o.announceable(context.Background())
+
+	if announce || err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatOwnedApiWithStateKeepsOptions(t *testing.T) {
+	opts := apireg.NewRegisterOptions()
+	o := newOwnedApi(getValidApi(), opts)
+
+	drained, _ := o.withState(apireg.Draining)
+
+	if drained.opts != opts || drained.State() != apireg.Draining || !drained.Equal(o) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,53 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// WithPeerPings pings every peer that also has pings on each interval over unicast udp so that ListPeers can report their
+// round trip time and whether they are reachable at all. A peer that is reachable but has nothing registered is up with
+// its apis expired, where one that is unreachable is most likely down
+func WithPeerPings(interval time.Duration) Option {
+	return func(r *multicastApiRegistry) error {
+		maxInterval := registrationLifeSpan / time.Duration(unreachableAfterMissedPings+1)
+		if interval <= 0 {
+			return errors.New("interval must be > 0 for WithPeerPings")
+		} else if interval > maxInterval {
+			return errors.New(fmt.Sprint("interval must be <= ", maxInterval, " for WithPeerPings so peers are found unreachable before they are forgotten"))
+		}
+		r.pingInterval = interval
+		return nil
+	}
+}
+
+func (this *multicastApiRegistry) pingLoop(ctx context.Context) error {
+	pingTicker := time.NewTicker(this.pingInterval)
+	defer pingTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-pingTicker.C:
+			for _, curTarget := range this.peers.PingTargets(newNonce, t) {
+				err := this.writeUnicast(pingMessage, curTarget.nonce, curTarget.addr)
+				if err != nil {
+					log.Println("Error pinging peer", curTarget.id, "at", curTarget.addr, err)
+				}
+			}
+		}
+	}
+}
+
+// newNonce is never 0 so that 0 can mean there is no nonce, like no ping waiting on an answer
+func newNonce() uint64 {
+	for {
+		if nonce := rand.Uint64(); nonce != 0 {
+			return nonce
+		}
+	}
+}
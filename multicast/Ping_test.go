@@ -0,0 +1,63 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatPeersWithPingsOnAreReportedReachable(t *testing.T) {
+	reg0ID := uuid.New()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, reg0ID, WithPeerPings(time.Millisecond*50))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithPeerPings(time.Millisecond*50))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	reg0.RegisterApi("Pinged", apireg.NewVersion(0, 0, 1), 9406)
+	time.Sleep(time.Millisecond * 300)
+
+	for _, curPeer := range reg1.ListPeers() {
+		if curPeer.ID == reg0ID {
+			if curPeer.Reachability != apireg.Reachable || curPeer.RTT <= 0 {
+				t.Fail()
+			}
+			return
+		}
+	}
+	t.Fail()
+}
+
+func TestThatPeerWithoutPingsHasUnknownReachability(t *testing.T) {
+	reg0ID := uuid.New()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, reg0ID)
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithPeerPings(time.Millisecond*50))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	reg0.RegisterApi("Unpinged", apireg.NewVersion(0, 0, 1), 9407)
+	time.Sleep(time.Millisecond * 200)
+
+	for _, curPeer := range reg1.ListPeers() {
+		if curPeer.ID == reg0ID {
+			if curPeer.Reachability != apireg.ReachabilityUnknown {
+				t.Fail()
+			}
+			return
+		}
+	}
+	t.Fail()
+}
+
+func TestThatWithPeerPingsReturnsErrorForIntervalTooLongToNoticeBeforeExpiry(t *testing.T) {
+	if WithPeerPings(registrationLifeSpan)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
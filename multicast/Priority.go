@@ -0,0 +1,140 @@
+package multicast
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+const (
+	//How long after a change of a critical api it is sent again, and again after that
+	burstSpacing time.Duration = time.Millisecond * 500
+	//How often the burst loop checks for changes that are due to be sent again
+	burstCheckInterval time.Duration = time.Millisecond * 100
+	//No owned api is left longer than this between resends, by its tier or by suppression, so it always gets two chances
+	//before expiring
+	maxResendGap time.Duration = registrationLifeSpan / 2
+)
+
+// sendsPerChange is how many times in total a change to an api with priority p is sent
+func sendsPerChange(p apireg.Priority) int {
+	if p == apireg.CriticalPriority {
+		return 3
+	}
+	return 1
+}
+
+// resendInterval is how often an api with priority p is resent given the heartbeat interval
+func resendInterval(p apireg.Priority, interval time.Duration) time.Duration {
+	switch p {
+	case apireg.CriticalPriority:
+		return interval / 2
+	case apireg.BackgroundPriority:
+		if interval*2 <= maxResendGap {
+			return interval * 2
+		}
+	}
+	return interval
+}
+
+// resendSchedule is the order owned apis are resent in during heartbeat number cycle. Critical apis are in both halves
+// of it so that they go out twice as often, and background apis are left out of every other cycle when they can be
+func resendSchedule(owned []apireg.Api, cycle uint64, interval time.Duration) []apireg.Api {
+	critical := make([]apireg.Api, 0)
+	others := make([]apireg.Api, 0, len(owned))
+
+	for _, curOwned := range owned {
+		p := curOwned.(*ownedApi).opts.Priority
+		if p == apireg.CriticalPriority {
+			critical = append(critical, curOwned)
+		} else if p != apireg.BackgroundPriority || resendInterval(p, interval) == interval || cycle%2 == 0 {
+			others = append(others, curOwned)
+		}
+	}
+	if len(critical) == 0 {
+		return others
+	}
+	half := len(others) / 2
+	schedule := make([]apireg.Api, 0, len(critical)*2+len(others))
+	schedule = append(schedule, critical...)
+	schedule = append(schedule, others[:half]...)
+	schedule = append(schedule, critical...)
+	return append(schedule, others[half:]...)
+}
+
+type pendingBurst struct {
+	api       apireg.Api
+	opts      *apireg.RegisterOptions
+	remaining int
+	due       time.Time
+}
+
+// syncBurstQueue holds the changes that still have to be sent again, only the latest change for each api being kept
+type syncBurstQueue struct {
+	pending      map[string]*pendingBurst
+	pendingMutex *sync.Mutex
+}
+
+func newSyncBurstQueue() *syncBurstQueue {
+	q := &syncBurstQueue{}
+	q.pending = make(map[string]*pendingBurst)
+	q.pendingMutex = &sync.Mutex{}
+
+	return q
+}
+
+// Push has the change to a sent at t be sent again count times, burstSpacing apart
+func (this *syncBurstQueue) Push(a apireg.Api, opts *apireg.RegisterOptions, count int, t time.Time) {
+	this.pendingMutex.Lock()
+	this.pending[apiKey(a)] = &pendingBurst{api: a, opts: opts, remaining: count, due: t.Add(burstSpacing)}
+	this.pendingMutex.Unlock()
+}
+
+// TakeDue returns every change that is due to be sent again at t
+func (this *syncBurstQueue) TakeDue(t time.Time) []pendingBurst {
+	this.pendingMutex.Lock()
+	defer this.pendingMutex.Unlock()
+	due := make([]pendingBurst, 0)
+
+	for curKey, curBurst := range this.pending {
+		if curBurst.due.After(t) {
+			continue
+		}
+		due = append(due, *curBurst)
+		curBurst.remaining--
+		curBurst.due = curBurst.due.Add(burstSpacing)
+		if curBurst.remaining <= 0 {
+			delete(this.pending, curKey)
+		}
+	}
+	return due
+}
+
+// scheduleBurst has a change to a sent again if its priority calls for it
+func (this *multicastApiRegistry) scheduleBurst(a apireg.Api, opts *apireg.RegisterOptions) {
+	if repeats := sendsPerChange(opts.Priority) - 1; repeats > 0 {
+		this.bursts.Push(a, opts, repeats, time.Now())
+	}
+}
+
+func (this *multicastApiRegistry) burstLoop(ctx context.Context) error {
+	burstTicker := time.NewTicker(burstCheckInterval)
+	defer burstTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-burstTicker.C:
+			for _, curBurst := range this.bursts.TakeDue(t) {
+				//Whatever the api is now is sent so that a burst never undoes a change made after it
+				if current, owned := this.ownedApis.Get(curBurst.api); owned {
+					this.announceOwnedApi(ctx, current.(*ownedApi), false)
+				} else {
+					this.sendApiMessage(withdrawMessage, curBurst.api, curBurst.opts, false)
+				}
+			}
+		}
+	}
+}
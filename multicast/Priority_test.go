@@ -0,0 +1,82 @@
+package multicast
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func newTestOwnedApi(t *testing.T, name string, p apireg.Priority) apireg.Api {
+	a, err := apireg.NewApi(name, apireg.NewVersion(0, 0, 1), uuid.New(), apireg.All, net.ParseIP("0.0.0.0"), 80)
+	failOnErr(err, t)
+	return newOwnedApi(a, apireg.NewRegisterOptions(apireg.WithPriority(p)))
+}
+
+func countScheduled(schedule []apireg.Api, name string) int {
+	count := 0
+	for _, curApi := range schedule {
+		if curApi.Name() == name {
+			count++
+		}
+	}
+	return count
+}
+
+func TestThatCriticalApisAreResentTwicePerHeartbeat(t *testing.T) {
+	owned := []apireg.Api{newTestOwnedApi(t, "normal0", apireg.NormalPriority), newTestOwnedApi(t, "critical", apireg.CriticalPriority), newTestOwnedApi(t, "normal1", apireg.NormalPriority)}
+
+	schedule := resendSchedule(owned, 0, registrationUpdateInterval)
+
+	if len(schedule) != 4 || countScheduled(schedule, "critical") != 2 || schedule[0].Name() != "critical" || schedule[2].Name() != "critical" {
+		t.Fail()
+	}
+}
+
+func TestThatBackgroundApisAreResentEveryOtherHeartbeat(t *testing.T) {
+	owned := []apireg.Api{newTestOwnedApi(t, "normal", apireg.NormalPriority), newTestOwnedApi(t, "background", apireg.BackgroundPriority)}
+
+	if countScheduled(resendSchedule(owned, 0, registrationUpdateInterval), "background") != 1 {
+		t.Fail()
+	}
+	if countScheduled(resendSchedule(owned, 1, registrationUpdateInterval), "background") != 0 {
+		t.Fail()
+	}
+	//Skipping a heartbeat this slow could let it expire
+	if countScheduled(resendSchedule(owned, 1, defaultMaxHeartbeatInterval), "background") != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatBurstQueueOnlyKeepsLatestChange(t *testing.T) {
+	q := newSyncBurstQueue()
+	now := time.Now()
+	registered := newTestOwnedApi(t, "critical", apireg.CriticalPriority)
+	q.Push(registered, apireg.NewRegisterOptions(), 2, now)
+	q.Push(registered, apireg.NewRegisterOptions(), 1, now)
+
+	if len(q.TakeDue(now)) != 0 {
+		t.Fail()
+	}
+	if len(q.TakeDue(now.Add(burstSpacing))) != 1 || len(q.TakeDue(now.Add(burstSpacing*2))) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatCriticalRegistrationIsSentThreeTimes(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	go r.Run(context.Background())
+
+	failOnErr(r.RegisterApi("Critical", apireg.NewVersion(0, 0, 1), 9440, apireg.WithPriority(apireg.CriticalPriority)), t)
+	failOnErr(r.RegisterApi("Normal", apireg.NewVersion(0, 0, 1), 9441), t)
+	time.Sleep(burstSpacing*2 + burstCheckInterval*2)
+
+	if r.metrics.Value("apireg_sent_messages_total", nil) != 4 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,147 @@
+package multicast
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+)
+
+// PublisherRule lets the publishers it matches announce the api names matching any of its patterns. Publishers are matched
+// on every field that is set, so a rule with only Names set applies to everyone
+type PublisherRule struct {
+	//Names are patterns, as used by path.Match like "billing-*" or "*", of the api names that may be announced
+	Names []string
+	//KeyID of the signing key the announcement has to be signed with, see WithSigningKeys
+	KeyID string
+	//TokenHash of the token the announcement has to carry, see HashRegistrationToken
+	TokenHash string
+	//CIDR the announcement has to be sent from like "10.1.0.0/16"
+	CIDR string
+}
+
+// PolicyViolation is reported on Errors every time an announcement is rejected by the publisher policy
+type PolicyViolation struct {
+	ApiName    string
+	SenderUUID string
+	Source     net.IP
+	//KeyID the announcement was signed with, empty if it wasn't signed
+	KeyID string
+}
+
+func (this *PolicyViolation) Error() string {
+	return fmt.Sprint("publisher ", this.SenderUUID, " at ", this.Source, " with key id '", this.KeyID, "' is not allowed to announce ", this.ApiName)
+}
+
+// WithPublisherPolicy only tracks an announcement when one of rules matches who sent it and allows the name it announces,
+// so that one team can't shadow the names of another. Everything else is dropped, counted in apireg_policy_rejected_total
+// and reported on Errors as a *PolicyViolation. Snapshots can't tell who first announced each entry so nothing is taken
+// from them when a policy is set
+func WithPublisherPolicy(rules ...PublisherRule) Option {
+	return func(r *multicastApiRegistry) error {
+		policy, err := newPublisherPolicy(rules)
+
+		if err != nil {
+			return err
+		}
+		r.publisherPolicy = policy
+		return nil
+	}
+}
+
+// publisher is what we know about who sent an announcement
+type publisher struct {
+	keyID string
+	token string
+	ip    net.IP
+}
+
+type publisherRule struct {
+	names     []string
+	keyID     string
+	tokenHash []byte
+	network   *net.IPNet
+}
+
+// publisherPolicy decides which publishers may announce which names
+type publisherPolicy struct {
+	rules []*publisherRule
+}
+
+func newPublisherPolicy(rules []PublisherRule) (*publisherPolicy, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("at least one rule is required for WithPublisherPolicy")
+	}
+	p := &publisherPolicy{rules: make([]*publisherRule, 0, len(rules))}
+
+	for i, curRule := range rules {
+		if len(curRule.Names) == 0 {
+			return nil, errors.New(fmt.Sprint("publisher rule ", i, " has no names"))
+		}
+		rule := &publisherRule{names: curRule.Names, keyID: curRule.KeyID}
+
+		for _, curPattern := range curRule.Names {
+			if _, err := path.Match(curPattern, ""); err != nil {
+				return nil, errors.New(fmt.Sprint("Invalid pattern ", curPattern, " for publisher rule ", i, " ", err))
+			}
+		}
+		if curRule.TokenHash != "" {
+			hash, err := hex.DecodeString(curRule.TokenHash)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, errors.New(fmt.Sprint("Invalid token hash for publisher rule ", i, ", hashes must be hex encoded SHA-256"))
+			}
+			rule.tokenHash = hash
+		}
+		if curRule.CIDR != "" {
+			_, network, err := net.ParseCIDR(curRule.CIDR)
+			if err != nil {
+				return nil, errors.New(fmt.Sprint("Invalid CIDR for publisher rule ", i, " ", err))
+			}
+			rule.network = network
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// Allows returns true if any rule matching pub allows it to announce name
+func (this *publisherPolicy) Allows(name string, pub publisher) bool {
+	tokenHash := sha256.Sum256([]byte(pub.token))
+
+	for _, curRule := range this.rules {
+		if !curRule.matches(pub, tokenHash[:]) {
+			continue
+		}
+		for _, curPattern := range curRule.names {
+			if matched, _ := path.Match(curPattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this *publisherRule) matches(pub publisher, tokenHash []byte) bool {
+	if this.keyID != "" && this.keyID != pub.keyID {
+		return false
+	} else if this.tokenHash != nil && subtle.ConstantTimeCompare(this.tokenHash, tokenHash) != 1 {
+		return false
+	} else if this.network != nil && (pub.ip == nil || !this.network.Contains(pub.ip)) {
+		return false
+	}
+	return true
+}
+
+// admitPublisher returns false if the publisher policy doesn't let the sender of message, signed with keyID, send it for
+// its api name, reporting it as a *PolicyViolation
+func (this *multicastApiRegistry) admitPublisher(message *apiRegisterMessageJSON, keyID string, rAddr *net.UDPAddr) bool {
+	if this.publisherPolicy == nil || this.publisherPolicy.Allows(message.ApiName, publisher{keyID: keyID, token: message.Token, ip: rAddr.IP}) {
+		return true
+	}
+	this.metrics.Add("apireg_policy_rejected_total", "Number of announcements rejected by the publisher policy", map[string]string{"api": message.ApiName}, 1)
+	this.reportError(&PolicyViolation{ApiName: message.ApiName, SenderUUID: message.SenderUUID, Source: rAddr.IP, KeyID: keyID})
+	return false
+}
@@ -0,0 +1,72 @@
+package multicast
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatNewPublisherPolicyReturnsErrorForBadCIDR(t *testing.T) {
+	_, err := newPublisherPolicy([]PublisherRule{{Names: []string{"*"}, CIDR: "10.0.0.0"}})
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewPublisherPolicyReturnsErrorForRuleWithoutNames(t *testing.T) {
+	_, err := newPublisherPolicy([]PublisherRule{{KeyID: "k1"}})
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatPublisherFromCIDRCanOnlyAnnounceItsNames(t *testing.T) {
+	p, _ := newPublisherPolicy([]PublisherRule{{Names: []string{"billing-*"}, CIDR: "10.1.0.0/16"}})
+	billing := publisher{ip: net.ParseIP("10.1.2.3")}
+
+	if !p.Allows("billing-api", billing) || p.Allows("orders-api", billing) || p.Allows("billing-api", publisher{ip: net.ParseIP("10.2.2.3")}) {
+		t.Fail()
+	}
+}
+
+func TestThatPublisherRuleMatchesOnEverySetField(t *testing.T) {
+	p, _ := newPublisherPolicy([]PublisherRule{{Names: []string{"orders"}, KeyID: "orders-key", TokenHash: HashRegistrationToken("secret")}})
+
+	if !p.Allows("orders", publisher{keyID: "orders-key", token: "secret"}) ||
+		p.Allows("orders", publisher{keyID: "other-key", token: "secret"}) ||
+		p.Allows("orders", publisher{keyID: "orders-key", token: "guess"}) {
+		t.Fail()
+	}
+}
+
+func TestThatAnnouncementOutsidePolicyIsReportedAsViolation(t *testing.T) {
+	policy, _ := newPublisherPolicy([]PublisherRule{{Names: []string{"billing-*"}, CIDR: "10.1.0.0/16"}})
+	r := &multicastApiRegistry{id: uuid.New(), environment: apireg.All, errs: make(chan error, 1), metrics: newSyncMetricStore(), codec: plainCodec{},
+		loss: newSyncLossTracker(), apiRegs: newSyncApiRegistrationStore(nil), peers: newSyncPeerStore(), activeColors: newSyncActiveColors(), initialSync: newInitialSync(), publisherPolicy: policy}
+	payload := []byte(`{"api-name":"billing-api","api-version":{"major":1},"api-port":80,"sender-uuid":"` + uuid.NewString() + `","env":"all"}`)
+
+	r.handleMessage(payload, &net.UDPAddr{IP: net.ParseIP("10.2.0.3"), Port: 5324}, "")
+
+	var violation *PolicyViolation
+	if len(r.GetAvailableApis()) != 0 || len(r.errs) != 1 || !errors.As(<-r.errs, &violation) || violation.ApiName != "billing-api" {
+		t.Fail()
+	}
+}
+
+func TestThatAnnouncementWithinPolicyIsTracked(t *testing.T) {
+	policy, _ := newPublisherPolicy([]PublisherRule{{Names: []string{"billing-*"}, CIDR: "10.1.0.0/16"}})
+	r := &multicastApiRegistry{id: uuid.New(), environment: apireg.All, errs: make(chan error, 1), metrics: newSyncMetricStore(), codec: plainCodec{},
+		loss: newSyncLossTracker(), apiRegs: newSyncApiRegistrationStore(nil), peers: newSyncPeerStore(), activeColors: newSyncActiveColors(), initialSync: newInitialSync(), publisherPolicy: policy}
+	payload := []byte(`{"api-name":"billing-api","api-version":{"major":1},"api-port":80,"sender-uuid":"` + uuid.NewString() + `","env":"all"}`)
+
+	r.handleMessage(payload, &net.UDPAddr{IP: net.ParseIP("10.1.0.3"), Port: 5324}, "")
+
+	if len(r.GetAvailableApis()) != 1 || len(r.errs) != 0 {
+		t.Fail()
+	}
+}
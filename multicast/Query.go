@@ -0,0 +1,127 @@
+package multicast
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+const (
+	//How long WaitForApi waits on answers before asking again
+	queryRetryInterval time.Duration = time.Second
+	//How many queries can be answered at once, anything more is dropped as the asker will ask again
+	maxConcurrentQueryAnswers int = 8
+)
+
+// WithNameQueries opens a unicast socket so that owners answer our queries, see WaitForApi, straight to us. Without it
+// owners answer by announcing to the whole group
+func WithNameQueries() Option {
+	return func(r *multicastApiRegistry) error {
+		r.nameQueries = true
+		return nil
+	}
+}
+
+func (this *multicastApiRegistry) WaitForApi(ctx context.Context, name string) ([]apireg.Api, error) {
+	name = this.normalizeName(name)
+	waiter := &apiWaiter{name: name, changed: make(chan struct{}, 1)}
+	this.AddEventListener(waiter)
+	defer this.RemoveEventListener(waiter)
+	retryTicker := time.NewTicker(queryRetryInterval)
+	defer retryTicker.Stop()
+
+	for {
+		if apis := this.servingApis(name); len(apis) > 0 {
+			return apis, nil
+		}
+		err := this.writeControl(&apiRegisterMessageJSON{Type: queryMessage, ApiName: name})
+		if err != nil {
+			log.Println("Error querying for", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-waiter.changed:
+		case <-retryTicker.C:
+		}
+	}
+}
+
+// servingApis returns every Api named name that is Serving
+func (this *multicastApiRegistry) servingApis(name string) []apireg.Api {
+	apis := make([]apireg.Api, 0)
+	for _, curApi := range this.GetApisByApiName(name) {
+		if curApi.State() == apireg.Serving {
+			apis = append(apis, curApi)
+		}
+	}
+	return apis
+}
+
+// handleQuery answers a query for one of our owned apis. Answering runs health checks so it happens off the listen loop
+func (this *multicastApiRegistry) handleQuery(message *apiRegisterMessageJSON, rAddr *net.UDPAddr) {
+	owned := make([]*ownedApi, 0)
+	for _, curOwned := range this.ownedApis.All() {
+		if curOwned.Name() == message.ApiName {
+			owned = append(owned, curOwned.(*ownedApi))
+		}
+	}
+	if len(owned) == 0 {
+		return
+	}
+
+	select {
+	case this.queryAnswers <- struct{}{}:
+	default:
+		this.metrics.Add("apireg_queries_dropped_total", "Number of queries for our apis not answered as too many were being answered already", nil, 1)
+		return
+	}
+	go func() {
+		defer func() { <-this.queryAnswers }()
+		for _, curOwned := range owned {
+			if this.answerQuery(curOwned, message.UnicastPort, rAddr) {
+				this.metrics.Add("apireg_queries_answered_total", "Number of queries answered for one of our apis", nil, 1)
+			}
+		}
+	}()
+}
+
+// answerQuery sends o straight to whoever asked for it if they can be reached on unicastPort, otherwise to the group,
+// returning true if it was sent straight to them
+func (this *multicastApiRegistry) answerQuery(o *ownedApi, unicastPort int, rAddr *net.UDPAddr) bool {
+	if unicastPort == 0 {
+		this.announceOwnedApi(context.Background(), o, false)
+		return false
+	}
+	a, announce := this.checkOwnedApi(context.Background(), o)
+
+	if !announce {
+		return false
+	}
+	err := this.writeUnicastMessage(this.newApiMessage(answerMessage, a, o.opts), &net.UDPAddr{IP: rAddr.IP, Port: unicastPort})
+	if err != nil {
+		log.Println("Error answering query for", o.Name(), "from", rAddr, err)
+		return false
+	}
+	return true
+}
+
+// apiWaiter lets WaitForApi know when anything changes for the name it is waiting on
+type apiWaiter struct {
+	name    string
+	changed chan struct{}
+}
+
+func (this *apiWaiter) HandleRegistration(e apireg.RegistrationEvent) {
+	if e.Api().Name() != this.name {
+		return
+	}
+	select {
+	case this.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,64 @@
+package multicast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatWaitForApiIsAnsweredOverUnicast(t *testing.T) {
+	b := NewBroker()
+	owner, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer owner.Close()
+	go owner.Run(context.Background())
+	failOnErr(owner.RegisterApi("Queried", apireg.NewVersion(0, 0, 1), 9470), t)
+	//Only joins after the owner announced so it has to ask
+	consumer, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithNameQueries())
+	failOnErr(err, t)
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), queryRetryInterval/2)
+	defer cancel()
+
+	apis, err := consumer.WaitForApi(ctx, "Queried")
+	//The owner counts the answer once it is sent which can be after it arrived
+	time.Sleep(time.Millisecond * 20)
+
+	if err != nil || len(apis) != 1 || apis[0].HostPort() != 9470 || owner.metrics.Value("apireg_queries_answered_total", nil) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWaitForApiIsAnsweredOnGroupWithoutUnicast(t *testing.T) {
+	b := NewBroker()
+	owner, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer owner.Close()
+	failOnErr(owner.RegisterApi("Queried", apireg.NewVersion(0, 0, 1), 9471), t)
+	consumer, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), queryRetryInterval/2)
+	defer cancel()
+
+	apis, err := consumer.WaitForApi(ctx, "Queried")
+
+	if err != nil || len(apis) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWaitForApiReturnsErrorOnceContextIsDone(t *testing.T) {
+	r, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if _, err := r.WaitForApi(ctx, "Missing"); err != context.DeadlineExceeded {
+		t.Fail()
+	}
+}
@@ -0,0 +1,42 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+const (
+	//SelfApiName is the well known name registries register themselves under with WithSelfRegistration
+	SelfApiName string = "_registry"
+	//AgentVersionTag is the tag of a self registration holding the full AGENT_VERSION of the registry
+	AgentVersionTag string = "agent-version"
+)
+
+// WithSelfRegistration registers the registry itself as SelfApiName on debugPort, versioned with AGENT_VERSION, so that
+// tooling can find every registry taking part, what version each one runs and where its debug endpoint is by calling
+// GetApisByApiName(SelfApiName) on any of them
+func WithSelfRegistration(debugPort int) Option {
+	return func(r *multicastApiRegistry) error {
+		if debugPort <= 0 || debugPort > 65535 {
+			return errors.New("debugPort must be a valid port for WithSelfRegistration")
+		}
+		r.selfRegistrationPort = debugPort
+		return nil
+	}
+}
+
+func (this *multicastApiRegistry) registerSelf() error {
+	if this.selfRegistrationPort == 0 {
+		return nil
+	}
+	return this.RegisterApi(SelfApiName, agentVersion(), this.selfRegistrationPort, apireg.WithTags(map[string]string{AgentVersionTag: AGENT_VERSION}))
+}
+
+// agentVersion is AGENT_VERSION as a Version, any part that can't be read being left at 0
+func agentVersion() apireg.Version {
+	var major, minor, bugfix uint
+	fmt.Sscanf(AGENT_VERSION, "%d.%d.%d", &major, &minor, &bugfix)
+	return apireg.NewVersion(major, minor, bugfix)
+}
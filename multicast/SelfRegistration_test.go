@@ -0,0 +1,38 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatWithSelfRegistrationNeedsValidPort(t *testing.T) {
+	if WithSelfRegistration(0)(&multicastApiRegistry{}) == nil || WithSelfRegistration(70000)(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatAgentVersionIsReadFromAgentVersionConstant(t *testing.T) {
+	if agentVersion().String() != "v"+AGENT_VERSION {
+		t.Fail()
+	}
+}
+
+func TestThatSelfRegisteredRegistryIsFoundByOthers(t *testing.T) {
+	b := NewBroker()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithSelfRegistration(6060))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	time.Sleep(time.Millisecond * 50)
+
+	apis := reg1.GetApisByApiName(SelfApiName)
+	if len(apis) != 1 || apis[0].HostPort() != 6060 || apis[0].Tags()[AgentVersionTag] != AGENT_VERSION || !apis[0].Version().Equal(agentVersion()) {
+		t.Fail()
+	}
+}
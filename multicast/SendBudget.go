@@ -0,0 +1,84 @@
+package multicast
+
+import (
+	"sync"
+	"time"
+)
+
+// The budget can be saved up for at most this long so a quiet registry can only burst a little before being smoothed
+const sendBudgetBurstWindow time.Duration = time.Second
+
+// sendBudget is a token bucket for both bytes and packets sent per second. A rate of 0 means that dimension is unlimited
+type sendBudget struct {
+	bytesPerSec   float64
+	packetsPerSec float64
+	byteTokens    float64
+	packetTokens  float64
+	maxBytes      float64
+	maxPackets    float64
+	last          time.Time
+	budgetMutex   *sync.Mutex
+}
+
+func newSendBudget(bytesPerSec, packetsPerSec int, now time.Time) *sendBudget {
+	b := &sendBudget{bytesPerSec: float64(bytesPerSec), packetsPerSec: float64(packetsPerSec), last: now, budgetMutex: &sync.Mutex{}}
+	b.maxBytes = b.bytesPerSec * sendBudgetBurstWindow.Seconds()
+	//Always be able to save up for at least one message otherwise a big message could never be sent
+	if b.maxBytes < float64(registrationMessageSizeBytes) {
+		b.maxBytes = float64(registrationMessageSizeBytes)
+	}
+	b.maxPackets = b.packetsPerSec * sendBudgetBurstWindow.Seconds()
+	if b.maxPackets < 1 {
+		b.maxPackets = 1
+	}
+	b.byteTokens = b.maxBytes
+	b.packetTokens = b.maxPackets
+
+	return b
+}
+
+// Reserve takes size bytes and one packet out of the budget and returns how long to wait before sending them
+func (this *sendBudget) Reserve(size int, now time.Time) time.Duration {
+	this.budgetMutex.Lock()
+	defer this.budgetMutex.Unlock()
+
+	elapsed := now.Sub(this.last).Seconds()
+	if elapsed > 0 {
+		this.byteTokens = refill(this.byteTokens, this.maxBytes, this.bytesPerSec*elapsed)
+		this.packetTokens = refill(this.packetTokens, this.maxPackets, this.packetsPerSec*elapsed)
+		this.last = now
+	}
+
+	var wait time.Duration
+	if this.bytesPerSec > 0 {
+		this.byteTokens -= float64(size)
+		wait = maxDuration(wait, deficitWait(this.byteTokens, this.bytesPerSec))
+	}
+	if this.packetsPerSec > 0 {
+		this.packetTokens--
+		wait = maxDuration(wait, deficitWait(this.packetTokens, this.packetsPerSec))
+	}
+	return wait
+}
+
+func refill(tokens, max, added float64) float64 {
+	tokens += added
+	if tokens > max {
+		return max
+	}
+	return tokens
+}
+
+func deficitWait(tokens, perSec float64) time.Duration {
+	if tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tokens / perSec * float64(time.Second))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
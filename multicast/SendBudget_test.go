@@ -0,0 +1,58 @@
+package multicast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThatSendBudgetAllowsFirstMessageRightAway(t *testing.T) {
+	now := time.Now()
+	b := newSendBudget(1000, 0, now)
+
+	if b.Reserve(500, now) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatSendBudgetDefersOnceBytesAreUsedUp(t *testing.T) {
+	now := time.Now()
+	b := newSendBudget(2000, 0, now)
+
+	b.Reserve(2000, now)
+
+	if b.Reserve(1000, now) != time.Millisecond*500 {
+		t.Fail()
+	}
+}
+
+func TestThatSendBudgetDefersOncePacketsAreUsedUp(t *testing.T) {
+	now := time.Now()
+	b := newSendBudget(0, 2, now)
+
+	b.Reserve(10, now)
+	b.Reserve(10, now)
+
+	if b.Reserve(10, now) != time.Millisecond*500 {
+		t.Fail()
+	}
+}
+
+func TestThatSendBudgetRefillsOverTime(t *testing.T) {
+	now := time.Now()
+	b := newSendBudget(2000, 0, now)
+
+	b.Reserve(2000, now)
+
+	if b.Reserve(1000, now.Add(time.Second)) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatSendBudgetDoesNotSaveUpMoreThanItsBurst(t *testing.T) {
+	now := time.Now()
+	b := newSendBudget(2000, 0, now)
+
+	if b.Reserve(4000, now.Add(time.Hour)) != time.Second {
+		t.Fail()
+	}
+}
@@ -0,0 +1,191 @@
+package multicast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sendQueueMaxLen int = 1024
+	//How long shutting down waits on the send budget to get out whatever is still queued, like our withdrawals
+	outboundFlushTimeout time.Duration = time.Second * 2
+)
+
+// send writes message to the group right away, or queues it until the send budget allows it if there is one.
+// Messages with the same key replace each other while queued
+func (this *multicastApiRegistry) send(key string, message *apiRegisterMessageJSON) error {
+	if this.budget == nil {
+		return this.writeMessage(message)
+	}
+	if !this.outbound.Push(key, message) {
+		this.metrics.Add("apireg_send_dropped_total", "Number of messages dropped without being sent because of the send budget", nil, 1)
+		return errors.New(fmt.Sprint("Send queue is full, dropping ", message.Type, " message for ", message.ApiName))
+	}
+	return nil
+}
+
+// writeMessage writes message to the group right away
+func (this *multicastApiRegistry) writeMessage(message *apiRegisterMessageJSON) error {
+	datagrams, err := this.encodeMessage(message)
+
+	if err != nil {
+		return err
+	}
+	for _, curDatagram := range datagrams {
+		if err := this.writeToGroup(curDatagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMessage stamps message with the next sequence number and encodes it, split into fragments if it doesn't fit in
+// one datagram
+func (this *multicastApiRegistry) encodeMessage(message *apiRegisterMessageJSON) ([][]byte, error) {
+	//Stamped here rather than when queued so that replaced messages don't look like loss to everyone else
+	message.Seq = atomic.AddUint64(&this.seq, 1)
+	return this.encodeDatagrams(message)
+}
+
+// encodeQueued encodes the message of m, with the sequence number it already had if it was put back in the queue
+func (this *multicastApiRegistry) encodeQueued(m *queuedMessage) ([][]byte, error) {
+	if m.seq == 0 {
+		return this.encodeMessage(m.message)
+	}
+	m.message.Seq = m.seq
+	return this.encodeDatagrams(m.message)
+}
+
+// encodeDatagrams encodes message as is, split into fragments if it doesn't fit in one datagram
+func (this *multicastApiRegistry) encodeDatagrams(message *apiRegisterMessageJSON) ([][]byte, error) {
+	payload, err := encodeJSON(message)
+
+	if err != nil {
+		return nil, err
+	}
+	data, err := this.codec.Encode(payload)
+
+	if err != nil {
+		return nil, err
+	} else if len(data) > this.maxPayload {
+		return this.fragmentPayload(message, payload)
+	}
+	return [][]byte{data}, nil
+}
+
+// encodePayload encodes message as is, checking that it fits in one datagram
+func (this *multicastApiRegistry) encodePayload(message *apiRegisterMessageJSON) ([]byte, error) {
+	payload, err := encodeJSON(message)
+
+	if err != nil {
+		return nil, err
+	}
+	data, err := this.codec.Encode(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > this.maxPayload {
+		return nil, errors.New(fmt.Sprint("Message size for ", message.ApiName, " exceeds max length of ", this.maxPayload, " bytes"))
+	}
+	return data, nil
+}
+
+func encodeJSON(message *apiRegisterMessageJSON) ([]byte, error) {
+	dataOut := bytes.NewBuffer(make([]byte, 0, registrationMessageSizeBytes))
+	err := json.NewEncoder(dataOut).Encode(message)
+
+	return dataOut.Bytes(), err
+}
+
+func (this *multicastApiRegistry) writeToGroup(payload []byte) error {
+	err := this.transport.Write(payload)
+
+	if err == nil {
+		this.metrics.Add("apireg_sent_messages_total", "Number of messages sent to the group", nil, 1)
+		this.metrics.Add("apireg_sent_bytes_total", "Number of bytes sent to the group", nil, float64(len(payload)))
+	}
+	return err
+}
+
+func (this *multicastApiRegistry) budgetedSendLoop(ctx context.Context) error {
+	for {
+		m, popped := this.outbound.Pop(ctx)
+
+		if !popped {
+			return nil
+		}
+		datagrams, err := this.encodeQueued(m)
+		if err != nil {
+			this.reportError(err)
+			continue
+		}
+
+		wait := this.reserveBudget(datagrams)
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				//Leave it for flushOutbound
+				this.outbound.PushFront(m)
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		for _, curDatagram := range datagrams {
+			if err := this.writeToGroup(curDatagram); err != nil {
+				this.reportError(err)
+				break
+			}
+		}
+	}
+}
+
+// flushOutbound sends whatever is still queued as long as the budget allows it within outboundFlushTimeout
+func (this *multicastApiRegistry) flushOutbound() {
+	if this.outbound == nil {
+		return
+	}
+	deadline := time.Now().Add(outboundFlushTimeout)
+	for m, popped := this.outbound.TryPop(); popped; m, popped = this.outbound.TryPop() {
+		datagrams, err := this.encodeQueued(m)
+		if err != nil {
+			continue
+		}
+		wait := this.reserveBudget(datagrams)
+
+		if time.Now().Add(wait).After(deadline) {
+			this.metrics.Add("apireg_send_dropped_total", "Number of messages dropped without being sent because of the send budget", nil, float64(1+this.outbound.Len()))
+			return
+		}
+		time.Sleep(wait)
+		for _, curDatagram := range datagrams {
+			this.writeToGroup(curDatagram)
+		}
+	}
+}
+
+// waitForBudget holds up messages that aren't queued, like control messages, until the send budget allows datagrams
+func (this *multicastApiRegistry) waitForBudget(datagrams [][]byte) {
+	if this.budget == nil {
+		return
+	}
+	time.Sleep(this.reserveBudget(datagrams))
+}
+
+// reserveBudget takes every one of datagrams out of the send budget and returns how long to wait before sending them
+func (this *multicastApiRegistry) reserveBudget(datagrams [][]byte) time.Duration {
+	var wait time.Duration
+	now := time.Now()
+	//Each reservation waits on everything reserved before it so the last one covers them all
+	for _, curDatagram := range datagrams {
+		wait = this.budget.Reserve(len(curDatagram), now)
+	}
+	return wait
+}
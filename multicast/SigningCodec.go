@@ -0,0 +1,141 @@
+package multicast
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WithSigningKeys signs every message with HMAC-SHA256, messages that aren't signed by one of keys are dropped. keys are
+// ordered oldest to newest the same as for WithEncryptionKeys and need to be at least 32 bytes
+func WithSigningKeys(keys ...Key) Option {
+	return func(r *multicastApiRegistry) error {
+		c, err := newHMACCodec(keys, r.keyObserver("signing"))
+
+		if err != nil {
+			return err
+		}
+		r.signing = c
+		return nil
+	}
+}
+
+var (
+	errNotSigned        = errors.New("message is not signed")
+	errUnknownKeyID     = errors.New("message is signed with unknown key id")
+	errInvalidSignature = errors.New("message has an invalid signature")
+)
+
+// unknownKeyIDError is errUnknownKeyID along with the key id, so whoever sees it knows which key is missing
+type unknownKeyIDError struct {
+	keyID string
+}
+
+func (this *unknownKeyIDError) Error() string {
+	return fmt.Sprint(errUnknownKeyID, " ", this.keyID)
+}
+
+func (this *unknownKeyIDError) Unwrap() error {
+	return errUnknownKeyID
+}
+
+// unverifiedError is a message failing its signature check with err, along with what it carries so it can still be
+// accepted under VerifyAndLog
+type unverifiedError struct {
+	err     error
+	payload []byte
+}
+
+func (this *unverifiedError) Error() string {
+	return this.err.Error()
+}
+
+func (this *unverifiedError) Unwrap() error {
+	return this.err
+}
+
+type signedEnvelopeJSON struct {
+	KeyID     string          `json:"kid,omitempty"`
+	Signature []byte          `json:"sig"`
+	Payload   json.RawMessage `json:"msg"`
+}
+
+// hmacCodec signs every message with HMAC-SHA256 using the newest key so receivers know it came from someone holding a key
+type hmacCodec struct {
+	keys *keyRing[[]byte]
+	//Called with the key id of every message decoded
+	observeKey func(kid string)
+}
+
+func newHMACCodec(keys []Key, observeKey func(kid string)) (*hmacCodec, error) {
+	ring, err := newKeyRing(keys, func(secret []byte) ([]byte, error) {
+		if len(secret) < sha256.Size {
+			return nil, errors.New(fmt.Sprint("signing keys must be at least ", sha256.Size, " bytes"))
+		}
+		return secret, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &hmacCodec{keys: ring, observeKey: observeKey}, nil
+}
+
+func sign(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (this *hmacCodec) Encode(payload []byte) ([]byte, error) {
+	kid, secret := this.keys.Newest()
+	//Trim the trailing newline from the json encoder so the raw message is exactly what was signed
+	payload = bytes.TrimSpace(payload)
+
+	return json.Marshal(&signedEnvelopeJSON{KeyID: kid, Signature: sign(secret, payload), Payload: payload})
+}
+
+func (this *hmacCodec) Decode(data []byte) ([]byte, error) {
+	payload, _, err := this.open(data)
+	return payload, err
+}
+
+// open is Decode that also returns the id of the key the message was signed with. Messages that fail the signature
+// check come back as an *unverifiedError
+func (this *hmacCodec) open(data []byte) ([]byte, string, error) {
+	envelope := &signedEnvelopeJSON{}
+
+	err := json.NewDecoder(bytes.NewReader(data)).Decode(envelope)
+
+	if err != nil {
+		return nil, "", &unverifiedError{err: err, payload: data}
+	} else if envelope.Signature == nil || envelope.Payload == nil {
+		return nil, "", &unverifiedError{err: errNotSigned, payload: this.unverified(data)}
+	}
+
+	secret, contains := this.keys.Get(envelope.KeyID)
+
+	if !contains {
+		return nil, "", &unverifiedError{err: &unknownKeyIDError{keyID: envelope.KeyID}, payload: envelope.Payload}
+	} else if !hmac.Equal(envelope.Signature, sign(secret, envelope.Payload)) {
+		return nil, "", &unverifiedError{err: errInvalidSignature, payload: envelope.Payload}
+	}
+
+	if this.observeKey != nil {
+		this.observeKey(envelope.KeyID)
+	}
+	return envelope.Payload, envelope.KeyID, nil
+}
+
+// unverified returns what data carries without checking its signature, which is data itself when it isn't signed at all
+func (this *hmacCodec) unverified(data []byte) []byte {
+	envelope := &signedEnvelopeJSON{}
+
+	if json.NewDecoder(bytes.NewReader(data)).Decode(envelope) != nil || envelope.Payload == nil {
+		return data
+	}
+	return envelope.Payload
+}
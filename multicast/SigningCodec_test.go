@@ -0,0 +1,83 @@
+package multicast
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestThatNewHMACCodecReturnsErrorForShortKey(t *testing.T) {
+	_, err := newHMACCodec([]Key{{Secret: []byte("short")}}, nil)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatHMACCodecDecodesWhatItEncodes(t *testing.T) {
+	c, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	payload := []byte(`{"api-name":"Something"}`)
+
+	data, _ := c.Encode(append(payload, '\n'))
+	decoded, err := c.Decode(data)
+
+	if err != nil || !bytes.Equal(decoded, payload) {
+		t.Fail()
+	}
+}
+
+func TestThatHMACCodecRejectsTamperedMessages(t *testing.T) {
+	c, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+
+	data, _ := c.Encode([]byte(`{"api-port":80}`))
+	data = bytes.Replace(data, []byte("80"), []byte("81"), 1)
+
+	if _, err := c.Decode(data); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatHMACCodecRejectsUnsignedMessages(t *testing.T) {
+	c, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+
+	if _, err := c.Decode([]byte(`{"api-name":"Something"}`)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatHMACCodecRejectsUnknownKeyID(t *testing.T) {
+	c0, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	c1, _ := newHMACCodec([]Key{{ID: "b", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+
+	data, _ := c0.Encode([]byte(`{"api-name":"Something"}`))
+
+	if _, err := c1.Decode(data); !errors.Is(err, errUnknownKeyID) || err.Error() != "message is signed with unknown key id a" {
+		t.Fail()
+	}
+}
+
+func TestThatHMACCodecReportsKeyIDSeen(t *testing.T) {
+	var seenKid string
+	c, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}, {ID: "b", Secret: bytes.Repeat([]byte{2}, 32)}}, func(kid string) { seenKid = kid })
+
+	data, _ := c.Encode([]byte(`{"api-name":"Something"}`))
+	c.Decode(data)
+
+	if seenKid != "b" {
+		t.Fail()
+	}
+}
+
+func TestThatChainGivesKeyIDOfSignerUnderEncryption(t *testing.T) {
+	signing, _ := newHMACCodec([]Key{{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}}, nil)
+	encryption, err := newAESGCMCodec([]Key{{ID: "e", Secret: bytes.Repeat([]byte{2}, 32)}}, nil)
+	failOnErr(err, t)
+	chain := chainCodec{signing, encryption}
+
+	data, _ := chain.Encode([]byte(`{"api-name":"Something"}`))
+	payload, keyID, err := openWith(chain, data)
+
+	if err != nil || keyID != "a" || string(payload) != `{"api-name":"Something"}` {
+		t.Fail()
+	}
+}
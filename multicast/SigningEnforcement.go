@@ -0,0 +1,92 @@
+package multicast
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// SigningEnforcement is what happens to received messages that aren't signed with one of the keys of WithSigningKeys
+type SigningEnforcement string
+
+const (
+	//Drop them, which is what happens without WithSigningEnforcement
+	EnforceSignatures SigningEnforcement = "enforce"
+	//Accept them as if they had been signed, counting and logging them so that the senders can be found and upgraded
+	VerifyAndLog SigningEnforcement = "verify-and-log"
+)
+
+// WithSigningEnforcement sets what happens to messages that fail the signature checks of WithSigningKeys. VerifyAndLog
+// accepts them anyway so signing can be rolled out a node at a time, counting each one in apireg_unverified_messages_total
+// by reason and logging the first from every source. Every message we send is still signed. Once the count stops going up
+// the fleet is clean and EnforceSignatures, or dropping this option, starts dropping them. Messages accepted this way have
+// no key id so a publisher policy that requires one still rejects them
+func WithSigningEnforcement(mode SigningEnforcement) Option {
+	return func(r *multicastApiRegistry) error {
+		if mode != EnforceSignatures && mode != VerifyAndLog {
+			return errors.New("mode must be EnforceSignatures or VerifyAndLog for WithSigningEnforcement")
+		}
+		r.signingEnforcement = mode
+		return nil
+	}
+}
+
+// How many sources syncUnverifiedSources remembers before forgetting them all, so sources spread over a big network or
+// spoofed ones can't grow it forever. Forgotten sources are just logged again
+const maxUnverifiedSources = 1024
+
+// syncUnverifiedSources remembers which sources have sent messages that failed signature checks
+type syncUnverifiedSources struct {
+	sources map[string]bool
+	mutex   *sync.Mutex
+}
+
+func newSyncUnverifiedSources() *syncUnverifiedSources {
+	s := &syncUnverifiedSources{}
+	s.sources = make(map[string]bool)
+	s.mutex = &sync.Mutex{}
+
+	return s
+}
+
+// Add records source and returns true if it is the first time it has been seen
+func (this *syncUnverifiedSources) Add(source string) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.sources[source] {
+		return false
+	}
+	if len(this.sources) >= maxUnverifiedSources {
+		this.sources = make(map[string]bool)
+	}
+	this.sources[source] = true
+	return true
+}
+
+// unverifiedReason is the metric label for why a message failed its signature check with err
+func unverifiedReason(err error) string {
+	switch {
+	case errors.Is(err, errNotSigned):
+		return "unsigned"
+	case errors.Is(err, errUnknownKeyID):
+		return "unknown-key"
+	case errors.Is(err, errInvalidSignature):
+		return "invalid-signature"
+	}
+	return "malformed"
+}
+
+// recordUnverified counts a message from rAddr that was accepted even though it failed its signature check with err
+func (this *multicastApiRegistry) recordUnverified(err error, rAddr *net.UDPAddr) {
+	reason := unverifiedReason(err)
+	this.metrics.Add("apireg_unverified_messages_total", "Number of messages accepted without a valid signature", map[string]string{"reason": reason}, 1)
+
+	source := "unknown"
+	if rAddr != nil {
+		source = rAddr.IP.String()
+	}
+	if this.unverified.Add(source) {
+		log.Println("Accepting messages from", source, "without a valid signature:", err)
+	}
+}
@@ -0,0 +1,97 @@
+package multicast
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+var enforcementKey = Key{ID: "a", Secret: bytes.Repeat([]byte{1}, 32)}
+
+func TestThatVerifyAndLogNeedsSigningKeys(t *testing.T) {
+	_, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSigningEnforcement(VerifyAndLog))
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatWithSigningEnforcementRejectsUnknownMode(t *testing.T) {
+	if WithSigningEnforcement("lenient")(&multicastApiRegistry{}) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatVerifyAndLogAcceptsUnsignedMessages(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSigningKeys(enforcementKey), WithSigningEnforcement(VerifyAndLog))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Something", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Something", 8081, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Something")) != 2 || r.metrics.Value("apireg_unverified_messages_total", map[string]string{"reason": "unsigned"}) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatVerifyAndLogAcceptsMessagesSignedWithOtherKeys(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSigningKeys(enforcementKey), WithSigningEnforcement(VerifyAndLog))
+	failOnErr(err, t)
+	defer r.Close()
+	other, _ := newHMACCodec([]Key{{ID: "b", Secret: bytes.Repeat([]byte{2}, 32)}}, nil)
+
+	data, _ := other.Encode(sequencedMessageOfType(registerMessage, "Something", 8080, apireg.Serving, uuid.NewString(), 0))
+	r.handleMessage(data, hookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Something")) != 1 || r.metrics.Value("apireg_unverified_messages_total", map[string]string{"reason": "unknown-key"}) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatEnforcedSigningDropsUnsignedMessages(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSigningKeys(enforcementKey), WithSigningEnforcement(EnforceSignatures))
+	failOnErr(err, t)
+	defer r.Close()
+
+	r.handleMessage(sequencedMessageOfType(registerMessage, "Something", 8080, apireg.Serving, uuid.NewString(), 0), hookSource, r.groups[0].name)
+
+	if len(r.GetApisByApiName("Something")) != 0 || r.metrics.Value("apireg_decode_failures_total", nil) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatVerifyAndLogStillSigns(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithSigningKeys(enforcementKey), WithSigningEnforcement(VerifyAndLog))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b), WithSigningKeys(enforcementKey))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg0.RegisterApi("Something", apireg.NewVersion(1, 0, 0), 8080), t)
+	time.Sleep(time.Millisecond * 50)
+
+	if len(reg1.GetApisByApiName("Something")) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatUnverifiedSourcesAreForgottenOnceFull(t *testing.T) {
+	s := newSyncUnverifiedSources()
+	for i := 0; i < maxUnverifiedSources; i++ {
+		s.Add(fmt.Sprint("10.0.", i/256, ".", i%256))
+	}
+	if s.Add("10.0.0.0") {
+		t.Fail()
+	}
+
+	if !s.Add("10.9.0.0") || len(s.sources) != 1 || !s.Add("10.0.0.0") {
+		t.Fail()
+	}
+}
@@ -0,0 +1,251 @@
+package multicast
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+const (
+	snapshotIOTimeout time.Duration = time.Second * 5
+	//Snapshots come from peers we only know from the group so don't trust them to keep them small
+	snapshotMaxBytes int64 = 4 << 20
+)
+
+// snapshotJSON is everything a registry knows, sent over the snapshot channel to registries that just joined
+type snapshotJSON struct {
+	SenderUUID string              `json:"sender-uuid"`
+	Entries    []snapshotEntryJSON `json:"entries"`
+}
+
+// snapshotEntryJSON is a registration as it would have been announced along with the ip it is served on, as that
+// can't be taken from the packet like it can for announcements
+type snapshotEntryJSON struct {
+	apiRegisterMessageJSON
+	HostIP string `json:"host-ip"`
+	//Group the entry was heard on by the peer, empty for the peer's own apis
+	Group string `json:"group,omitempty"`
+}
+
+// WithSnapshotServer serves a snapshot of every api this registry knows about over tcp on addr, like ":5325", so that
+// registries that just joined don't have to wait a full heartbeat to see everything. With a config the channel is TLS,
+// which is what should be used whenever the channel crosses routed networks, and setting ClientAuth in it limits who can
+// fetch. The TLS only covers this channel, the udp pings, acks and answers that go straight to peers are as unprotected as
+// the group unless WithSigningKeys or WithEncryptionKeys is used. The port is advertised in every announcement so peers
+// can find it
+func WithSnapshotServer(addr string, config *tls.Config) Option {
+	return func(r *multicastApiRegistry) error {
+		if addr == "" {
+			return errors.New("addr is required for WithSnapshotServer")
+		}
+		r.snapshotAddr = addr
+		r.snapshotTLS = config
+		return nil
+	}
+}
+
+// WithSnapshotBootstrap fetches a snapshot from the first peer that advertises a snapshot server and tracks everything
+// in it as if it had just been announced. With a config the snapshot is fetched over TLS, nil meaning plain tcp.
+// Snapshots don't carry registration tokens so nothing is taken from them when WithAdmissionTokens is also used
+func WithSnapshotBootstrap(config *tls.Config) Option {
+	return func(r *multicastApiRegistry) error {
+		r.bootstrapEnabled = true
+		r.bootstrapTLS = config
+		return nil
+	}
+}
+
+// listenSnapshots opens the snapshot listener if we are meant to be serving them
+func (this *multicastApiRegistry) listenSnapshots() error {
+	if this.snapshotAddr == "" {
+		return nil
+	}
+	var l net.Listener
+	var err error
+	if config := this.peerServerTLS(this.snapshotTLS); config != nil {
+		l, err = tls.Listen("tcp", this.snapshotAddr, config)
+	} else {
+		l, err = net.Listen("tcp", this.snapshotAddr)
+	}
+
+	if err != nil {
+		return err
+	}
+	this.snapshotListener = l
+	return nil
+}
+
+// snapshotPort is the port we serve snapshots on or 0 if we don't
+func (this *multicastApiRegistry) snapshotPort() int {
+	if this.snapshotListener == nil {
+		return 0
+	}
+	return this.snapshotListener.Addr().(*net.TCPAddr).Port
+}
+
+func (this *multicastApiRegistry) closeSnapshotListener() {
+	if this.snapshotListener != nil {
+		this.snapshotListener.Close()
+	}
+}
+
+func (this *multicastApiRegistry) serveSnapshotsLoop(ctx context.Context) error {
+	for {
+		conn, err := this.snapshotListener.Accept()
+
+		if err != nil {
+			return err
+		}
+		go this.serveSnapshot(ctx, conn)
+	}
+}
+
+func (this *multicastApiRegistry) serveSnapshot(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(snapshotIOTimeout))
+
+	err := json.NewEncoder(conn).Encode(this.buildSnapshot(ctx, conn.LocalAddr()))
+	if err != nil {
+		log.Println("Error sending snapshot to", conn.RemoteAddr(), err)
+		return
+	}
+	this.metrics.Add("apireg_snapshots_served_total", "Number of snapshots sent to peers", nil, 1)
+}
+
+// buildSnapshot collects what we know from others along with our own apis, which are served on the address the peer reached us at
+func (this *multicastApiRegistry) buildSnapshot(ctx context.Context, local net.Addr) *snapshotJSON {
+	snapshot := &snapshotJSON{SenderUUID: this.id.String(), Entries: make([]snapshotEntryJSON, 0)}
+
+	for _, curReg := range this.apiRegs.GetAllRegs() {
+		a := curReg.Api()
+		entry := snapshotEntryJSON{
+			apiRegisterMessageJSON: apiRegisterMessageJSON{
+				Type:        registerMessage,
+				ApiName:     a.Name(),
+				ApiVersion:  &versionJSON{Major: a.Version().Major(), Minor: a.Version().Minor(), BugFix: a.Version().BugFix()},
+				ApiPort:     a.HostPort(),
+				SenderUUID:  a.UUID().String(),
+				Environment: a.Environment(),
+				State:       a.State()},
+			HostIP: a.HostIP().String(),
+			Group:  a.Group()}
+		entry.setApiMetadata(a)
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+
+	localIP := net.IPv4zero
+	if tcpAddr, isTCP := local.(*net.TCPAddr); isTCP {
+		localIP = tcpAddr.IP
+	}
+	for _, curOwned := range this.ownedApis.All() {
+		a, ok, _ := curOwned.(*ownedApi).announceable(ctx)
+		//Same as with announcing we leave out anything whose health check says to skip it
+		if !ok {
+			continue
+		}
+		entry := snapshotEntryJSON{
+			apiRegisterMessageJSON: apiRegisterMessageJSON{
+				Type:        registerMessage,
+				ApiName:     a.Name(),
+				ApiVersion:  &versionJSON{Major: a.Version().Major(), Minor: a.Version().Minor(), BugFix: a.Version().BugFix()},
+				ApiPort:     a.HostPort(),
+				SenderUUID:  this.id.String(),
+				Environment: this.environment,
+				State:       a.State()},
+			HostIP: localIP.String()}
+		entry.setMetadata(curOwned.(*ownedApi).opts)
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	return snapshot
+}
+
+// maybeBootstrapFrom fetches a snapshot from addr in the background unless we already have one or aren't bootstrapping
+func (this *multicastApiRegistry) maybeBootstrapFrom(addr *net.TCPAddr) {
+	if !this.bootstrapEnabled || !atomic.CompareAndSwapUint32(&this.bootstrapped, 0, 1) {
+		return
+	}
+	go func() {
+		err := this.bootstrapFrom(addr)
+
+		if err != nil {
+			//Let the next peer that advertises a snapshot have a go
+			atomic.StoreUint32(&this.bootstrapped, 0)
+			this.reportError(errors.New(fmt.Sprint("fetching snapshot from ", addr, ": ", err)))
+		}
+	}()
+}
+
+func (this *multicastApiRegistry) bootstrapFrom(addr *net.TCPAddr) error {
+	dialer := &net.Dialer{Timeout: snapshotIOTimeout}
+	var conn net.Conn
+	var err error
+	identity := ""
+	if config := this.peerClientTLS(this.bootstrapTLS); config != nil {
+		var tlsConn *tls.Conn
+		tlsConn, err = tls.DialWithDialer(dialer, "tcp", addr.String(), config)
+		if err == nil {
+			identity = this.peerIdentity(tlsConn.ConnectionState())
+		}
+		conn = tlsConn
+	} else {
+		conn, err = dialer.Dial("tcp", addr.String())
+	}
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(snapshotIOTimeout))
+
+	snapshot := &snapshotJSON{}
+	err = json.NewDecoder(io.LimitReader(conn, snapshotMaxBytes)).Decode(snapshot)
+	if err != nil {
+		return err
+	}
+	applied := this.applySnapshot(snapshot, identity)
+	this.metrics.Add("apireg_snapshots_fetched_total", "Number of snapshots fetched from peers to bootstrap from", nil, 1)
+	//A snapshot is everything the peer knows so there is no need to wait on anyone else, unless we couldn't use it
+	if applied {
+		this.settleInitialSync("snapshot")
+	}
+	return nil
+}
+
+// applySnapshot tracks every entry of the snapshot that we would have tracked had it been announced to us, returning false
+// if none of it could be used. The identity the peer that sent it proved, if any, only goes on its own apis as the rest it
+// is just passing along
+func (this *multicastApiRegistry) applySnapshot(snapshot *snapshotJSON, identity string) bool {
+	//Without tokens or who first announced them there is no proving any entry was allowed to be announced
+	if this.admissionTokens != nil || this.publisherPolicy != nil {
+		return false
+	}
+	ourIDAsString := this.id.String()
+	for i := range snapshot.Entries {
+		curEntry := &snapshot.Entries[i]
+		hostIP := net.ParseIP(curEntry.HostIP)
+
+		if curEntry.SenderUUID == ourIDAsString || !shouldProcessMessage(this.environment, curEntry.Environment) ||
+			curEntry.Type == withdrawMessage || hostIP == nil {
+			continue
+		}
+		//An unspecified ip is no use to anyone wanting to dial the api
+		if hostIP.IsUnspecified() {
+			continue
+		}
+		entryIdentity := ""
+		if curEntry.SenderUUID == snapshot.SenderUUID {
+			entryIdentity = identity
+		}
+		this.applyMessage(&curEntry.apiRegisterMessageJSON, hostIP, apireg.WithIdentity(entryIdentity), apireg.WithGroup(curEntry.Group))
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package multicast
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+// newTestTLSConfigs makes a self signed certificate for 127.0.0.1 and returns a server config using it and a client config trusting it
+func newTestTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	failOnErr(err, t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	failOnErr(err, t)
+	cert, err := x509.ParseCertificate(der)
+	failOnErr(err, t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	tlsCert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}, &tls.Config{RootCAs: pool}
+}
+
+func TestThatSnapshotOverTLSBootstrapsOwnedApis(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", serverConfig))
+	failOnErr(err, t)
+	defer reg0.Close()
+	failOnErr(reg0.RegisterApi("Snapshotted", apireg.NewVersion(1, 0, 0), 9403), t)
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(clientConfig))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)), t)
+
+	apis := reg1.GetApisByApiName("Snapshotted")
+	if len(apis) != 1 || !apis[0].HostIP().Equal(net.ParseIP("127.0.0.1")) || apis[0].HostPort() != 9403 {
+		t.Fail()
+	}
+}
+
+func TestThatUnusableSnapshotDoesNotSettleInitialSync(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", serverConfig))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(clientConfig),
+		WithAdmissionTokens(map[string][]string{"*": {HashRegistrationToken("secret")}}))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	failOnErr(reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)), t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if reg1.WaitForInitialSync(ctx) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatSnapshotBootstrapFailsWithoutTrustingTheServer(t *testing.T) {
+	serverConfig, _ := newTestTLSConfigs(t)
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", serverConfig))
+	failOnErr(err, t)
+	defer reg0.Close()
+
+	reg1, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithSnapshotBootstrap(&tls.Config{}))
+	failOnErr(err, t)
+	defer reg1.Close()
+
+	if reg1.bootstrapFrom(reg0.(*multicastApiRegistry).snapshotListener.Addr().(*net.TCPAddr)) == nil {
+		t.Fail()
+	}
+}
+
+func TestThatApplySnapshotSkipsOurOwnApis(t *testing.T) {
+	r := &multicastApiRegistry{id: uuid.New(), environment: apireg.All, apiRegs: newSyncApiRegistrationStore(nil), activeColors: newSyncActiveColors(), initialSync: newInitialSync()}
+	entry := snapshotEntryJSON{
+		apiRegisterMessageJSON: apiRegisterMessageJSON{
+			ApiName:     "Ours",
+			ApiVersion:  &versionJSON{Major: 1},
+			ApiPort:     80,
+			SenderUUID:  r.id.String(),
+			Environment: apireg.All},
+		HostIP: "192.168.0.3"}
+
+	r.applySnapshot(&snapshotJSON{SenderUUID: uuid.NewString(), Entries: []snapshotEntryJSON{entry}}, "")
+
+	if len(r.GetAvailableApis()) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatApplySnapshotOnlyGivesPeersIdentityToItsOwnApis(t *testing.T) {
+	r := &multicastApiRegistry{id: uuid.New(), environment: apireg.All, apiRegs: newSyncApiRegistrationStore(nil), activeColors: newSyncActiveColors(), initialSync: newInitialSync()}
+	peer := uuid.NewString()
+	entry := func(name, sender string) snapshotEntryJSON {
+		return snapshotEntryJSON{
+			apiRegisterMessageJSON: apiRegisterMessageJSON{ApiName: name, ApiVersion: &versionJSON{Major: 1}, ApiPort: 80, SenderUUID: sender, Environment: apireg.All},
+			HostIP:                 "192.168.0.3"}
+	}
+
+	r.applySnapshot(&snapshotJSON{SenderUUID: peer, Entries: []snapshotEntryJSON{entry("Peers", peer), entry("Relayed", uuid.NewString())}}, "spiffe://peer")
+
+	peers, relayed := r.GetApisByApiName("Peers"), r.GetApisByApiName("Relayed")
+	if len(peers) != 1 || peers[0].Identity() != "spiffe://peer" || len(relayed) != 1 || relayed[0].Identity() != "" {
+		t.Fail()
+	}
+}
+
+func TestThatApplySnapshotIsSkippedWhenAdmissionTokensAreRequired(t *testing.T) {
+	tokens, err := newAdmissionTokens(map[string][]string{"*": {HashRegistrationToken("secret")}})
+	failOnErr(err, t)
+	r := &multicastApiRegistry{id: uuid.New(), environment: apireg.All, apiRegs: newSyncApiRegistrationStore(nil), activeColors: newSyncActiveColors(), initialSync: newInitialSync(), admissionTokens: tokens}
+	entry := snapshotEntryJSON{
+		apiRegisterMessageJSON: apiRegisterMessageJSON{
+			ApiName:     "Theirs",
+			ApiVersion:  &versionJSON{Major: 1},
+			ApiPort:     80,
+			SenderUUID:  uuid.NewString(),
+			Environment: apireg.All},
+		HostIP: "192.168.0.3"}
+
+	applied := r.applySnapshot(&snapshotJSON{SenderUUID: uuid.NewString(), Entries: []snapshotEntryJSON{entry}}, "")
+
+	if applied || len(r.GetAvailableApis()) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatSnapshotServerWithConfigWithoutCertificateFailsToStart(t *testing.T) {
+	r, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSnapshotServer("127.0.0.1:0", &tls.Config{}))
+
+	if err == nil {
+		r.Close()
+		t.Fail()
+	}
+}
@@ -0,0 +1,56 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// WithSocketReuse binds the group socket with SO_REUSEADDR and SO_REUSEPORT set so that any number of processes on the
+// same host can each run a registry on the same group. Multicast datagrams are handed to every socket bound to the group
+// so each process still sees all of the traffic, where without it whether a second process can bind at all and which
+// one gets the traffic depends on the platform. Only available on unix platforms
+func WithSocketReuse() Option {
+	return func(r *multicastApiRegistry) error {
+		if !socketReuseSupported {
+			return errors.New("WithSocketReuse is not supported on this platform")
+		}
+		udpTransport, isUDP := r.transport.(*udpMulticastTransport)
+		if !isUDP {
+			return errors.New("WithSocketReuse only applies to a multicast group and can't be used along with WithBroker")
+		}
+		udpTransport.reuse = true
+		return nil
+	}
+}
+
+// listenMulticastReusable does what net.ListenMulticastUDP does on the default interface but with the reuse options set
+func listenMulticastReusable(addr *net.UDPAddr) (*net.UDPConn, error) {
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	lc := &net.ListenConfig{Control: setReuseSockopts}
+	//Binding to the group rather than every address means we only get the group's traffic
+	pc, err := lc.ListenPacket(context.Background(), network, addr.String())
+
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+	group := &net.UDPAddr{IP: addr.IP}
+	if network == "udp4" {
+		err = ipv4.NewPacketConn(conn).JoinGroup(nil, group)
+	} else {
+		err = ipv6.NewPacketConn(conn).JoinGroup(nil, group)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
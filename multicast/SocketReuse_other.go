@@ -0,0 +1,14 @@
+//go:build !unix
+
+package multicast
+
+import (
+	"errors"
+	"syscall"
+)
+
+const socketReuseSupported bool = false
+
+func setReuseSockopts(network, address string, c syscall.RawConn) error {
+	return errors.New("socket reuse is not supported on this platform")
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package multicast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatRegistriesSharingReusedSocketBothGetAllTraffic(t *testing.T) {
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSocketReuse())
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithSocketReuse())
+	failOnErr(err, t)
+	defer reg1.Close()
+	announcer, err := NewMulticastRegistry(nil, apireg.All, uuid.New())
+	failOnErr(err, t)
+	defer announcer.Close()
+
+	failOnErr(announcer.RegisterApi("Reused", apireg.NewVersion(0, 0, 1), 9409), t)
+	time.Sleep(time.Millisecond * 200)
+
+	if len(reg0.GetApisByApiName("Reused")) != 1 || len(reg1.GetApisByApiName("Reused")) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatWithSocketReuseCantBeUsedWithBroker(t *testing.T) {
+	_, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSocketReuse())
+
+	if err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,167 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// How many events a Block subscription holds for its subscriber before it starts dropping them and flagging a gap
+const maxBlockedEvents int = 1024
+
+// subscription is a channel of events fed by Notify of a syncRegListenStore. Drop policies apply to the channel's buffer as
+// events are enqueued, Block subscriptions queue them for their own goroutine to wait on the subscriber with
+type subscription struct {
+	events chan apireg.RegistrationEvent
+	policy apireg.SlowConsumerPolicy
+	//Called for every event dropped because the subscriber wasn't keeping up
+	onDrop func()
+	//Set when an event was dropped and the subscriber hasn't been sent a gap for it yet
+	gapPending bool
+	store      *syncRegListenStore
+	closed     chan struct{}
+	closeOnce  sync.Once
+	//Held while enqueuing so that events is never closed in the middle of a send
+	sendMutex *sync.Mutex
+	done      bool
+	//Only used by Block, events waiting on the subscriber to make room and the goroutine that hands them over
+	queue      []apireg.RegistrationEvent
+	queueReady *sync.Cond
+	pumpDone   chan struct{}
+}
+
+func newSubscription(s *syncRegListenStore, opts *apireg.SubscribeOptions, onDrop func()) (*subscription, error) {
+	switch opts.Policy {
+	case apireg.Block:
+	case apireg.DropOldest, apireg.DropAndFlag:
+		if opts.BufferSize < 1 {
+			return nil, errors.New(fmt.Sprint("buffer size must be > 0 for ", opts.Policy))
+		}
+	default:
+		return nil, errors.New(fmt.Sprint("Unknown slow consumer policy ", opts.Policy))
+	}
+	if opts.BufferSize < 0 {
+		return nil, errors.New("buffer size must be >= 0 for Subscribe")
+	}
+	sub := &subscription{
+		events:    make(chan apireg.RegistrationEvent, opts.BufferSize),
+		policy:    opts.Policy,
+		onDrop:    onDrop,
+		store:     s,
+		closed:    make(chan struct{}),
+		sendMutex: &sync.Mutex{}}
+	if sub.policy == apireg.Block {
+		sub.queueReady = sync.NewCond(sub.sendMutex)
+		sub.pumpDone = make(chan struct{})
+		go sub.pump()
+	}
+	return sub, nil
+}
+
+func (this *subscription) Events() <-chan apireg.RegistrationEvent {
+	return this.events
+}
+
+func (this *subscription) Close() {
+	this.closeOnce.Do(func() {
+		this.store.Unsubscribe(this)
+		//Knocks the pump out of a blocked send
+		close(this.closed)
+		this.sendMutex.Lock()
+		this.done = true
+		if this.queueReady != nil {
+			this.queueReady.Signal()
+		}
+		this.sendMutex.Unlock()
+		if this.pumpDone != nil {
+			<-this.pumpDone
+		}
+		close(this.events)
+	})
+}
+
+// enqueue hands e to the subscriber according to its policy without ever waiting on it
+func (this *subscription) enqueue(e apireg.RegistrationEvent) {
+	this.sendMutex.Lock()
+	defer this.sendMutex.Unlock()
+	if this.done {
+		return
+	}
+
+	switch this.policy {
+	case apireg.Block:
+		if this.gapPending {
+			if len(this.queue) >= maxBlockedEvents {
+				this.onDrop()
+				return
+			}
+			this.queue = append(this.queue, apireg.NewGapEvent())
+			this.gapPending = false
+		}
+		if len(this.queue) >= maxBlockedEvents {
+			this.gapPending = true
+			this.onDrop()
+			return
+		}
+		this.queue = append(this.queue, e)
+		this.queueReady.Signal()
+	case apireg.DropOldest:
+		for {
+			select {
+			case this.events <- e:
+				return
+			default:
+			}
+			select {
+			case <-this.events:
+				this.onDrop()
+			default:
+			}
+		}
+	case apireg.DropAndFlag:
+		if this.gapPending && !this.trySend(apireg.NewGapEvent()) {
+			this.onDrop()
+			return
+		}
+		this.gapPending = false
+		if !this.trySend(e) {
+			this.gapPending = true
+			this.onDrop()
+		}
+	}
+}
+
+// pump waits on the subscriber for each queued event of a Block subscription in turn until it is closed
+func (this *subscription) pump() {
+	defer close(this.pumpDone)
+	this.sendMutex.Lock()
+	for {
+		for len(this.queue) == 0 && !this.done {
+			this.queueReady.Wait()
+		}
+		if this.done {
+			this.sendMutex.Unlock()
+			return
+		}
+		e := this.queue[0]
+		this.queue = this.queue[1:]
+		this.sendMutex.Unlock()
+
+		select {
+		case this.events <- e:
+		case <-this.closed:
+		}
+		this.sendMutex.Lock()
+	}
+}
+
+func (this *subscription) trySend(e apireg.RegistrationEvent) bool {
+	select {
+	case this.events <- e:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,189 @@
+package multicast
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func newTestEvent(t *testing.T, port int) apireg.RegistrationEvent {
+	a, err := apireg.NewApi("Subscribed", apireg.NewVersion(0, 0, 1), uuid.New(), apireg.All, net.ParseIP("10.0.0.2"), port)
+	failOnErr(err, t)
+	return apireg.NewAddEvent(a)
+}
+
+func subscribeForTest(t *testing.T, s *syncRegListenStore, dropped *atomic.Int32, opts ...apireg.SubscribeOption) *subscription {
+	sub, err := s.Subscribe(apireg.NewSubscribeOptions(opts...), func() { dropped.Add(1) })
+	failOnErr(err, t)
+	return sub
+}
+
+// waitForDispatch gives the Block pumps time to get through everything that was notified
+func waitForDispatch() {
+	time.Sleep(time.Millisecond * 50)
+}
+
+func TestThatDropOldestKeepsNewestEvents(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	sub := subscribeForTest(t, s, dropped, apireg.WithBufferSize(2), apireg.WithSlowConsumerPolicy(apireg.DropOldest))
+	defer sub.Close()
+
+	for i := 1; i <= 4; i++ {
+		s.Notify(newTestEvent(t, i))
+	}
+	waitForDispatch()
+
+	if (<-sub.Events()).Api().HostPort() != 3 || (<-sub.Events()).Api().HostPort() != 4 || dropped.Load() != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatDropAndFlagSendsGapBeforeNextEvent(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	sub := subscribeForTest(t, s, dropped, apireg.WithBufferSize(1))
+	defer sub.Close()
+
+	s.Notify(newTestEvent(t, 1))
+	s.Notify(newTestEvent(t, 2))
+	waitForDispatch()
+	if (<-sub.Events()).Api().HostPort() != 1 {
+		t.FailNow()
+	}
+	s.Notify(newTestEvent(t, 3))
+	waitForDispatch()
+	if (<-sub.Events()).Type() != apireg.Gap || dropped.Load() != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatBlockedSubscriberDoesNotHoldUpNotify(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	sub := subscribeForTest(t, s, dropped, apireg.WithBufferSize(0), apireg.WithSlowConsumerPolicy(apireg.Block))
+	notified := make(chan struct{})
+
+	go func() {
+		for i := 1; i <= 3; i++ {
+			s.Notify(newTestEvent(t, i))
+		}
+		close(notified)
+	}()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+	for i := 1; i <= 3; i++ {
+		if (<-sub.Events()).Api().HostPort() != i {
+			t.Fail()
+		}
+	}
+	sub.Close()
+	if _, open := <-sub.Events(); open || dropped.Load() != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatBlockedSubscriberDoesNotHoldUpOtherSubscribers(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	blocked := subscribeForTest(t, s, dropped, apireg.WithBufferSize(0), apireg.WithSlowConsumerPolicy(apireg.Block))
+	defer blocked.Close()
+	other := subscribeForTest(t, s, dropped, apireg.WithBufferSize(0), apireg.WithSlowConsumerPolicy(apireg.Block))
+	defer other.Close()
+
+	for i := 1; i <= 3; i++ {
+		s.Notify(newTestEvent(t, i))
+	}
+	//Nothing is reading blocked
+	for i := 1; i <= 3; i++ {
+		select {
+		case e := <-other.Events():
+			if e.Api().HostPort() != i {
+				t.Fail()
+			}
+		case <-time.After(time.Second):
+			t.FailNow()
+		}
+	}
+}
+
+func TestThatBlockSubscriptionFlagsGapOnceQueueIsFull(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	sub := subscribeForTest(t, s, dropped, apireg.WithBufferSize(0), apireg.WithSlowConsumerPolicy(apireg.Block))
+	defer sub.Close()
+
+	//One more than the pump can hold on to while it waits, plus the queue
+	for i := 1; i <= maxBlockedEvents+2; i++ {
+		s.Notify(newTestEvent(t, i))
+		if i == 1 {
+			waitForDispatch()
+		}
+	}
+	if dropped.Load() != 1 {
+		t.FailNow()
+	}
+	for i := 0; i < maxBlockedEvents+1; i++ {
+		<-sub.Events()
+	}
+	s.Notify(newTestEvent(t, 1))
+	if (<-sub.Events()).Type() != apireg.Gap {
+		t.Fail()
+	}
+}
+
+func TestThatClosingBlockedSubscriptionClosesEvents(t *testing.T) {
+	s := newSyncRegistrationListenerStore()
+	dropped := &atomic.Int32{}
+	sub := subscribeForTest(t, s, dropped, apireg.WithBufferSize(0), apireg.WithSlowConsumerPolicy(apireg.Block))
+	s.Notify(newTestEvent(t, 1))
+	waitForDispatch()
+
+	sub.Close()
+
+	if _, open := <-sub.Events(); open {
+		t.Fail()
+	}
+}
+
+func TestThatSubscribeReturnsErrorForDropPolicyWithoutBuffer(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()))
+	failOnErr(err, t)
+	defer r.Close()
+
+	if sub, err := r.Subscribe(apireg.WithBufferSize(0)); err == nil || sub != nil {
+		t.Fail()
+	}
+}
+
+func TestThatRegistrySubscriptionReceivesEvents(t *testing.T) {
+	b := NewBroker()
+	reg0, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg0.Close()
+	reg1, err := NewMulticastRegistry(nil, apireg.All, uuid.New(), WithBroker(b))
+	failOnErr(err, t)
+	defer reg1.Close()
+	sub, err := reg1.Subscribe()
+	failOnErr(err, t)
+	defer sub.Close()
+
+	failOnErr(reg0.RegisterApi("Subscribed", apireg.NewVersion(0, 0, 1), 9480), t)
+
+	select {
+	case e := <-sub.Events():
+		if e.Type() != apireg.Added || e.Api().Name() != "Subscribed" {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Fail()
+	}
+}
@@ -0,0 +1,69 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	minLoopRestartBackoff time.Duration = time.Millisecond * 100
+	maxLoopRestartBackoff time.Duration = time.Second * 30
+	//If a loop ran at least this long before failing then it was healthy and starts over at the min backoff
+	loopHealthyRunTime time.Duration = maxLoopRestartBackoff
+)
+
+// supervise runs loop until ctx is done, restarting it with backoff every time it exits early or panics
+func (this *multicastApiRegistry) supervise(ctx context.Context, name string, loop func(context.Context) error) {
+	backoff := minLoopRestartBackoff
+	for {
+		started := time.Now()
+		err := runRecovered(ctx, name, loop)
+
+		if ctx.Err() != nil {
+			return
+		}
+		this.reportError(err)
+		this.metrics.Add("apireg_loop_restarts_total", "Number of times a background loop stopped and had to be restarted", map[string]string{"loop": name}, 1)
+
+		if time.Since(started) >= loopHealthyRunTime {
+			backoff = minLoopRestartBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxLoopRestartBackoff {
+			backoff = maxLoopRestartBackoff
+		}
+	}
+}
+
+// runRecovered turns both a loop exiting and a loop panicking into an error describing what happened
+func runRecovered(ctx context.Context, name string, loop func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprint(name, " loop panicked: ", r))
+		}
+	}()
+
+	err = loop(ctx)
+	if err != nil {
+		return errors.New(fmt.Sprint(name, " loop stopped: ", err))
+	}
+	return errors.New(fmt.Sprint(name, " loop exited unexpectedly"))
+}
+
+// reportError hands err to whoever is reading Errors without ever blocking the registry
+func (this *multicastApiRegistry) reportError(err error) {
+	select {
+	case this.errs <- err:
+	default:
+		this.metrics.Add("apireg_errors_dropped_total", "Number of errors dropped because nothing was reading Errors", nil, 1)
+	}
+}
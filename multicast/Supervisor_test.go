@@ -0,0 +1,80 @@
+package multicast
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThatSupervisedLoopIsRestartedAfterPanic(t *testing.T) {
+	r := newSupervisorTestRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var runs int32
+
+	go r.supervise(ctx, "test", func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			panic("boom")
+		}
+		<-ctx.Done()
+		return nil
+	})
+
+	select {
+	case <-r.errs:
+	case <-time.After(time.Second):
+		t.Fatal("panic was not reported")
+	}
+	time.Sleep(minLoopRestartBackoff * 3)
+
+	if atomic.LoadInt32(&runs) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatSupervisedLoopErrorIsReportedAndCounted(t *testing.T) {
+	r := newSupervisorTestRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	loopErr := errors.New("loop failed")
+
+	go r.supervise(ctx, "test", func(ctx context.Context) error {
+		return loopErr
+	})
+
+	err := <-r.errs
+	cancel()
+
+	if err == nil || err.Error() != "test loop stopped: loop failed" || r.metrics.Value("apireg_loop_restarts_total", map[string]string{"loop": "test"}) < 1 {
+		t.Fail()
+	}
+}
+
+func TestThatSupervisedLoopIsNotRestartedOnceContextIsDone(t *testing.T) {
+	r := newSupervisorTestRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		r.supervise(ctx, "test", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("supervise did not return once the context was done")
+	}
+	if len(r.errs) != 0 {
+		t.Fail()
+	}
+}
+
+func newSupervisorTestRegistry() *multicastApiRegistry {
+	return &multicastApiRegistry{errs: make(chan error, 10), metrics: newSyncMetricStore()}
+}
@@ -1,6 +1,10 @@
 package multicast
 
 import (
+	"path"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +16,21 @@ type syncApiRegStore struct {
 	regsMutex     *sync.RWMutex
 	purgeTickChan <-chan time.Time
 	listeners     *syncRegListenStore
+	//Only apis it returns true for are in views and have their events reach listeners, nil for every api
+	visibility func(apireg.Api) bool
+	//Called with every api that is no longer tracked because it expired, however that was noticed, nil when nobody cares
+	onExpire func(apireg.Api)
+	//What is returned for each name, rebuilt on every write so that reading never allocates
+	views map[string]*apiView
+	//Sorted names of every view so that names sharing a prefix are found without going through all of them
+	viewNames []string
+}
+
+// apiView is a snapshot of the visible apis of a name for readers to share, so it is never changed once built
+type apiView struct {
+	//Ordered by when they expire, soonest first, so anything expired is always at the start
+	apis    []apireg.Api
+	expires []time.Time
 }
 
 func newSyncApiRegistrationStore(pChan <-chan time.Time) *syncApiRegStore {
@@ -19,6 +38,7 @@ func newSyncApiRegistrationStore(pChan <-chan time.Time) *syncApiRegStore {
 	syncStore.regs = make(map[string][]*apiRegistration)
 	syncStore.regsMutex = &sync.RWMutex{}
 	syncStore.listeners = newSyncRegistrationListenerStore()
+	syncStore.views = make(map[string]*apiView)
 	//if we never provide a channel then auto purging is disabled
 	if pChan != nil {
 		syncStore.purgeTickChan = pChan
@@ -28,7 +48,8 @@ func newSyncApiRegistrationStore(pChan <-chan time.Time) *syncApiRegStore {
 	return syncStore
 }
 
-func (this *syncApiRegStore) AddReg(reg *apiRegistration) {
+// AddReg starts tracking reg and returns true, unless it is already tracked
+func (this *syncApiRegStore) AddReg(reg *apiRegistration) bool {
 	this.regsMutex.Lock()
 	apis, contains := this.regs[reg.Api().Name()]
 	added := false
@@ -54,9 +75,11 @@ func (this *syncApiRegStore) AddReg(reg *apiRegistration) {
 		}
 	}
 	if added {
-		this.listeners.Notify(apireg.NewAddEvent(reg.Api()))
+		this.rebuildView(reg.Api().Name())
+		this.notify(apireg.NewAddEvent(reg.Api()))
 	}
 	this.regsMutex.Unlock()
+	return added
 
 }
 
@@ -82,7 +105,7 @@ func (this *syncApiRegStore) getAllRegsForNameAndTime(name string, time time.Tim
 
 		for _, curReg := range regs {
 			if curReg.Expired(time) {
-				this.RemoveRegForApi(curReg.Api())
+				this.expireReg(curReg)
 			} else {
 				matchingApis = append(matchingApis, curReg)
 			}
@@ -113,26 +136,156 @@ func (this *syncApiRegStore) getAllRegsForTime(t time.Time) []*apiRegistration {
 }
 
 func (this *syncApiRegStore) RemoveRegForApi(old apireg.Api) error {
+	this.removeReg(old)
+	return nil
+}
+
+// expireReg stops tracking reg for having expired, letting onExpire know unless another reader got to it first
+func (this *syncApiRegStore) expireReg(reg *apiRegistration) {
+	if this.removeReg(reg.Api()) && this.onExpire != nil {
+		this.onExpire(reg.Api())
+	}
+}
+
+// removeReg stops tracking old and returns true if it was tracked
+func (this *syncApiRegStore) removeReg(old apireg.Api) bool {
 	this.regsMutex.Lock()
 	apis, contains := this.regs[old.Name()]
 
+	removed := false
+
 	if contains {
 		if len(apis) == 1 && apisMatch(old, apis[0].Api()) {
 			delete(this.regs, old.Name())
+			removed = true
 		} else {
 			for i, curReg := range apis {
 				if apisMatch(old, curReg.Api()) {
 					apis = append(apis[:i], apis[i+1:]...)
 					this.regs[old.Name()] = apis
+					removed = true
 					break
 				}
 			}
 		}
+	}
+	//Only let listeners know if we actually had something to remove
+	if removed {
+		this.rebuildView(old.Name())
 		rEvent := apireg.NewRemovedEvent(old)
-		this.listeners.Notify(rEvent)
+		this.notify(rEvent)
 	}
 	this.regsMutex.Unlock()
-	return nil
+	return removed
+}
+
+// UpdateRegApi swaps out the Api that reg is tracking, used when something other than identity has changed like the ApiState
+func (this *syncApiRegStore) UpdateRegApi(reg *apiRegistration, a apireg.Api) {
+	this.regsMutex.Lock()
+	reg.UpdateApi(a)
+	this.rebuildView(a.Name())
+	this.notify(apireg.NewUpdatedEvent(a))
+	this.regsMutex.Unlock()
+}
+
+// RefreshReg records that reg was announced again at t
+func (this *syncApiRegStore) RefreshReg(reg *apiRegistration, t time.Time) {
+	this.regsMutex.Lock()
+	reg.UpdateTimeRegistered(t)
+	this.rebuildView(reg.Api().Name())
+	this.regsMutex.Unlock()
+}
+
+// RebuildView rebuilds the view of name for when what is visible has changed
+func (this *syncApiRegStore) RebuildView(name string) {
+	this.regsMutex.Lock()
+	this.rebuildView(name)
+	this.regsMutex.Unlock()
+}
+
+// rebuildView replaces the view of name with one of what is tracked now, regsMutex has to be held for writing
+func (this *syncApiRegStore) rebuildView(name string) {
+	regs := this.regs[name]
+	visible := make([]*apiRegistration, 0, len(regs))
+	for _, curReg := range regs {
+		if this.visibility == nil || this.visibility(curReg.Api()) {
+			visible = append(visible, curReg)
+		}
+	}
+	i, indexed := slices.BinarySearch(this.viewNames, name)
+	if len(visible) == 0 {
+		delete(this.views, name)
+		if indexed {
+			this.viewNames = slices.Delete(this.viewNames, i, i+1)
+		}
+		return
+	} else if !indexed {
+		this.viewNames = slices.Insert(this.viewNames, i, name)
+	}
+
+	view := &apiView{apis: make([]apireg.Api, len(visible)), expires: make([]time.Time, len(visible))}
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].TimeRegistered().Add(visible[i].LifeSpan()).Before(visible[j].TimeRegistered().Add(visible[j].LifeSpan()))
+	})
+	for i, curReg := range visible {
+		view.apis[i] = curReg.Api()
+		view.expires[i] = curReg.TimeRegistered().Add(curReg.LifeSpan())
+	}
+	this.views[name] = view
+}
+
+// ApisForName returns every visible api of name that hasn't expired at t. The slice is shared with every other reader so it
+// must not be changed, and reading it doesn't allocate
+func (this *syncApiRegStore) ApisForName(name string, t time.Time) []apireg.Api {
+	this.regsMutex.RLock()
+	view := this.views[name]
+	this.regsMutex.RUnlock()
+
+	if view == nil {
+		return nil
+	}
+	//Expired is when the expiry is before t, so the first one that isn't is where the live ones start
+	live := sort.Search(len(view.expires), func(i int) bool {
+		return !view.expires[i].Before(t)
+	})
+	return view.apis[live:len(view.apis):len(view.apis)]
+}
+
+// ApisForPattern returns every visible api that hasn't expired at t with a name matching pattern, see path.Match. Only the
+// names starting with what comes before the first wildcard are matched against it
+func (this *syncApiRegStore) ApisForPattern(pattern string, t time.Time) ([]apireg.Api, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
+	}
+
+	this.regsMutex.RLock()
+	names := make([]string, 0)
+	start, _ := slices.BinarySearch(this.viewNames, prefix)
+	for _, curName := range this.viewNames[start:] {
+		if !strings.HasPrefix(curName, prefix) {
+			break
+		}
+		if matched, _ := path.Match(pattern, curName); matched {
+			names = append(names, curName)
+		}
+	}
+	this.regsMutex.RUnlock()
+
+	apis := make([]apireg.Api, 0)
+	for _, curName := range names {
+		apis = append(apis, this.ApisForName(curName, t)...)
+	}
+	return apis, nil
+}
+
+func (this *syncApiRegStore) notify(e apireg.RegistrationEvent) {
+	if this.visibility == nil || this.visibility(e.Api()) {
+		this.listeners.Notify(e)
+	}
 }
 
 func (this *syncApiRegStore) purgeLoop() {
@@ -141,7 +294,8 @@ func (this *syncApiRegStore) purgeLoop() {
 	}
 }
 
-func (this *syncApiRegStore) purgeExpired(t time.Time) {
+// purgeExpired stops tracking everything that has expired at t and returns what that was
+func (this *syncApiRegStore) purgeExpired(t time.Time) []apireg.Api {
 	//Pulling list of names first from regs so we can release lock from Read mode as GetAllRegs could request lock for Write mode for an expired record
 	this.regsMutex.RLock()
 	regNames := make([]string, 0, len(this.regs))
@@ -150,23 +304,28 @@ func (this *syncApiRegStore) purgeExpired(t time.Time) {
 	}
 	this.regsMutex.RUnlock()
 
+	expired := make([]apireg.Api, 0)
 	for _, curName := range regNames {
-		this.purgeExpiredForNameAndTime(curName, t)
+		expired = append(expired, this.purgeExpiredForNameAndTime(curName, t)...)
 	}
+	return expired
 }
 
-func (this *syncApiRegStore) purgeExpiredForNameAndTime(name string, t time.Time) {
+func (this *syncApiRegStore) purgeExpiredForNameAndTime(name string, t time.Time) []apireg.Api {
 	this.regsMutex.RLock()
 	regs, contains := this.regs[name]
 	this.regsMutex.RUnlock()
 
+	expired := make([]apireg.Api, 0)
 	if contains {
 		for _, curReg := range regs {
 			if curReg.Expired(t) {
-				this.RemoveRegForApi(curReg.Api())
+				this.expireReg(curReg)
+				expired = append(expired, curReg.Api())
 			}
 		}
 	}
+	return expired
 }
 
 func (this *syncApiRegStore) AddListener(l apireg.RegistrationListener) {
@@ -175,3 +334,7 @@ func (this *syncApiRegStore) AddListener(l apireg.RegistrationListener) {
 func (this *syncApiRegStore) RemoveListener(l apireg.RegistrationListener) {
 	this.listeners.Remove(l)
 }
+
+func (this *syncApiRegStore) Subscribe(opts *apireg.SubscribeOptions, onDrop func()) (*subscription, error) {
+	return this.listeners.Subscribe(opts, onDrop)
+}
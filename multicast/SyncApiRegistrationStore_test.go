@@ -174,6 +174,83 @@ func TestThatExpiredRegsArePurgedWhenPurgeExpiredIsCalled(t *testing.T) {
 	}
 }
 
+func TestThatApisForNameLeavesOutExpiredWithoutPurging(t *testing.T) {
+	store := newSyncApiRegistrationStore(nil)
+	older, _ := newApiRegistration(getValidApi(), time.Now().Add(-time.Second*10), time.Second*15)
+	newer := getValidApiRegWithNameAndVersion(getValidApi().Name(), apireg.NewVersion(0, 0, 2))
+	store.AddReg(newer)
+	store.AddReg(older)
+
+	if len(store.ApisForName(getValidApi().Name(), time.Now())) != 2 {
+		t.FailNow()
+	}
+	apis := store.ApisForName(getValidApi().Name(), time.Now().Add(time.Second*10))
+	if len(apis) != 1 || apis[0] != newer.Api() || len(store.GetAllRegs()) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatRefreshRegMovesItToTheEndOfTheView(t *testing.T) {
+	store := newSyncApiRegistrationStore(nil)
+	older, _ := newApiRegistration(getValidApi(), time.Now().Add(-time.Second*10), time.Second*15)
+	newer := getValidApiRegWithNameAndVersion(getValidApi().Name(), apireg.NewVersion(0, 0, 2))
+	store.AddReg(older)
+	store.AddReg(newer)
+
+	store.RefreshReg(older, time.Now().Add(time.Second))
+	apis := store.ApisForName(getValidApi().Name(), time.Now().Add(time.Second*10))
+	if len(apis) != 2 || apis[1] != older.Api() {
+		t.Fail()
+	}
+}
+
+func TestThatApisForNameDoesNotAllocate(t *testing.T) {
+	store := newSyncApiRegistrationStore(nil)
+	store.AddReg(getValidApiReg())
+	name := getValidApi().Name()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		store.ApisForName(name, time.Now())
+	})
+	if allocs != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatApisForPatternMatchesFamilyOfNames(t *testing.T) {
+	store := newSyncApiRegistrationStore(nil)
+	for _, curName := range []string{"billing-invoices", "billing-payments", "billing", "shipping-labels"} {
+		store.AddReg(getValidApiRegWithNameAndVersion(curName, apireg.NewVersion(0, 0, 1)))
+	}
+
+	apis, err := store.ApisForPattern("billing-*", time.Now())
+	if err != nil || len(apis) != 2 || apis[0].Name() != "billing-invoices" || apis[1].Name() != "billing-payments" {
+		t.FailNow()
+	}
+	apis, err = store.ApisForPattern("*-labels", time.Now())
+	if err != nil || len(apis) != 1 || apis[0].Name() != "shipping-labels" {
+		t.Fail()
+	}
+}
+
+func TestThatApisForPatternForgetsNamesThatAreGone(t *testing.T) {
+	store := newSyncApiRegistrationStore(nil)
+	reg := getValidApiRegWithNameAndVersion("billing-invoices", apireg.NewVersion(0, 0, 1))
+	store.AddReg(reg)
+
+	store.RemoveRegForApi(reg.Api())
+	apis, err := store.ApisForPattern("billing-*", time.Now())
+	if err != nil || len(apis) != 0 || len(store.viewNames) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatApisForPatternReturnsErrorForBadPattern(t *testing.T) {
+	if _, err := newSyncApiRegistrationStore(nil).ApisForPattern("billing-[", time.Now()); err == nil {
+		t.Fail()
+	}
+}
+
 func getValidApiReg() *apiRegistration {
 	reg, _ := newApiRegistration(getValidApi(), time.Now(), time.Second*15)
 
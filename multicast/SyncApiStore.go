@@ -37,7 +37,7 @@ func (this *syncApiStore) All() []apireg.Api {
 	copy(apisCopy, this.apis)
 	this.apisMutex.RUnlock()
 
-	return this.apis
+	return apisCopy
 }
 
 func (this *syncApiStore) Contains(a apireg.Api) bool {
@@ -53,6 +53,18 @@ func (this *syncApiStore) Contains(a apireg.Api) bool {
 	return contains
 }
 
+// Get returns the stored Api that is Equal to a
+func (this *syncApiStore) Get(a apireg.Api) (apireg.Api, bool) {
+	this.apisMutex.RLock()
+	defer this.apisMutex.RUnlock()
+	for _, curApi := range this.apis {
+		if curApi.Equal(a) {
+			return curApi, true
+		}
+	}
+	return nil, false
+}
+
 func (this *syncApiStore) Remove(r apireg.Api) bool {
 	var removed bool
 
@@ -0,0 +1,45 @@
+package multicast
+
+import "sync"
+
+// Any jump in sequence bigger than this is taken as the sender having restarted rather than that many messages lost
+const maxSequenceGap uint64 = 64
+
+// syncLossTracker detects loss on the group from the gaps in each sender's message sequence numbers
+type syncLossTracker struct {
+	lastSeqs  map[string]uint64
+	lossMutex *sync.Mutex
+}
+
+func newSyncLossTracker() *syncLossTracker {
+	t := &syncLossTracker{}
+	t.lastSeqs = make(map[string]uint64)
+	t.lossMutex = &sync.Mutex{}
+
+	return t
+}
+
+// Observe records that a message with seq was received from sender and returns how many messages from sender were missed before it
+func (this *syncLossTracker) Observe(sender string, seq uint64) uint64 {
+	var missed uint64
+	this.lossMutex.Lock()
+	lastSeq, seen := this.lastSeqs[sender]
+
+	if seen && seq > lastSeq && seq-lastSeq <= maxSequenceGap {
+		missed = seq - lastSeq - 1
+	}
+	//Anything older than what we have already seen is a duplicate or a restart so it doesn't count towards loss
+	if !seen || seq > lastSeq || lastSeq-seq > maxSequenceGap {
+		this.lastSeqs[sender] = seq
+	}
+	this.lossMutex.Unlock()
+
+	return missed
+}
+
+// Forget stops tracking sender so that the next message from it starts fresh
+func (this *syncLossTracker) Forget(sender string) {
+	this.lossMutex.Lock()
+	delete(this.lastSeqs, sender)
+	this.lossMutex.Unlock()
+}
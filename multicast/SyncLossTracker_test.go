@@ -0,0 +1,56 @@
+package multicast
+
+import "testing"
+
+func TestThatFirstSequenceFromSenderHasNoLoss(t *testing.T) {
+	if newSyncLossTracker().Observe("a", 7) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatConsecutiveSequencesHaveNoLoss(t *testing.T) {
+	l := newSyncLossTracker()
+	var missed uint64
+
+	for i := uint64(1); i <= 10; i++ {
+		missed += l.Observe("a", i)
+	}
+
+	if missed != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatGapInSequenceIsCountedAsLoss(t *testing.T) {
+	l := newSyncLossTracker()
+
+	l.Observe("a", 1)
+
+	if l.Observe("a", 4) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatSequenceGoingBackwardsIsNotLoss(t *testing.T) {
+	l := newSyncLossTracker()
+	var missed uint64
+
+	missed += l.Observe("a", 500)
+	missed += l.Observe("a", 1)
+	missed += l.Observe("a", 2)
+
+	if missed != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatForgottenSenderStartsFresh(t *testing.T) {
+	l := newSyncLossTracker()
+
+	l.Observe("a", 1)
+	l.Forget("a")
+
+	if l.Observe("a", 4) != 0 {
+		t.Fail()
+	}
+}
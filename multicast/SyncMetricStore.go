@@ -0,0 +1,100 @@
+package multicast
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+type syncMetricStore struct {
+	metrics      map[string]*apireg.Metric
+	metricsMutex *sync.RWMutex
+}
+
+func newSyncMetricStore() *syncMetricStore {
+	s := &syncMetricStore{}
+	s.metrics = make(map[string]*apireg.Metric)
+	s.metricsMutex = &sync.RWMutex{}
+
+	return s
+}
+
+// Add increments the counter for name and labels by delta
+func (this *syncMetricStore) Add(name, help string, labels map[string]string, delta float64) {
+	this.metricsMutex.Lock()
+	this.getOrCreate(name, help, apireg.Counter, labels).Value += delta
+	this.metricsMutex.Unlock()
+}
+
+// Set sets the gauge for name and labels to value
+func (this *syncMetricStore) Set(name, help string, labels map[string]string, value float64) {
+	this.metricsMutex.Lock()
+	this.getOrCreate(name, help, apireg.Gauge, labels).Value = value
+	this.metricsMutex.Unlock()
+}
+
+// Value returns the current value for name and labels, 0 if it has never been set
+func (this *syncMetricStore) Value(name string, labels map[string]string) float64 {
+	this.metricsMutex.RLock()
+	defer this.metricsMutex.RUnlock()
+	m, contains := this.metrics[metricKey(name, labels)]
+	if !contains {
+		return 0
+	}
+	return m.Value
+}
+
+// All returns a copy of every metric sorted by name then labels
+func (this *syncMetricStore) All() []apireg.Metric {
+	this.metricsMutex.RLock()
+	keys := make([]string, 0, len(this.metrics))
+	for curKey := range this.metrics {
+		keys = append(keys, curKey)
+	}
+	sort.Strings(keys)
+
+	all := make([]apireg.Metric, len(keys))
+	for i, curKey := range keys {
+		all[i] = *this.metrics[curKey]
+		all[i].Labels = copyLabels(all[i].Labels)
+	}
+	this.metricsMutex.RUnlock()
+
+	return all
+}
+
+func (this *syncMetricStore) getOrCreate(name, help string, kind apireg.MetricKind, labels map[string]string) *apireg.Metric {
+	key := metricKey(name, labels)
+	m, contains := this.metrics[key]
+
+	if !contains {
+		m = &apireg.Metric{Name: name, Help: help, Kind: kind, Labels: copyLabels(labels)}
+		this.metrics[key] = m
+	}
+	return m
+}
+
+func metricKey(name string, labels map[string]string) string {
+	labelNames := make([]string, 0, len(labels))
+	for curName := range labels {
+		labelNames = append(labelNames, curName)
+	}
+	sort.Strings(labelNames)
+
+	key := &strings.Builder{}
+	key.WriteString(name)
+	for _, curName := range labelNames {
+		key.WriteString("," + curName + "=" + labels[curName])
+	}
+	return key.String()
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
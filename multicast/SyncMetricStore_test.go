@@ -0,0 +1,46 @@
+package multicast
+
+import (
+	"testing"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+func TestThatNewSyncMetricStoreIsEmpty(t *testing.T) {
+	if len(newSyncMetricStore().All()) != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatAddingToACounterAccumulates(t *testing.T) {
+	s := newSyncMetricStore()
+
+	s.Add("c", "", map[string]string{"a": "b"}, 1)
+	s.Add("c", "", map[string]string{"a": "b"}, 2)
+
+	if s.Value("c", map[string]string{"a": "b"}) != 3 || s.All()[0].Kind != apireg.Counter {
+		t.Fail()
+	}
+}
+
+func TestThatDifferentLabelsAreDifferentMetrics(t *testing.T) {
+	s := newSyncMetricStore()
+
+	s.Add("c", "", map[string]string{"a": "b"}, 1)
+	s.Add("c", "", map[string]string{"a": "c"}, 1)
+
+	if len(s.All()) != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatSettingAGaugeReplacesItsValue(t *testing.T) {
+	s := newSyncMetricStore()
+
+	s.Set("g", "", nil, 5)
+	s.Set("g", "", nil, 2)
+
+	if s.Value("g", nil) != 2 || s.All()[0].Kind != apireg.Gauge {
+		t.Fail()
+	}
+}
@@ -0,0 +1,144 @@
+package multicast
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+// A peer that hasn't answered this many pings in a row is taken as unreachable
+const unreachableAfterMissedPings int = 3
+
+type peerState struct {
+	peer apireg.Peer
+	//Where the peer answers pings, nil if it doesn't
+	pingAddr *net.UDPAddr
+	//Nonce of the ping waiting on an answer, 0 if none is
+	pingNonce   uint64
+	pingSent    time.Time
+	missedPings int
+	answered    bool
+}
+
+// pingTarget is a ping that should be sent to a peer
+type pingTarget struct {
+	id    uuid.UUID
+	addr  *net.UDPAddr
+	nonce uint64
+}
+
+// syncPeerStore keeps track of every other registry node heard on the group
+type syncPeerStore struct {
+	peers      map[uuid.UUID]*peerState
+	peersMutex *sync.RWMutex
+}
+
+func newSyncPeerStore() *syncPeerStore {
+	s := &syncPeerStore{}
+	s.peers = make(map[uuid.UUID]*peerState)
+	s.peersMutex = &sync.RWMutex{}
+
+	return s
+}
+
+// Heard records that a message from the node id arrived from ip at t, pingPort being where it answers pings or 0 if it doesn't
+func (this *syncPeerStore) Heard(id uuid.UUID, ip net.IP, agentVersion, configDigest string, env apireg.Environment, pingPort int, t time.Time) {
+	this.peersMutex.Lock()
+	state, known := this.peers[id]
+	if !known {
+		state = &peerState{}
+		this.peers[id] = state
+	}
+	state.peer = apireg.Peer{ID: id, Address: ip, AgentVersion: agentVersion, ConfigDigest: configDigest, Environment: env, LastHeard: t, RTT: state.peer.RTT}
+	if pingPort > 0 {
+		state.pingAddr = &net.UDPAddr{IP: ip, Port: pingPort}
+	} else {
+		state.pingAddr = nil
+	}
+	this.peersMutex.Unlock()
+}
+
+// Ponged records an answer from the node id to the ping with nonce at t, returning false if it wasn't for the ping we are waiting on
+func (this *syncPeerStore) Ponged(id uuid.UUID, nonce uint64, t time.Time) bool {
+	this.peersMutex.Lock()
+	defer this.peersMutex.Unlock()
+	state, known := this.peers[id]
+
+	if !known || nonce == 0 || state.pingNonce != nonce {
+		return false
+	}
+	state.peer.RTT = t.Sub(state.pingSent)
+	state.peer.LastHeard = t
+	state.pingNonce = 0
+	state.missedPings = 0
+	state.answered = true
+	return true
+}
+
+// PingTargets returns a ping to send to every peer that answers them, counting the ones still waiting on an answer as missed
+func (this *syncPeerStore) PingTargets(nextNonce func() uint64, t time.Time) []pingTarget {
+	this.peersMutex.Lock()
+	targets := make([]pingTarget, 0, len(this.peers))
+	for curID, curState := range this.peers {
+		if curState.pingAddr == nil {
+			continue
+		}
+		if curState.pingNonce != 0 {
+			curState.missedPings++
+		}
+		curState.pingNonce = nextNonce()
+		curState.pingSent = t
+		targets = append(targets, pingTarget{id: curID, addr: curState.pingAddr, nonce: curState.pingNonce})
+	}
+	this.peersMutex.Unlock()
+
+	return targets
+}
+
+// All returns a copy of every peer ordered by ID so that listing them is stable
+func (this *syncPeerStore) All() []apireg.Peer {
+	this.peersMutex.RLock()
+	all := make([]apireg.Peer, 0, len(this.peers))
+	for _, curState := range this.peers {
+		peer := curState.peer
+		peer.Reachability = curState.reachability()
+		all = append(all, peer)
+	}
+	this.peersMutex.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return bytes.Compare(all[i].ID[:], all[j].ID[:]) < 0
+	})
+	return all
+}
+
+func (this *peerState) reachability() apireg.Reachability {
+	if this.pingAddr == nil {
+		return apireg.ReachabilityUnknown
+	} else if this.missedPings >= unreachableAfterMissedPings {
+		return apireg.Unreachable
+	} else if this.answered {
+		return apireg.Reachable
+	}
+	return apireg.ReachabilityUnknown
+}
+
+// PurgeSilent forgets every peer that hasn't been heard from since before, returning their IDs
+func (this *syncPeerStore) PurgeSilent(before time.Time) []uuid.UUID {
+	purged := make([]uuid.UUID, 0)
+	this.peersMutex.Lock()
+	for curID, curState := range this.peers {
+		if curState.peer.LastHeard.Before(before) {
+			delete(this.peers, curID)
+			purged = append(purged, curID)
+		}
+	}
+	this.peersMutex.Unlock()
+
+	return purged
+}
@@ -0,0 +1,79 @@
+package multicast
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatHeardPeerIsListedWithLatestDetails(t *testing.T) {
+	s := newSyncPeerStore()
+	id := uuid.New()
+	now := time.Now()
+
+	s.Heard(id, net.ParseIP("192.168.0.3"), "0.1.0", "", apireg.All, 0, now.Add(-time.Second))
+	s.Heard(id, net.ParseIP("192.168.0.4"), "0.2.0", "", apireg.All, 0, now)
+
+	peers := s.All()
+	if len(peers) != 1 || !peers[0].Address.Equal(net.ParseIP("192.168.0.4")) || peers[0].AgentVersion != "0.2.0" || !peers[0].LastHeard.Equal(now) {
+		t.Fail()
+	}
+}
+
+func TestThatSilentPeersArePurged(t *testing.T) {
+	s := newSyncPeerStore()
+	silent := uuid.New()
+	now := time.Now()
+	s.Heard(silent, net.ParseIP("192.168.0.3"), "", "", apireg.All, 0, now.Add(-time.Hour))
+	s.Heard(uuid.New(), net.ParseIP("192.168.0.4"), "", "", apireg.All, 0, now)
+
+	purged := s.PurgeSilent(now.Add(-time.Minute))
+
+	if len(purged) != 1 || purged[0] != silent || len(s.All()) != 1 {
+		t.Fail()
+	}
+}
+
+func TestThatPeerAnsweringPingIsReachableWithRTT(t *testing.T) {
+	s := newSyncPeerStore()
+	id := uuid.New()
+	now := time.Now()
+	s.Heard(id, net.ParseIP("192.168.0.3"), "", "", apireg.All, 5325, now)
+
+	targets := s.PingTargets(newNonce, now)
+	if len(targets) != 1 || !s.Ponged(id, targets[0].nonce, now.Add(time.Millisecond*3)) {
+		t.FailNow()
+	}
+
+	peers := s.All()
+	if peers[0].Reachability != apireg.Reachable || peers[0].RTT != time.Millisecond*3 {
+		t.Fail()
+	}
+}
+
+func TestThatPongWithWrongNonceIsIgnored(t *testing.T) {
+	s := newSyncPeerStore()
+	id := uuid.New()
+	s.Heard(id, net.ParseIP("192.168.0.3"), "", "", apireg.All, 5325, time.Now())
+	targets := s.PingTargets(newNonce, time.Now())
+
+	if s.Ponged(id, targets[0].nonce+1, time.Now()) {
+		t.Fail()
+	}
+}
+
+func TestThatPeerMissingPingsIsUnreachable(t *testing.T) {
+	s := newSyncPeerStore()
+	s.Heard(uuid.New(), net.ParseIP("192.168.0.3"), "", "", apireg.All, 5325, time.Now())
+
+	for i := 0; i <= unreachableAfterMissedPings; i++ {
+		s.PingTargets(newNonce, time.Now())
+	}
+
+	if s.All()[0].Reachability != apireg.Unreachable {
+		t.Fail()
+	}
+}
@@ -0,0 +1,48 @@
+package multicast
+
+import "sync"
+
+// syncReflectionTracker counts what peers tell us about our own announcements, from their digests of what they have from
+// us and their echoes of the changes we announce, so the heartbeat can tell whether what we send is reaching them
+type syncReflectionTracker struct {
+	reflected       uint64
+	unreflected     uint64
+	reflectionMutex *sync.Mutex
+}
+
+func newSyncReflectionTracker() *syncReflectionTracker {
+	t := &syncReflectionTracker{}
+	t.reflectionMutex = &sync.Mutex{}
+
+	return t
+}
+
+// Reflected records n signals that a peer has what we announced
+func (this *syncReflectionTracker) Reflected(n int) {
+	this.reflectionMutex.Lock()
+	this.reflected += uint64(n)
+	this.reflectionMutex.Unlock()
+}
+
+// Unreflected records n signals that a peer is missing what we announced
+func (this *syncReflectionTracker) Unreflected(n int) {
+	this.reflectionMutex.Lock()
+	this.unreflected += uint64(n)
+	this.reflectionMutex.Unlock()
+}
+
+// TakeUnreflectedRatio returns the ratio of signals since the last time it was called that showed a peer missing what we
+// announced, false if there were no signals at all
+func (this *syncReflectionTracker) TakeUnreflectedRatio() (float64, bool) {
+	this.reflectionMutex.Lock()
+	defer this.reflectionMutex.Unlock()
+	total := this.reflected + this.unreflected
+	if total == 0 {
+		return 0, false
+	}
+	ratio := float64(this.unreflected) / float64(total)
+	this.reflected = 0
+	this.unreflected = 0
+
+	return ratio, true
+}
@@ -0,0 +1,32 @@
+package multicast
+
+import "testing"
+
+func TestThatNoSignalsGiveNoRatio(t *testing.T) {
+	if _, signalled := newSyncReflectionTracker().TakeUnreflectedRatio(); signalled {
+		t.Fail()
+	}
+}
+
+func TestThatUnreflectedRatioIsShareOfSignals(t *testing.T) {
+	r := newSyncReflectionTracker()
+
+	r.Reflected(3)
+	r.Unreflected(1)
+
+	if ratio, signalled := r.TakeUnreflectedRatio(); !signalled || ratio != 0.25 {
+		t.Fail()
+	}
+}
+
+func TestThatTakeUnreflectedRatioResetsTheWindow(t *testing.T) {
+	r := newSyncReflectionTracker()
+
+	r.Unreflected(2)
+	r.TakeUnreflectedRatio()
+	r.Reflected(1)
+
+	if ratio, _ := r.TakeUnreflectedRatio(); ratio != 0 {
+		t.Fail()
+	}
+}
@@ -9,12 +9,15 @@ import (
 type syncRegListenStore struct {
 	listeners      []apireg.RegistrationListener
 	listenersMutex *sync.RWMutex
+	subscriptions  []*subscription
+	subsMutex      *sync.Mutex
 }
 
 func newSyncRegistrationListenerStore() *syncRegListenStore {
 	s := &syncRegListenStore{}
 	s.listeners = make([]apireg.RegistrationListener, 0)
 	s.listenersMutex = &sync.RWMutex{}
+	s.subsMutex = &sync.Mutex{}
 
 	return s
 }
@@ -35,6 +38,13 @@ func (this *syncRegListenStore) Remove(l apireg.RegistrationListener) {
 	this.listenersMutex.Unlock()
 }
 func (this *syncRegListenStore) Notify(e apireg.RegistrationEvent) {
+	//Enqueuing never waits on a subscriber so holding the lock keeps every subscription's events in the same order
+	this.subsMutex.Lock()
+	for _, curSub := range this.subscriptions {
+		curSub.enqueue(e)
+	}
+	this.subsMutex.Unlock()
+
 	go func() {
 		this.listenersMutex.RLock()
 		for _, curL := range this.listeners {
@@ -43,3 +53,27 @@ func (this *syncRegListenStore) Notify(e apireg.RegistrationEvent) {
 		this.listenersMutex.RUnlock()
 	}()
 }
+
+// Subscribe adds a subscription with opts
+func (this *syncRegListenStore) Subscribe(opts *apireg.SubscribeOptions, onDrop func()) (*subscription, error) {
+	sub, err := newSubscription(this, opts, onDrop)
+
+	if err != nil {
+		return nil, err
+	}
+	this.subsMutex.Lock()
+	this.subscriptions = append(this.subscriptions, sub)
+	this.subsMutex.Unlock()
+	return sub, nil
+}
+
+func (this *syncRegListenStore) Unsubscribe(sub *subscription) {
+	this.subsMutex.Lock()
+	for i, curSub := range this.subscriptions {
+		if curSub == sub {
+			this.subscriptions = append(this.subscriptions[:i], this.subscriptions[i+1:]...)
+			break
+		}
+	}
+	this.subsMutex.Unlock()
+}
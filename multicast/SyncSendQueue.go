@@ -0,0 +1,101 @@
+package multicast
+
+import (
+	"context"
+	"sync"
+)
+
+type queuedMessage struct {
+	key     string
+	message *apiRegisterMessageJSON
+	//The sequence number it was stamped with before being put back with PushFront, which it keeps even if replaced so
+	//that no number goes unsent
+	seq uint64
+}
+
+// syncSendQueue holds messages that are waiting on the send budget. Messages pushed with the same non empty key
+// replace the one already waiting so that a slow queue sends the latest state instead of every state in between
+type syncSendQueue struct {
+	messages   []*queuedMessage
+	maxLen     int
+	queueMutex *sync.Mutex
+	//Signaled without blocking every time something is pushed
+	pushed chan struct{}
+}
+
+func newSyncSendQueue(maxLen int) *syncSendQueue {
+	q := &syncSendQueue{}
+	q.messages = make([]*queuedMessage, 0)
+	q.maxLen = maxLen
+	q.queueMutex = &sync.Mutex{}
+	q.pushed = make(chan struct{}, 1)
+
+	return q
+}
+
+// Push queues message returning false if the queue is full
+func (this *syncSendQueue) Push(key string, message *apiRegisterMessageJSON) bool {
+	this.queueMutex.Lock()
+	defer this.queueMutex.Unlock()
+
+	if key != "" {
+		for _, curMessage := range this.messages {
+			if curMessage.key == key {
+				curMessage.message = message
+				return true
+			}
+		}
+	}
+	if len(this.messages) >= this.maxLen {
+		return false
+	}
+	this.messages = append(this.messages, &queuedMessage{key: key, message: message})
+
+	select {
+	case this.pushed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// PushFront puts a message that was popped and stamped but couldn't be sent back at the front of the queue
+func (this *syncSendQueue) PushFront(m *queuedMessage) {
+	m.seq = m.message.Seq
+	this.queueMutex.Lock()
+	this.messages = append([]*queuedMessage{m}, this.messages...)
+	this.queueMutex.Unlock()
+}
+
+// TryPop returns the oldest message without waiting
+func (this *syncSendQueue) TryPop() (*queuedMessage, bool) {
+	this.queueMutex.Lock()
+	defer this.queueMutex.Unlock()
+
+	if len(this.messages) == 0 {
+		return nil, false
+	}
+	m := this.messages[0]
+	this.messages = this.messages[1:]
+
+	return m, true
+}
+
+// Pop waits for the oldest message until ctx is done
+func (this *syncSendQueue) Pop(ctx context.Context) (*queuedMessage, bool) {
+	for {
+		if m, popped := this.TryPop(); popped {
+			return m, true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-this.pushed:
+		}
+	}
+}
+
+func (this *syncSendQueue) Len() int {
+	this.queueMutex.Lock()
+	defer this.queueMutex.Unlock()
+	return len(this.messages)
+}
@@ -0,0 +1,99 @@
+package multicast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+func TestThatNewSyncSendQueueIsEmpty(t *testing.T) {
+	q := newSyncSendQueue(10)
+
+	if _, popped := q.TryPop(); popped || q.Len() != 0 {
+		t.Fail()
+	}
+}
+
+func TestThatSyncSendQueuePopsInOrder(t *testing.T) {
+	q := newSyncSendQueue(10)
+
+	q.Push("a", &apiRegisterMessageJSON{ApiName: "1"})
+	q.Push("b", &apiRegisterMessageJSON{ApiName: "2"})
+	m, _ := q.TryPop()
+
+	if m.message.ApiName != "1" {
+		t.Fail()
+	}
+}
+
+func TestThatPushingSameKeyReplacesWaitingMessage(t *testing.T) {
+	q := newSyncSendQueue(10)
+
+	q.Push("a", &apiRegisterMessageJSON{ApiName: "1"})
+	q.Push("a", &apiRegisterMessageJSON{ApiName: "2"})
+	m, _ := q.TryPop()
+
+	if q.Len() != 0 || m.message.ApiName != "2" {
+		t.Fail()
+	}
+}
+
+func TestThatPushingEmptyKeyNeverReplaces(t *testing.T) {
+	q := newSyncSendQueue(10)
+
+	q.Push("", &apiRegisterMessageJSON{ApiName: "1"})
+	q.Push("", &apiRegisterMessageJSON{ApiName: "2"})
+
+	if q.Len() != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatPushingOntoFullQueueFails(t *testing.T) {
+	q := newSyncSendQueue(1)
+
+	q.Push("a", &apiRegisterMessageJSON{ApiName: "1"})
+
+	if q.Push("b", &apiRegisterMessageJSON{ApiName: "2"}) {
+		t.Fail()
+	}
+}
+
+func TestThatPopWaitsForPush(t *testing.T) {
+	q := newSyncSendQueue(10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		q.Push("a", &apiRegisterMessageJSON{ApiName: "1"})
+	}()
+
+	if _, popped := q.Pop(ctx); !popped {
+		t.Fail()
+	}
+}
+
+func TestThatMessagePutBackKeepsItsSeq(t *testing.T) {
+	r, err := newMulticastApiRegistry(nil, apireg.All, uuid.New(), WithBroker(NewBroker()), WithSendBudget(1000000, 1000))
+	failOnErr(err, t)
+	defer r.Close()
+	r.outbound.Push("a", &apiRegisterMessageJSON{ApiName: "1"})
+	m, _ := r.outbound.TryPop()
+	_, err = r.encodeQueued(m)
+	failOnErr(err, t)
+
+	r.outbound.PushFront(m)
+	//Replacing it while it waits doesn't lose the seq it was given either
+	r.outbound.Push("a", &apiRegisterMessageJSON{ApiName: "2"})
+	m, _ = r.outbound.TryPop()
+	_, err = r.encodeQueued(m)
+	failOnErr(err, t)
+
+	if m.message.ApiName != "2" || m.message.Seq != 1 || r.seq != 1 {
+		t.Fail()
+	}
+}
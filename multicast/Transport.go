@@ -0,0 +1,45 @@
+package multicast
+
+import (
+	"net"
+)
+
+// groupConn is what the registry reads the group from
+type groupConn interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	Close() error
+}
+
+// transport is how the registry joins and writes to the group
+type transport interface {
+	Listen() (groupConn, error)
+	Write(payload []byte) error
+	//MTU of the link the group is on, 0 if it isn't known
+	MTU() int
+}
+
+// udpMulticastTransport is a real multicast group on the network
+type udpMulticastTransport struct {
+	addr *net.UDPAddr
+	//Set by WithSocketReuse
+	reuse bool
+}
+
+func (this *udpMulticastTransport) Listen() (groupConn, error) {
+	if this.reuse {
+		return listenMulticastReusable(this.addr)
+	}
+	return net.ListenMulticastUDP("udp", nil, this.addr)
+}
+
+func (this *udpMulticastTransport) Write(payload []byte) error {
+	conn, err := net.DialUDP("udp", nil, this.addr)
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(payload)
+	return err
+}
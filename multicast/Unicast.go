@@ -0,0 +1,140 @@
+package multicast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// listenUnicast opens the socket peers reach us on directly if anything needs one, like pings, convergence tracking or
+// answers to our queries
+func (this *multicastApiRegistry) listenUnicast() error {
+	if this.pingInterval == 0 && this.convergence == nil && !this.nameQueries {
+		return nil
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+
+	if err != nil {
+		return err
+	}
+	this.unicastConn = conn
+	return nil
+}
+
+// unicastPort is the port peers reach us on directly or 0 if they can't
+func (this *multicastApiRegistry) unicastPort() int {
+	if this.unicastConn == nil {
+		return 0
+	}
+	return this.unicastConn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (this *multicastApiRegistry) closeUnicastConn() {
+	if this.unicastConn != nil {
+		this.unicastConn.Close()
+	}
+}
+
+// writeUnicast sends a message of type t to a single peer. Registries without a unicast socket of their own still
+// answer from a throw away one the same way they write to the group
+func (this *multicastApiRegistry) writeUnicast(t messageType, nonce uint64, addr *net.UDPAddr) error {
+	return this.writeUnicastMessage(&apiRegisterMessageJSON{
+		Type:         t,
+		SenderUUID:   this.id.String(),
+		Environment:  this.environment,
+		Nonce:        nonce,
+		AgentVersion: AGENT_VERSION,
+		ConfigDigest: this.configDigest}, addr)
+}
+
+// writeUnicastMessage sends message as is to a single peer
+func (this *multicastApiRegistry) writeUnicastMessage(message *apiRegisterMessageJSON, addr *net.UDPAddr) error {
+	//Not sequenced as these don't go to the group and would otherwise look like loss to everyone on it
+	datagrams, err := this.encodeDatagrams(message)
+
+	if err != nil {
+		return err
+	}
+	//Answers to a query go out from every registry with the name at once so they are held to the send budget too, pings
+	//and acks are left alone so they measure the round trip and nothing else
+	if message.Type == answerMessage {
+		this.waitForBudget(datagrams)
+	}
+	if this.unicastConn != nil {
+		for _, curDatagram := range datagrams {
+			if _, err = this.unicastConn.WriteToUDP(curDatagram, addr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, curDatagram := range datagrams {
+		if _, err = conn.Write(curDatagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *multicastApiRegistry) unicastListenLoop(ctx context.Context) error {
+	buffer := make([]byte, this.receiveBufferSize+1)
+	for {
+		n, rAddr, err := this.unicastConn.ReadFromUDP(buffer)
+
+		if err != nil {
+			return err
+		} else if n > this.receiveBufferSize {
+			this.reportTruncated(rAddr)
+			continue
+		}
+		this.handleUnicast(buffer[:n], rAddr)
+	}
+}
+
+func (this *multicastApiRegistry) handleUnicast(data []byte, rAddr *net.UDPAddr) {
+	payload, _, err := this.decode(data, rAddr)
+	if err != nil {
+		this.metrics.Add("apireg_decode_failures_total", "Number of received messages that could not be decoded", nil, 1)
+		return
+	}
+	message := &apiRegisterMessageJSON{}
+	err = json.NewDecoder(bytes.NewReader(payload)).Decode(message)
+	if err != nil {
+		return
+	}
+	senderID, err := uuid.Parse(message.SenderUUID)
+	if err != nil || senderID == this.id {
+		return
+	}
+
+	switch message.Type {
+	case pingMessage:
+		err = this.writeUnicast(pongMessage, message.Nonce, rAddr)
+		if err != nil {
+			log.Println("Error answering ping from", rAddr, err)
+		}
+	case pongMessage:
+		if this.peers.Ponged(senderID, message.Nonce, time.Now()) {
+			this.metrics.Add("apireg_pongs_received_total", "Number of answers to our pings received from peers", nil, 1)
+		}
+	case ackMessage:
+		if this.convergence != nil {
+			this.observeAck(message.Nonce, time.Now())
+		}
+	case answerMessage, fragmentMessage:
+		//Answers are registrations like any other so they go through all of the same checks. Only answers are big enough to
+		//be fragmented, so fragments are put back together the same way as fragments heard on the group
+		this.handleMessageRecovered(data, rAddr, "")
+	}
+}
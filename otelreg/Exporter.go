@@ -0,0 +1,125 @@
+package otelreg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Exporter pushes the counters and gauges of a registry to an OpenTelemetry collector over OTLP
+type Exporter interface {
+	//Shutdown pushes the metrics one last time and stops
+	Shutdown(ctx context.Context) error
+}
+
+type exporterImpl struct {
+	provider *sdkmetric.MeterProvider
+}
+
+// NewExporter pushes the metrics of r over OTLP, configured like any other OpenTelemetry SDK through the standard
+// environment variables. OTEL_EXPORTER_OTLP_PROTOCOL (or OTEL_EXPORTER_OTLP_METRICS_PROTOCOL) picks "grpc" or the default
+// "http/protobuf", OTEL_EXPORTER_OTLP_ENDPOINT and friends where they are sent, OTEL_METRIC_EXPORT_INTERVAL how often and
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES the resource they are sent for
+func NewExporter(ctx context.Context, r apireg.ApiRegistry) (Exporter, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for NewExporter")
+	}
+	exporter, err := newEnvExporter(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithProducer(newRegistryProducer(r)))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(resource.Default()))
+
+	return &exporterImpl{provider: provider}, nil
+}
+
+func (this *exporterImpl) Shutdown(ctx context.Context) error {
+	return this.provider.Shutdown(ctx)
+}
+
+// newEnvExporter creates the OTLP exporter for the protocol set in the environment
+func newEnvExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	switch protocol {
+	case "", "http/protobuf":
+		return otlpmetrichttp.New(ctx)
+	case "grpc":
+		return otlpmetricgrpc.New(ctx)
+	}
+	return nil, errors.New(fmt.Sprint("Unsupported OTLP protocol ", protocol, ", only grpc and http/protobuf are"))
+}
+
+// registryProducer hands the metrics of a registry to the OpenTelemetry SDK each time it collects
+type registryProducer struct {
+	registry apireg.ApiRegistry
+	//Counters in the registry count up from when it started, which is close enough to when we did
+	start time.Time
+}
+
+func newRegistryProducer(r apireg.ApiRegistry) *registryProducer {
+	return &registryProducer{registry: r, start: time.Now()}
+}
+
+func (this *registryProducer) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	now := time.Now()
+	byName := make(map[string]*metricdata.Metrics)
+	names := make([]string, 0)
+
+	for _, curMetric := range this.registry.Metrics() {
+		m, seen := byName[curMetric.Name]
+		if !seen {
+			m = &metricdata.Metrics{Name: curMetric.Name, Description: curMetric.Help}
+			if curMetric.Kind == apireg.Counter {
+				m.Data = metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+			} else {
+				m.Data = metricdata.Gauge[float64]{}
+			}
+			byName[curMetric.Name] = m
+			names = append(names, curMetric.Name)
+		}
+		point := metricdata.DataPoint[float64]{Attributes: labelSet(curMetric.Labels), Time: now, Value: curMetric.Value}
+
+		switch data := m.Data.(type) {
+		case metricdata.Sum[float64]:
+			point.StartTime = this.start
+			data.DataPoints = append(data.DataPoints, point)
+			m.Data = data
+		case metricdata.Gauge[float64]:
+			data.DataPoints = append(data.DataPoints, point)
+			m.Data = data
+		}
+	}
+
+	sort.Strings(names)
+	scope := metricdata.ScopeMetrics{Scope: instrumentation.Scope{Name: "github.com/ZacharyDuve/apireg"}, Metrics: make([]metricdata.Metrics, len(names))}
+	for i, curName := range names {
+		scope.Metrics[i] = *byName[curName]
+	}
+	return []metricdata.ScopeMetrics{scope}, nil
+}
+
+func labelSet(labels map[string]string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for curKey, curValue := range labels {
+		kvs = append(kvs, attribute.String(curKey, curValue))
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,85 @@
+package otelreg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type staticRegistry struct {
+	apireg.ApiRegistry
+	metrics []apireg.Metric
+}
+
+func (this *staticRegistry) Metrics() []apireg.Metric {
+	return this.metrics
+}
+
+func collect(t *testing.T, r apireg.ApiRegistry) map[string]metricdata.Metrics {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(newRegistryProducer(r)))
+	sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	rm := &metricdata.ResourceMetrics{}
+	if reader.Collect(context.Background(), rm) != nil {
+		t.FailNow()
+	}
+
+	byName := make(map[string]metricdata.Metrics)
+	for _, curScope := range rm.ScopeMetrics {
+		for _, curMetric := range curScope.Metrics {
+			byName[curMetric.Name] = curMetric
+		}
+	}
+	return byName
+}
+
+func TestThatCountersAreExportedAsCumulativeSums(t *testing.T) {
+	r := &staticRegistry{metrics: []apireg.Metric{
+		{Name: "apireg_received_messages_total", Kind: apireg.Counter, Labels: map[string]string{"type": "register"}, Value: 3},
+		{Name: "apireg_received_messages_total", Kind: apireg.Counter, Labels: map[string]string{"type": "withdraw"}, Value: 1},
+	}}
+
+	sum, isSum := collect(t, r)["apireg_received_messages_total"].Data.(metricdata.Sum[float64])
+
+	if !isSum || !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality || len(sum.DataPoints) != 2 {
+		t.FailNow()
+	}
+	if value, _ := sum.DataPoints[0].Attributes.Value("type"); value.AsString() != "register" || sum.DataPoints[0].Value != 3 {
+		t.Fail()
+	}
+}
+
+func TestThatGaugesAreExportedAsGauges(t *testing.T) {
+	r := &staticRegistry{metrics: []apireg.Metric{{Name: "apireg_peers", Kind: apireg.Gauge, Value: 4}}}
+
+	gauge, isGauge := collect(t, r)["apireg_peers"].Data.(metricdata.Gauge[float64])
+
+	if !isGauge || len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 4 {
+		t.Fail()
+	}
+}
+
+func TestThatUnsupportedProtocolReturnsError(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+
+	if _, err := NewExporter(context.Background(), &staticRegistry{}); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatMetricsProtocolOverridesProtocol(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "grpc")
+
+	e, err := NewExporter(context.Background(), &staticRegistry{})
+	if err != nil {
+		t.FailNow()
+	}
+	//Nothing is listening for it so don't wait on the last push
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	e.Shutdown(ctx)
+}
@@ -0,0 +1,151 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// How long a single check of the watched process can take before it counts as down
+const checkTimeout time.Duration = time.Second * 5
+
+// Check reports whether the watched process is up, any error meaning it is down
+type Check func(ctx context.Context) error
+
+// HTTPCheck is up while a GET of url answers with a 2xx or 3xx status
+func HTTPCheck(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return errors.New(fmt.Sprint("health url ", url, " answered with ", resp.Status))
+		}
+		return nil
+	}
+}
+
+// TCPCheck is up while addr, like "127.0.0.1:6379", accepts connections
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Sidecar registers the Api of a process it doesn't control, like a legacy daemon, for as long as that process is up
+type Sidecar interface {
+	//Run checks the process every interval, registering its Api while it is up and withdrawing it while it is down.
+	//It blocks until ctx is done, withdrawing the Api before returning ctx.Err()
+	Run(ctx context.Context) error
+	//Registered returns true while the Api is registered
+	Registered() bool
+}
+
+type sidecarImpl struct {
+	registry   apireg.ApiRegistry
+	name       string
+	version    apireg.Version
+	port       int
+	check      Check
+	interval   time.Duration
+	opts       []apireg.RegisterOption
+	registered bool
+	regMutex   sync.Mutex
+}
+
+// NewSidecar watches a process serving name and version on port with check every interval, registering it in r while it is
+// up. opts are passed along to RegisterApi, for example to set its priority
+func NewSidecar(r apireg.ApiRegistry, name string, version apireg.Version, port int, check Check, interval time.Duration, opts ...apireg.RegisterOption) (Sidecar, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for NewSidecar")
+	} else if name == "" {
+		return nil, errors.New("name is required for NewSidecar")
+	} else if version == nil {
+		return nil, errors.New("version is required for NewSidecar")
+	} else if check == nil {
+		return nil, errors.New("check is required for NewSidecar")
+	} else if interval <= 0 {
+		return nil, errors.New("interval must be > 0 for NewSidecar")
+	}
+
+	return &sidecarImpl{registry: r, name: name, version: version, port: port, check: check, interval: interval, opts: opts}, nil
+}
+
+func (this *sidecarImpl) Run(ctx context.Context) error {
+	checkTicker := time.NewTicker(this.interval)
+	defer checkTicker.Stop()
+	//The process is checked right away so it doesn't have to wait a whole interval to be registered
+	this.checkProcess(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			this.withdraw()
+			return ctx.Err()
+		case <-checkTicker.C:
+			this.checkProcess(ctx)
+		}
+	}
+}
+
+func (this *sidecarImpl) checkProcess(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	err := this.check(checkCtx)
+
+	//Cancelled while checking says nothing about the process
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		this.withdraw()
+		return
+	}
+
+	this.regMutex.Lock()
+	defer this.regMutex.Unlock()
+	if this.registered {
+		return
+	}
+	err = this.registry.RegisterApi(this.name, this.version, this.port, this.opts...)
+
+	if err != nil {
+		log.Println("Error registering", this.name, "for the process on port", this.port, err)
+		return
+	}
+	this.registered = true
+}
+
+func (this *sidecarImpl) withdraw() {
+	this.regMutex.Lock()
+	if this.registered {
+		this.registry.DeregisterApi(this.name, this.version, this.port)
+		this.registered = false
+	}
+	this.regMutex.Unlock()
+}
+
+func (this *sidecarImpl) Registered() bool {
+	this.regMutex.Lock()
+	defer this.regMutex.Unlock()
+	return this.registered
+}
@@ -0,0 +1,140 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+type recordingRegistry struct {
+	apireg.ApiRegistry
+	calls      []string
+	callsMutex sync.Mutex
+}
+
+func (this *recordingRegistry) record(call string) error {
+	this.callsMutex.Lock()
+	this.calls = append(this.calls, call)
+	this.callsMutex.Unlock()
+	return nil
+}
+
+func (this *recordingRegistry) RegisterApi(name string, version apireg.Version, port int, opts ...apireg.RegisterOption) error {
+	return this.record("register")
+}
+
+func (this *recordingRegistry) DeregisterApi(name string, version apireg.Version, port int) error {
+	return this.record("deregister")
+}
+
+func (this *recordingRegistry) Calls() []string {
+	this.callsMutex.Lock()
+	defer this.callsMutex.Unlock()
+	return append([]string{}, this.calls...)
+}
+
+func callsEqual(got []string, expected ...string) bool {
+	if len(got) != len(expected) {
+		return false
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestThatNewSidecarReturnsErrorIfCheckIsNil(t *testing.T) {
+	_, err := NewSidecar(&recordingRegistry{}, "Legacy", apireg.NewVersion(0, 0, 1), 8080, nil, time.Second)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatNewSidecarReturnsErrorIfIntervalIsNotPositive(t *testing.T) {
+	_, err := NewSidecar(&recordingRegistry{}, "Legacy", apireg.NewVersion(0, 0, 1), 8080, TCPCheck("127.0.0.1:1"), 0)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatSidecarRegistersWhileProcessIsUpAndWithdrawsWhileDown(t *testing.T) {
+	r := &recordingRegistry{}
+	up := &atomic.Bool{}
+	up.Store(true)
+	check := func(ctx context.Context) error {
+		if !up.Load() {
+			return errors.New("down")
+		}
+		return nil
+	}
+	s, err := NewSidecar(r, "Legacy", apireg.NewVersion(0, 0, 1), 8080, check, time.Millisecond*20)
+	if err != nil {
+		t.FailNow()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+	if !s.Registered() {
+		t.Fail()
+	}
+	up.Store(false)
+	time.Sleep(time.Millisecond * 50)
+	up.Store(true)
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+
+	if <-runErr != context.Canceled || !callsEqual(r.Calls(), "register", "deregister", "register", "deregister") {
+		t.Fail()
+	}
+}
+
+func TestThatHTTPCheckFailsOnErrorStatus(t *testing.T) {
+	healthy := &atomic.Bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	check := HTTPCheck(server.URL)
+
+	if check(context.Background()) == nil {
+		t.Fail()
+	}
+	healthy.Store(true)
+	if check(context.Background()) != nil {
+		t.Fail()
+	}
+}
+
+func TestThatTCPCheckFailsOnceListenerIsClosed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	check := TCPCheck(l.Addr().String())
+
+	if check(context.Background()) != nil {
+		t.Fail()
+	}
+	l.Close()
+	if check(context.Background()) == nil {
+		t.Fail()
+	}
+}
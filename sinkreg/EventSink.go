@@ -0,0 +1,93 @@
+package sinkreg
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+// EventSink receives every event of a registry so that discovery activity can be streamed somewhere else
+type EventSink interface {
+	//Send delivers e, Forward waits for it to return before sending the next event
+	Send(e Event) error
+	//Close flushes anything buffered and releases the sink
+	Close() error
+}
+
+// Event is a RegistrationEvent as it is handed to an EventSink, ready to be encoded as JSON
+type Event struct {
+	Time time.Time        `json:"time"`
+	Type apireg.EventType `json:"event"`
+	//Api is nil for gap events, which mark where events were dropped as the sink couldn't keep up
+	Api *EventApi `json:"api,omitempty"`
+}
+
+// EventApi is the Api an Event is about
+type EventApi struct {
+	Name        string             `json:"name"`
+	Version     string             `json:"version"`
+	HostIP      string             `json:"host-ip"`
+	HostPort    int                `json:"host-port"`
+	State       apireg.ApiState    `json:"state"`
+	Environment apireg.Environment `json:"env"`
+	SenderUUID  string             `json:"sender-uuid"`
+	Group       string             `json:"group,omitempty"`
+	Tags        map[string]string  `json:"tags,omitempty"`
+}
+
+// NewEvent is e as it happened at t
+func NewEvent(e apireg.RegistrationEvent, t time.Time) Event {
+	event := Event{Time: t, Type: e.Type()}
+	if a := e.Api(); a != nil {
+		event.Api = &EventApi{Name: a.Name(), Version: a.Version().String(), HostIP: a.HostIP().String(), HostPort: a.HostPort(), State: a.State(),
+			Environment: a.Environment(), SenderUUID: a.UUID().String(), Group: a.Group(), Tags: a.Tags()}
+	}
+	return event
+}
+
+// Forwarder sends the events of a registry to an EventSink until it is closed
+type Forwarder interface {
+	//Close stops forwarding, waiting for the event being sent, and closes the sink
+	Close() error
+}
+
+type forwarderImpl struct {
+	sub  apireg.Subscription
+	sink EventSink
+	done chan struct{}
+}
+
+// Forward sends every event of r to s from a subscription made with opts, so by default events are dropped and a gap event
+// sent in their place when s falls behind. Errors from s are logged and the event is skipped
+func Forward(r apireg.ApiRegistry, s EventSink, opts ...apireg.SubscribeOption) (Forwarder, error) {
+	if r == nil {
+		return nil, errors.New("r (registry) is required for Forward")
+	} else if s == nil {
+		return nil, errors.New("s (sink) is required for Forward")
+	}
+	sub, err := r.Subscribe(opts...)
+
+	if err != nil {
+		return nil, err
+	}
+	f := &forwarderImpl{sub: sub, sink: s, done: make(chan struct{})}
+	go f.forward()
+	return f, nil
+}
+
+func (this *forwarderImpl) forward() {
+	defer close(this.done)
+	for curEvent := range this.sub.Events() {
+		if err := this.sink.Send(NewEvent(curEvent, time.Now())); err != nil {
+			log.Println("Error sending", curEvent.Type(), "event to sink", err)
+		}
+	}
+}
+
+func (this *forwarderImpl) Close() error {
+	this.sub.Close()
+	<-this.done
+	return this.sink.Close()
+}
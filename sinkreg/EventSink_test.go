@@ -0,0 +1,88 @@
+package sinkreg
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/google/uuid"
+)
+
+type channelSubscription struct {
+	events    chan apireg.RegistrationEvent
+	closeOnce sync.Once
+}
+
+func (this *channelSubscription) Events() <-chan apireg.RegistrationEvent {
+	return this.events
+}
+
+func (this *channelSubscription) Close() {
+	this.closeOnce.Do(func() { close(this.events) })
+}
+
+type subscribableRegistry struct {
+	apireg.ApiRegistry
+	sub *channelSubscription
+}
+
+func (this *subscribableRegistry) Subscribe(opts ...apireg.SubscribeOption) (apireg.Subscription, error) {
+	return this.sub, nil
+}
+
+type recordingSink struct {
+	events []Event
+	closed bool
+	mutex  *sync.Mutex
+}
+
+func (this *recordingSink) Send(e Event) error {
+	this.mutex.Lock()
+	this.events = append(this.events, e)
+	this.mutex.Unlock()
+	return nil
+}
+
+func (this *recordingSink) Close() error {
+	this.closed = true
+	return nil
+}
+
+func newSinkApi(t *testing.T) apireg.Api {
+	a, err := apireg.NewApi("Billing", apireg.NewVersion(1, 2, 3), uuid.New(), apireg.Prod, net.ParseIP("10.0.0.2"), 8080, apireg.WithApiTags(map[string]string{"team": "payments"}))
+	if err != nil {
+		t.FailNow()
+	}
+	return a
+}
+
+func TestThatForwardRequiresSink(t *testing.T) {
+	if _, err := Forward(&subscribableRegistry{}, nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatForwardSendsEveryEventToSink(t *testing.T) {
+	r := &subscribableRegistry{sub: &channelSubscription{events: make(chan apireg.RegistrationEvent, 2)}}
+	sink := &recordingSink{mutex: &sync.Mutex{}}
+	f, err := Forward(r, sink)
+	if err != nil {
+		t.FailNow()
+	}
+	r.sub.events <- apireg.NewAddEvent(newSinkApi(t))
+	r.sub.events <- apireg.NewGapEvent()
+	time.Sleep(time.Millisecond * 20)
+	f.Close()
+
+	if !sink.closed || len(sink.events) != 2 {
+		t.FailNow()
+	}
+	if sink.events[0].Type != apireg.Added || sink.events[0].Api.Name != "Billing" || sink.events[0].Api.Tags["team"] != "payments" {
+		t.Fail()
+	}
+	if sink.events[1].Type != apireg.Gap || sink.events[1].Api != nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,46 @@
+package sinkreg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+type jsonlSink struct {
+	encoder *json.Encoder
+	closer  io.Closer
+	mutex   *sync.Mutex
+}
+
+// NewJSONLSink writes each event to w as a line of JSON
+func NewJSONLSink(w io.Writer) (EventSink, error) {
+	if w == nil {
+		return nil, errors.New("w (writer) is required for NewJSONLSink")
+	}
+	return &jsonlSink{encoder: json.NewEncoder(w), mutex: &sync.Mutex{}}, nil
+}
+
+// NewFileSink appends each event to the file at path as a line of JSON, creating it if it doesn't exist
+func NewFileSink(path string) (EventSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSink{encoder: json.NewEncoder(f), closer: f, mutex: &sync.Mutex{}}, nil
+}
+
+func (this *jsonlSink) Send(e Event) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.encoder.Encode(&e)
+}
+
+func (this *jsonlSink) Close() error {
+	if this.closer == nil {
+		return nil
+	}
+	return this.closer.Close()
+}
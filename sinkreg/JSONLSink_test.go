@@ -0,0 +1,55 @@
+package sinkreg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+)
+
+func TestThatJSONLSinkWritesALinePerEvent(t *testing.T) {
+	out := &bytes.Buffer{}
+	sink, err := NewJSONLSink(out)
+	if err != nil {
+		t.FailNow()
+	}
+
+	sink.Send(NewEvent(apireg.NewAddEvent(newSinkApi(t)), time.Now()))
+	sink.Send(NewEvent(apireg.NewRemovedEvent(newSinkApi(t)), time.Now()))
+
+	lines := 0
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		e := Event{}
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Api == nil || e.Api.Version != "v1.2.3" || e.Api.HostIP != "10.0.0.2" {
+			t.Fail()
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Fail()
+	}
+}
+
+func TestThatFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.FailNow()
+		}
+		sink.Send(NewEvent(apireg.NewAddEvent(newSinkApi(t)), time.Now()))
+		sink.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.Count(data, []byte("\n")) != 2 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,52 @@
+package sinkreg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// How long sending a single event to Kafka can take before it is given up on
+const kafkaSendTimeout time.Duration = time.Second * 10
+
+// kafkaWriter is the part of *kafka.Writer the sink uses
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type kafkaSink struct {
+	writer kafkaWriter
+}
+
+// NewKafkaSink produces each event to Kafka with w as JSON, keyed by the api name so that every event of an api lands on
+// the same partition in order as long as w hashes keys, like with &kafka.Hash{}. w decides the brokers, topic, batching and
+// security. A synchronous writer waits up to its BatchTimeout for every event so it should be short, or w Async
+func NewKafkaSink(w *kafka.Writer) (EventSink, error) {
+	if w == nil {
+		return nil, errors.New("w (writer) is required for NewKafkaSink")
+	}
+	return &kafkaSink{writer: w}, nil
+}
+
+func (this *kafkaSink) Send(e Event) error {
+	value, err := json.Marshal(&e)
+
+	if err != nil {
+		return err
+	}
+	message := kafka.Message{Value: value, Time: e.Time}
+	if e.Api != nil {
+		message.Key = []byte(e.Api.Name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaSendTimeout)
+	defer cancel()
+	return this.writer.WriteMessages(ctx, message)
+}
+
+func (this *kafkaSink) Close() error {
+	return this.writer.Close()
+}
@@ -0,0 +1,43 @@
+package sinkreg
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ZacharyDuve/apireg"
+	"github.com/segmentio/kafka-go"
+)
+
+type recordingWriter struct {
+	messages []kafka.Message
+}
+
+func (this *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	this.messages = append(this.messages, msgs...)
+	return nil
+}
+
+func (this *recordingWriter) Close() error {
+	return nil
+}
+
+func TestThatNewKafkaSinkRequiresWriter(t *testing.T) {
+	if _, err := NewKafkaSink(nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestThatKafkaSinkKeysEventsByApiName(t *testing.T) {
+	w := &recordingWriter{}
+	sink := &kafkaSink{writer: w}
+
+	if sink.Send(NewEvent(apireg.NewAddEvent(newSinkApi(t)), time.Now())) != nil || len(w.messages) != 1 {
+		t.FailNow()
+	}
+	e := Event{}
+	if string(w.messages[0].Key) != "Billing" || json.Unmarshal(w.messages[0].Value, &e) != nil || e.Type != apireg.Added {
+		t.Fail()
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/ZacharyDuve/apireg/sinkreg
+
+go 1.22.6
+
+require (
+	github.com/ZacharyDuve/apireg v0.0.0
+	github.com/google/uuid v1.6.0
+	github.com/segmentio/kafka-go v0.4.47
+)
+
+require (
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace github.com/ZacharyDuve/apireg => ../